@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/spf13/pflag"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+)
+
+// accountRole is an account to scan through a role assumed in it, or with
+// the caller's credentials when role is empty.
+type accountRole struct {
+	account    string
+	role       string
+	externalID string
+}
+
+// accountEntry is an account of an accounts file, either the role alone or
+// a mapping with the role and an external id.
+type accountEntry struct {
+	Role       string `yaml:"role"`
+	ExternalID string `yaml:"externalId"`
+}
+
+func (e *accountEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&e.Role)
+	}
+	type plain accountEntry
+	return node.Decode((*plain)(e))
+}
+
+var accountID = regexp.MustCompile(`^[0-9]{12}$`)
+
+// readAccounts reads a YAML file mapping account ids to the role to assume
+// in each, as an arn or a name:
+//
+//	"111111111111": arn:aws:iam::111111111111:role/audit
+//	"222222222222":
+//	  role: audit
+//	  externalId: secret
+func readAccounts(path string) ([]accountRole, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading accounts file: %w", err)
+	}
+	entries := map[string]accountEntry{}
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing accounts file: %w", err)
+	}
+	accounts := []accountRole{}
+	for account, entry := range entries {
+		if !accountID.MatchString(account) {
+			return nil, fmt.Errorf("accounts file: %q is not an account id, which have 12 digits", account)
+		}
+		if entry.Role == "" {
+			return nil, fmt.Errorf("accounts file: no role for account %s", account)
+		}
+		accounts = append(accounts, accountRole{account: account, role: entry.Role, externalID: entry.ExternalID})
+	}
+	if len(accounts) == 0 {
+		return nil, errors.New("accounts file lists no accounts")
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].account < accounts[j].account })
+	return accounts, nil
+}
+
+// defaultOrgRole is the role Organizations creates in the accounts it
+// creates, which --org assumes unless told otherwise.
+const defaultOrgRole = "OrganizationAccountAccessRole"
+
+type accountOptions struct {
+	accounts string
+	org      bool
+	orgRole  string
+	names    bool
+}
+
+func (o *accountOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.accounts, "accounts", "", "YAML file mapping account ids to a role to assume in each, to scan them all")
+	flags.BoolVar(&o.org, "org", false, "scan every active account of the organization, run from its management account")
+	flags.StringVar(&o.orgRole, "org-role", defaultOrgRole, "name of the role --org assumes in each member account")
+	flags.BoolVar(&o.names, "account-names", false, "follow account ids with the alias or organization name of the account")
+}
+
+func (o *accountOptions) enabled() bool {
+	return o.accounts != "" || o.org
+}
+
+// apps returns an app per account to scan, through a role assumed with the
+// credentials of a.
+func (o *accountOptions) apps(a *app) ([]*app, error) {
+	if o.accounts != "" && o.org {
+		return nil, errors.New("--accounts and --org cannot be used together")
+	}
+	var accounts []accountRole
+	var err error
+	if o.org {
+		accounts, err = organizationAccounts(a, o.orgRole)
+	} else {
+		accounts, err = readAccounts(o.accounts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	apps := []*app{}
+	for _, account := range accounts {
+		accountApp, err := a.forAccount(account)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, accountApp)
+	}
+	return apps, nil
+}
+
+// resolveNames sets accountNames for --account-names, to the alias of the
+// account of each of apps, or else the name Organizations gives it when
+// the caller may list the accounts of the organization. The account of an
+// app without one is that of the caller.
+func (o *accountOptions) resolveNames(apps []*app) {
+	if !o.names {
+		return
+	}
+	names := map[string]string{}
+	var mu sync.Mutex
+	var g errgroup.Group
+	g.SetLimit(apps[0].fetcher.concurrencyLimit())
+	g.Go(func() error {
+		pages := organizations.NewListAccountsPaginator(organizations.NewFromConfig(apps[0].cfg), &organizations.ListAccountsInput{})
+		for pages.HasMorePages() {
+			page, err := pages.NextPage(apps[0].ctx)
+			if err != nil {
+				logger.Info("could not list organization accounts for their names", "error", err)
+				return nil
+			}
+			mu.Lock()
+			for _, account := range page.Accounts {
+				if _, ok := names[aws.ToString(account.Id)]; !ok {
+					names[aws.ToString(account.Id)] = aws.ToString(account.Name)
+				}
+			}
+			mu.Unlock()
+		}
+		return nil
+	})
+	for _, a := range apps {
+		a := a
+		g.Go(func() error {
+			account := a.account
+			if account == "" {
+				caller, err := a.fetcher.CallerArn(a.ctx)
+				if err != nil {
+					logger.Info("could not get the account of the caller for its alias", "error", err)
+					return nil
+				}
+				parsed, _ := awsarn.Parse(caller)
+				account = parsed.AccountID
+			}
+			res, err := iam.NewFromConfig(a.cfg, a.opts.pinIAM).ListAccountAliases(a.ctx, &iam.ListAccountAliasesInput{})
+			if err != nil {
+				logger.Info("could not list account aliases", "account", account, "error", err)
+				return nil
+			}
+			if len(res.AccountAliases) > 0 {
+				mu.Lock()
+				names[account] = res.AccountAliases[0]
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	accountNames = names
+}
+
+// organizationAccounts lists the active accounts of the organization of the
+// caller, with role to assume in each but the caller's own, which is called
+// with the caller's credentials.
+func organizationAccounts(a *app, role string) ([]accountRole, error) {
+	caller, err := a.fetcher.CallerArn(a.ctx)
+	if err != nil {
+		return nil, a.describe(err)
+	}
+	parsed, err := awsarn.Parse(caller)
+	if err != nil {
+		return nil, fmt.Errorf("parsing caller arn: %w", err)
+	}
+
+	accounts := []accountRole{}
+	pages := organizations.NewListAccountsPaginator(organizations.NewFromConfig(a.cfg), &organizations.ListAccountsInput{})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(a.ctx)
+		var notInUse *orgtypes.AWSOrganizationsNotInUseException
+		if errors.As(err, &notInUse) {
+			return nil, errors.New("--org: the account is not in an organization")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("listing organization accounts, which needs the management account or a delegated administrator: %w", a.describe(err))
+		}
+		for _, account := range page.Accounts {
+			if account.Status != orgtypes.AccountStatusActive {
+				continue
+			}
+			id := aws.ToString(account.Id)
+			if id == parsed.AccountID {
+				accounts = append(accounts, accountRole{account: id})
+				continue
+			}
+			accounts = append(accounts, accountRole{account: id, role: role})
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].account < accounts[j].account })
+	return accounts, nil
+}
+
+// forAccount returns an app calling account through its role, or with the
+// credentials of a when it has none, sharing the context of a.
+func (a *app) forAccount(account accountRole) (*app, error) {
+	cfg := a.cfg.Copy()
+	if account.role != "" {
+		role := account.role
+		if !strings.HasPrefix(role, "arn:") {
+			role = fmt.Sprintf("arn:%s:iam::%s:role/%s", a.partition(), account.account, role)
+		}
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(a.cfg, a.opts.pinSTS), role, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "iam-show"
+			if account.externalID != "" {
+				o.ExternalID = aws.String(account.externalID)
+			}
+		}))
+	}
+	fetcher, err := a.opts.newFetcher(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &app{opts: a.opts, ctx: a.ctx, cancel: func() {}, cfg: cfg, fetcher: fetcher, account: account.account}, nil
+}
+
+// fetchAccounts fetches targets in up to limit accounts of apps at once.
+// Arns are only fetched in their own account, AWS managed policies, which
+// are the same in every account, in the first, and names in each account
+// that has them: a name no account has is the only one reported missing.
+func fetchAccounts(ctx context.Context, apps []*app, progress *Progress, targets []string, limit int) []principalResult {
+	known := map[string]bool{}
+	for _, a := range apps {
+		known[a.account] = true
+	}
+	perAccount := make([][]principalResult, len(apps))
+	unknown := []principalResult{}
+	for _, target := range targets {
+		if parsed, err := awsarn.Parse(target); err == nil && !known[parsed.AccountID] && !isAWSManagedPolicy(target) {
+			unknown = append(unknown, principalResult{arn: target, err: fmt.Errorf("account %s is not one of the accounts scanned", parsed.AccountID)})
+		}
+	}
+
+	var mu sync.Mutex
+	found := map[string]bool{}
+	var g errgroup.Group
+	g.SetLimit(limit)
+	for i, a := range apps {
+		i, a := i, a
+		g.Go(func() error {
+			accountTargets := []string{}
+			for _, target := range targets {
+				if parsed, err := awsarn.Parse(target); err != nil || parsed.AccountID == a.account || i == 0 && isAWSManagedPolicy(target) {
+					accountTargets = append(accountTargets, target)
+				}
+			}
+			a.fetcher.progress = progress
+			accountResults := []principalResult{}
+			for j, result := range fetchAll(ctx, a.fetcher, accountTargets) {
+				var notFound *nameNotFoundError
+				if errors.As(result.err, &notFound) {
+					continue
+				}
+				mu.Lock()
+				found[accountTargets[j]] = true
+				mu.Unlock()
+				if result.err != nil {
+					result.err = fmt.Errorf("account %s: %w", a.account, result.err)
+				}
+				accountResults = append(accountResults, result)
+			}
+			perAccount[i] = accountResults
+			return nil
+		})
+	}
+	g.Wait()
+
+	results := []principalResult{}
+	for _, accountResults := range perAccount {
+		results = append(results, accountResults...)
+	}
+	for _, target := range targets {
+		if !strings.HasPrefix(target, "arn:") && !found[target] {
+			unknown = append(unknown, principalResult{arn: target, err: fmt.Errorf("no role, user or customer managed policy named %s in any of the %d accounts scanned", target, len(apps))})
+		}
+	}
+	return append(results, unknown...)
+}
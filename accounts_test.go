@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFetchAccounts(t *testing.T) {
+	apps := []*app{}
+	for _, account := range []string{"111111111111", "222222222222"} {
+		client := newFakeIAM()
+		client.account = account
+		apps = append(apps, &app{opts: &globalOptions{noProgress: true}, ctx: context.Background(), account: account, fetcher: newTestFetcher(client)})
+	}
+	targets := []string{
+		"arn:aws:iam::aws:policy/ReadOnlyAccess",
+		"arn:aws:iam::333333333333:role/app",
+		"app",
+		"nobody",
+	}
+	results := fetchAccounts(context.Background(), apps, nil, targets, 2)
+
+	got := []string{}
+	for _, result := range results {
+		line := result.arn
+		if result.err != nil {
+			line += ": " + result.err.Error()
+		}
+		got = append(got, line)
+	}
+	want := []string{
+		"arn:aws:iam::aws:policy/ReadOnlyAccess",
+		"arn:aws:iam::111111111111:role/app",
+		"arn:aws:iam::222222222222:role/app",
+		"arn:aws:iam::333333333333:role/app: account 333333333333 is not one of the accounts scanned",
+		"nobody: no role, user or customer managed policy named nobody in any of the 2 accounts scanned",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("fetched\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
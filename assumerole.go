@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// assumeRoleHop is a role --assume-role assumes, with the settings of its
+// session.
+type assumeRoleHop struct {
+	role        string
+	externalID  string
+	sessionName string
+	duration    time.Duration
+}
+
+// parseAssumeRole parses an --assume-role value: a role arn, optionally
+// followed by comma separated settings of the session, such as
+// arn:aws:iam::111111111111:role/audit,external-id=7f3c,session-name=alice,duration=30m.
+func parseAssumeRole(value string) (assumeRoleHop, error) {
+	fields := strings.Split(value, ",")
+	hop := assumeRoleHop{role: fields[0], sessionName: "iam-show"}
+	parsed, err := awsarn.Parse(hop.role)
+	if err != nil || !strings.HasPrefix(parsed.Resource, "role/") {
+		return assumeRoleHop{}, fmt.Errorf("--assume-role %q does not start with a role arn", value)
+	}
+	for _, field := range fields[1:] {
+		key, v, ok := strings.Cut(field, "=")
+		if !ok || v == "" {
+			return assumeRoleHop{}, fmt.Errorf("--assume-role %s: %q is not a key=value setting", hop.role, field)
+		}
+		switch key {
+		case "external-id":
+			hop.externalID = v
+		case "session-name":
+			hop.sessionName = v
+		case "duration":
+			if hop.duration, err = time.ParseDuration(v); err != nil {
+				return assumeRoleHop{}, fmt.Errorf("--assume-role %s: duration: %w", hop.role, err)
+			}
+		default:
+			return assumeRoleHop{}, fmt.Errorf("--assume-role %s: unknown setting %q, expected external-id, session-name or duration", hop.role, key)
+		}
+	}
+	return hop, nil
+}
+
+// assumeRoles replaces the credentials of cfg with those of the last of
+// hops, each assumed with the credentials of the one before it. optFns
+// configure the STS clients assuming them.
+func assumeRoles(cfg aws.Config, hops []assumeRoleHop, optFns ...func(*sts.Options)) aws.Config {
+	for i, hop := range hops {
+		hop := hop
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg, optFns...), hop.role, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = hop.sessionName
+			if hop.externalID != "" {
+				o.ExternalID = aws.String(hop.externalID)
+			}
+			if hop.duration > 0 {
+				o.Duration = hop.duration
+			}
+		})
+		cfg = cfg.Copy()
+		cfg.Credentials = aws.NewCredentialsCache(&hopProvider{provider: provider, role: hop.role, hop: i + 1, hops: len(hops)})
+	}
+	return cfg
+}
+
+// hopProvider says which --assume-role could not be assumed, since the
+// STS errors of each hop look the same.
+type hopProvider struct {
+	provider  aws.CredentialsProvider
+	role      string
+	hop, hops int
+}
+
+func (p *hopProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := p.provider.Retrieve(ctx)
+	if err != nil {
+		return creds, fmt.Errorf("assuming %s (--assume-role %d of %d): %w", p.role, p.hop, p.hops, err)
+	}
+	return creds, nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The catalog is a hand maintained subset of the IAM service authorization
+// reference, one file per service prefix.
+//
+//go:embed catalog/*.json
+var catalogFiles embed.FS
+
+type ServiceCatalog struct {
+	Prefix        string                `json:"prefix"`
+	Name          string                `json:"name"`
+	Docs          string                `json:"docs"`
+	ResourceTypes []CatalogResourceType `json:"resourceTypes"`
+	ConditionKeys []CatalogConditionKey `json:"conditionKeys"`
+	Actions       []CatalogAction       `json:"actions"`
+}
+
+// CatalogConditionKey is a condition key a service defines, which may be a
+// pattern such as s3:ExistingObjectTag/*. Keys without actions apply to
+// every action of the service.
+type CatalogConditionKey struct {
+	Name    string   `json:"name"`
+	Actions []string `json:"actions,omitempty"`
+}
+
+// CatalogResourceType is a kind of resource a service defines, with the
+// format of its arns, such as arn:${Partition}:s3:::${BucketName}.
+type CatalogResourceType struct {
+	Name string `json:"name"`
+	Arn  string `json:"arn"`
+}
+
+// CatalogAction is an action and the resource types it can be scoped to.
+// Actions without resource types only work with Resource "*". Deprecated
+// is set for actions AWS has deprecated or retired, saying which and what
+// to use instead.
+type CatalogAction struct {
+	Name        string   `json:"name"`
+	AccessLevel string   `json:"accessLevel"`
+	Resources   []string `json:"resources,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Deprecated  string   `json:"deprecated,omitempty"`
+}
+
+var (
+	catalogOnce     sync.Once
+	catalogServices map[string]*ServiceCatalog
+	catalogErr      error
+)
+
+func loadCatalog() (map[string]*ServiceCatalog, error) {
+	catalogOnce.Do(func() {
+		catalogServices = map[string]*ServiceCatalog{}
+		entries, err := catalogFiles.ReadDir("catalog")
+		if err != nil {
+			catalogErr = fmt.Errorf("reading catalog: %w", err)
+			return
+		}
+		for _, entry := range entries {
+			data, err := catalogFiles.ReadFile(path.Join("catalog", entry.Name()))
+			if err != nil {
+				catalogErr = fmt.Errorf("reading catalog %s: %w", entry.Name(), err)
+				return
+			}
+			var service ServiceCatalog
+			if err := json.Unmarshal(data, &service); err != nil {
+				catalogErr = fmt.Errorf("decoding catalog %s: %w", entry.Name(), err)
+				return
+			}
+			catalogServices[service.Prefix] = &service
+		}
+	})
+	return catalogServices, catalogErr
+}
+
+// catalogService returns the catalog entry for a service prefix such as s3.
+func catalogService(prefix string) (*ServiceCatalog, bool) {
+	services, err := loadCatalog()
+	if err != nil {
+		logger.Warn("could not load action catalog", "error", err)
+		return nil, false
+	}
+	service, ok := services[strings.ToLower(prefix)]
+	return service, ok
+}
+
+// catalogAction looks up a single, non wildcard action.
+func catalogAction(action Action) (CatalogAction, bool) {
+	prefix, name, found := strings.Cut(string(action), ":")
+	if !found {
+		return CatalogAction{}, false
+	}
+	service, ok := catalogService(prefix)
+	if !ok {
+		return CatalogAction{}, false
+	}
+	for _, a := range service.Actions {
+		if strings.EqualFold(a.Name, name) {
+			return a, true
+		}
+	}
+	return CatalogAction{}, false
+}
+
+// deprecatedAction says, to follow the action, why it is deprecated or
+// retired, or returns "" when it is not. A wildcard is only deprecated when every action
+// it matches is.
+func deprecatedAction(action Action) string {
+	if !strings.ContainsAny(string(action), "*?") {
+		if a, _ := catalogAction(action); a.Deprecated != "" {
+			return "is " + a.Deprecated
+		}
+		return ""
+	}
+	expanded := ExpandAction(action)
+	if len(expanded) == 1 && expanded[0] == action {
+		return ""
+	}
+	for _, e := range expanded {
+		if deprecatedAction(e) == "" {
+			return ""
+		}
+	}
+	return "only matches deprecated or retired actions: " + joinActions(expanded)
+}
+
+// unknownAction says, to follow the action, why it is not an action of a
+// service in the catalog, with the closest action when one is near enough
+// to be a typo, or returns "" when it is known. Services missing from the
+// catalog are never unknown.
+func unknownAction(action Action) string {
+	if action == "*" {
+		return ""
+	}
+	prefix, name, found := strings.Cut(string(action), ":")
+	if !found {
+		return "is not an action, which look like service:action"
+	}
+	service, ok := catalogService(prefix)
+	if !ok {
+		return ""
+	}
+	if strings.ContainsAny(name, "*?") {
+		if expanded := ExpandAction(action); len(expanded) == 1 && expanded[0] == action {
+			return "matches no action of " + service.Name
+		}
+		return ""
+	}
+	if _, ok := catalogAction(action); ok {
+		return ""
+	}
+	problem := "is not an action of " + service.Name
+	closest, distance := "", len(name)
+	for _, a := range service.Actions {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(a.Name)); d < distance {
+			closest, distance = a.Name, d
+		}
+	}
+	if closest != "" && distance <= 2+len(name)/10 {
+		problem += ", did you mean " + service.Prefix + ":" + closest + "?"
+	}
+	return problem
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+const serviceAuthorizationReference = "https://docs.aws.amazon.com/service-authorization/latest/reference/"
+
+// actionDocURL links to the service authorization reference entry of an
+// action, or of its service for wildcards, and to the index of services
+// missing from the catalog.
+func actionDocURL(action Action) string {
+	prefix, _, _ := strings.Cut(string(action), ":")
+	service, ok := catalogService(prefix)
+	if !ok || service.Docs == "" {
+		return serviceAuthorizationReference + "reference_policies_actions-resources-contextkeys.html"
+	}
+	page := serviceAuthorizationReference + "list_" + service.Docs + ".html"
+	if a, ok := catalogAction(action); ok {
+		return page + "#" + service.Docs + "-" + a.Name
+	}
+	return page
+}
+
+// resourcePatterns returns the arn formats of the resource types an action
+// can be scoped to as wildcard patterns, with every ${Variable} replaced by
+// *. ok is false when the action is not in the catalog.
+func resourcePatterns(action Action) (patterns []string, ok bool) {
+	a, ok := catalogAction(action)
+	if !ok {
+		return nil, false
+	}
+	prefix, _, _ := strings.Cut(string(action), ":")
+	service, _ := catalogService(prefix)
+	for _, name := range a.Resources {
+		for _, t := range service.ResourceTypes {
+			if t.Name == name {
+				patterns = append(patterns, arnVariable.ReplaceAllString(t.Arn, "*"))
+			}
+		}
+	}
+	return patterns, true
+}
+
+var arnVariable = regexp.MustCompile(`\$\{[^}]*\}`)
+
+// ExpandAction returns the catalog actions matched by a wildcard action such
+// as s3:Get*. Actions without wildcards, for services missing from the
+// catalog or with a wildcard service prefix are returned unchanged.
+func ExpandAction(action Action) []Action {
+	if !strings.ContainsAny(string(action), "*?") {
+		return []Action{action}
+	}
+	prefix, pattern, found := strings.Cut(string(action), ":")
+	if !found {
+		return []Action{action}
+	}
+	service, ok := catalogService(prefix)
+	if !ok {
+		return []Action{action}
+	}
+
+	expanded := []Action{}
+	for _, a := range service.Actions {
+		if wildcardMatch(pattern, a.Name) {
+			expanded = append(expanded, Action(service.Prefix+":"+a.Name))
+		}
+	}
+	if len(expanded) == 0 {
+		return []Action{action}
+	}
+	sort.Slice(expanded, func(i, j int) bool { return expanded[i] < expanded[j] })
+	return expanded
+}
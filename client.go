@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultMaxRetries = 10
+	maxRetryBackoff   = 20 * time.Second
+)
+
+// newRetryer returns a retryer that backs off exponentially with jitter and
+// adapts its send rate when IAM starts throttling requests.
+func newRetryer(maxRetries int) func() aws.Retryer {
+	return func() aws.Retryer {
+		return retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, func(so *retry.StandardOptions) {
+				so.MaxAttempts = maxRetries + 1
+				so.MaxBackoff = maxRetryBackoff
+				so.Backoff = retry.NewExponentialJitterBackoff(maxRetryBackoff)
+			})
+		})
+	}
+}
+
+// logAPICalls adds a middleware that logs every API call with its duration
+// and, at debug level, its parameters and retry attempts.
+func logAPICalls(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("IamShowLogAPICalls", func(
+		ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+	) (middleware.InitializeOutput, middleware.Metadata, error) {
+		start := time.Now()
+		out, metadata, err := next.HandleInitialize(ctx, in)
+
+		kv := []interface{}{
+			"op", awsmiddleware.GetServiceID(ctx) + "." + awsmiddleware.GetOperationName(ctx),
+			"duration", time.Since(start).Round(time.Millisecond),
+		}
+		if results, ok := retry.GetAttemptResults(metadata); ok {
+			kv = append(kv, "attempts", len(results.Results))
+		}
+		if logger.Enabled(levelDebug) {
+			if params, err := json.Marshal(in.Parameters); err == nil {
+				kv = append(kv, "params", string(params))
+			}
+		}
+		if err != nil {
+			kv = append(kv, "error", err)
+		}
+		logger.Info("aws api call", kv...)
+
+		return out, metadata, err
+	}), middleware.After)
+}
+
+// callTimeout adds a middleware that bounds every API call, including its
+// retries, by timeout.
+func callTimeout(timeout time.Duration) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("IamShowCallTimeout", func(
+			ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+		) (middleware.InitializeOutput, middleware.Metadata, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next.HandleInitialize(ctx, in)
+		}), middleware.Before)
+	}
+}
+
+// rateLimit adds a middleware that holds IAM calls back to rps a second,
+// with bursts of up to burst calls. Every attempt counts, retries included,
+// since IAM throttles them all.
+func rateLimit(rps float64, burst int) func(*middleware.Stack) error {
+	limiter := rate.NewLimiter(rate.Limit(rps), burst)
+	return func(stack *middleware.Stack) error {
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("IamShowRateLimit", func(
+			ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+		) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			if awsmiddleware.GetServiceID(ctx) == "IAM" {
+				if err := limiter.Wait(ctx); err != nil {
+					return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+				}
+			}
+			return next.HandleFinalize(ctx, in)
+		}), middleware.After)
+	}
+}
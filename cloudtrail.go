@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+)
+
+// lookupEventsRetention is how far back LookupEvents can see.
+const lookupEventsRetention = 90 * 24 * time.Hour
+
+// trailQuery describes which CloudTrail events count as use of a principal's
+// permissions.
+type trailQuery struct {
+	principal      string
+	since          time.Time
+	regions        []string
+	eventDataStore string
+}
+
+// trailEvent is the part of a CloudTrail record needed to tell who made a
+// call and what it was.
+type trailEvent struct {
+	EventSource  string `json:"eventSource"`
+	EventName    string `json:"eventName"`
+	UserIdentity struct {
+		Arn            string `json:"arn"`
+		SessionContext struct {
+			SessionIssuer struct {
+				Arn string `json:"arn"`
+			} `json:"sessionIssuer"`
+		} `json:"sessionContext"`
+	} `json:"userIdentity"`
+}
+
+// madeBy reports whether the event was made by principal, or by a session of
+// it when principal is a role.
+func (e trailEvent) madeBy(principal string) bool {
+	return e.UserIdentity.Arn == principal || e.UserIdentity.SessionContext.SessionIssuer.Arn == principal
+}
+
+// trailServicePrefixes maps event sources whose name differs from the IAM
+// service prefix.
+var trailServicePrefixes = map[string]string{
+	"monitoring": "cloudwatch",
+	"email":      "ses",
+}
+
+// apiVersionSuffix matches the API version some services, such as Lambda,
+// append to event names.
+var apiVersionSuffix = regexp.MustCompile(`20\d{6}(v\d+)?$`)
+
+// trailAction turns an event source and name into the IAM action that
+// authorized the call.
+func trailAction(source, name string) Action {
+	prefix := strings.TrimSuffix(source, ".amazonaws.com")
+	if mapped, ok := trailServicePrefixes[prefix]; ok {
+		prefix = mapped
+	}
+	return Action(prefix + ":" + apiVersionSuffix.ReplaceAllString(name, ""))
+}
+
+// usedActions returns the distinct actions the principal performed since
+// q.since, sorted. Only management events are recorded by LookupEvents;
+// data events such as s3:GetObject need a CloudTrail Lake event data store.
+func usedActions(ctx context.Context, cfg aws.Config, q trailQuery) ([]Action, error) {
+	used := map[Action]bool{}
+	var err error
+	if q.eventDataStore != "" {
+		err = queryEventDataStore(ctx, cfg, q, used)
+	} else {
+		err = lookupEvents(ctx, cfg, q, used)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []Action{}
+	for action := range used {
+		actions = append(actions, action)
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return strings.ToLower(string(actions[i])) < strings.ToLower(string(actions[j]))
+	})
+	return actions, nil
+}
+
+func lookupEvents(ctx context.Context, cfg aws.Config, q trailQuery, used map[Action]bool) error {
+	input := &cloudtrail.LookupEventsInput{StartTime: aws.Time(q.since)}
+	if strings.Contains(q.principal, ":user/") {
+		// roles can only be filtered by session name, so their events are
+		// matched below instead
+		input.LookupAttributes = []types.LookupAttribute{{
+			AttributeKey:   types.LookupAttributeKeyUsername,
+			AttributeValue: aws.String(shortPrincipal(q.principal)),
+		}}
+	}
+
+	for _, region := range q.regions {
+		client := cloudtrail.NewFromConfig(cfg, func(o *cloudtrail.Options) { o.Region = region })
+		paginator := cloudtrail.NewLookupEventsPaginator(client, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return fmt.Errorf("looking up CloudTrail events in %s: %w", region, err)
+			}
+			for _, e := range page.Events {
+				var event trailEvent
+				if err := json.Unmarshal([]byte(aws.ToString(e.CloudTrailEvent)), &event); err != nil {
+					logger.Debug("could not decode CloudTrail event", "id", aws.ToString(e.EventId), "error", err)
+					continue
+				}
+				if event.madeBy(q.principal) {
+					used[trailAction(event.EventSource, event.EventName)] = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// queryEventDataStore runs a CloudTrail Lake query, which also covers
+// data events and history beyond 90 days.
+func queryEventDataStore(ctx context.Context, cfg aws.Config, q trailQuery, used map[Action]bool) error {
+	client := cloudtrail.NewFromConfig(cfg, func(o *cloudtrail.Options) {
+		if region := arnRegion(q.eventDataStore); region != "" {
+			o.Region = region
+		}
+	})
+	id := q.eventDataStore[strings.LastIndex(q.eventDataStore, "/")+1:]
+	statement := fmt.Sprintf(
+		"SELECT DISTINCT eventSource, eventName FROM %s WHERE eventTime > '%s' AND (userIdentity.arn = '%s' OR userIdentity.sessionContext.sessionIssuer.arn = '%s')",
+		id, q.since.UTC().Format("2006-01-02 15:04:05"), q.principal, q.principal,
+	)
+	started, err := client.StartQuery(ctx, &cloudtrail.StartQueryInput{QueryStatement: aws.String(statement)})
+	if err != nil {
+		return fmt.Errorf("starting CloudTrail Lake query: %w", err)
+	}
+
+	input := &cloudtrail.GetQueryResultsInput{EventDataStore: aws.String(q.eventDataStore), QueryId: started.QueryId}
+	for {
+		res, err := client.GetQueryResults(ctx, input)
+		if err != nil {
+			return fmt.Errorf("getting CloudTrail Lake query results: %w", err)
+		}
+		switch res.QueryStatus {
+		case types.QueryStatusQueued, types.QueryStatusRunning:
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(2 * time.Second):
+			}
+			continue
+		case types.QueryStatusFinished:
+		default:
+			return fmt.Errorf("CloudTrail Lake query %s: %s", strings.ToLower(string(res.QueryStatus)), aws.ToString(res.ErrorMessage))
+		}
+
+		for _, row := range res.QueryResultRows {
+			var source, name string
+			for _, column := range row {
+				if v, ok := column["eventSource"]; ok {
+					source = v
+				}
+				if v, ok := column["eventName"]; ok {
+					name = v
+				}
+			}
+			used[trailAction(source, name)] = true
+		}
+		if res.NextToken == nil {
+			return nil
+		}
+		input.NextToken = res.NextToken
+	}
+}
+
+// generatedStatements builds one Allow statement per service covering
+// exactly the given actions on every resource.
+func generatedStatements(actions []Action) []Statement {
+	statements := []Statement{}
+	byService := map[string]int{}
+	for _, action := range actions {
+		service, _, _ := strings.Cut(string(action), ":")
+		i, ok := byService[service]
+		if !ok {
+			i = len(statements)
+			byService[service] = i
+			statements = append(statements, Statement{Effect: "Allow", Resource: DynamicResource{Resources: []string{"*"}}})
+		}
+		statements[i].Action.Actions = append(statements[i].Action.Actions, action)
+	}
+	return statements
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/spf13/cobra"
+)
+
+const completionCacheTTL = 10 * time.Minute
+
+func (f *Fetcher) ListLocalPolicies(ctx context.Context) ([]Candidate, error) {
+	candidates := []Candidate{}
+
+	policies := iam.NewListPoliciesPaginator(f.client, &iam.ListPoliciesInput{
+		Scope: types.PolicyScopeTypeLocal,
+	})
+	for policies.HasMorePages() {
+		page, err := policies.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing policies: %w", err)
+		}
+		for _, policy := range page.Policies {
+			candidates = append(candidates, Candidate{Kind: "policy", Name: *policy.PolicyName, Arn: *policy.Arn})
+		}
+	}
+
+	return candidates, nil
+}
+
+// completionCandidates lists the roles, users and customer managed policies
+// visible to the current credentials, caching the list briefly so that
+// repeated tab presses stay fast.
+func completionCandidates(ctx context.Context, global *globalOptions) ([]Candidate, error) {
+	cacheDir, err := defaultCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	cache := NewCache(cacheDir, completionCacheTTL, global.refresh)
+	cacheKey := completionCacheKey(global)
+
+	candidates := []Candidate{}
+	if data, ok := cache.Get(cacheKey); ok {
+		if err := json.Unmarshal(data, &candidates); err == nil {
+			return candidates, nil
+		}
+	}
+
+	global.noProgress = true
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer a.cancel()
+
+	principals, err := a.fetcher.ListPrincipals(a.ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	policies, err := a.fetcher.ListLocalPolicies(a.ctx)
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(principals, policies...)
+
+	if data, err := json.Marshal(candidates); err == nil {
+		cache.Put(cacheKey, data)
+	}
+	return candidates, nil
+}
+
+// completionCacheKey identifies the credentials and options the candidates
+// are listed with, so that another profile, access key, role, partition or
+// source does not complete the names of the account listed before. Names
+// are only listed in the account of the credentials, whatever --accounts
+// says.
+func completionCacheKey(global *globalOptions) string {
+	parts := []string{
+		"completion",
+		awsProfile(),
+		os.Getenv("AWS_ACCESS_KEY_ID"),
+		os.Getenv("AWS_REGION"),
+		global.partition,
+		global.source,
+		global.aggregator,
+		global.replay,
+	}
+	return strings.Join(append(parts, global.assumeRoles...), "\n")
+}
+
+// completeTargets completes role, user and policy names, or their arns when
+// the word being completed starts with "arn:".
+func completeTargets(global *globalOptions) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		candidates, err := completionCandidates(cmd.Context(), global)
+		if err != nil {
+			cobra.CompDebugln(err.Error(), true)
+			return nil, cobra.ShellCompDirectiveError
+		}
+
+		completions := []string{}
+		for _, candidate := range candidates {
+			value := candidate.Name
+			if strings.HasPrefix(toComplete, "arn:") {
+				value = candidate.Arn
+			}
+			if strings.HasPrefix(value, toComplete) {
+				completions = append(completions, value+"\t"+candidate.Kind)
+			}
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// registerTargetCompletion sets up dynamic completion for a command that
+// takes arns or names as arguments and through --arn.
+func registerTargetCompletion(cmd *cobra.Command, global *globalOptions) {
+	cmd.ValidArgsFunction = completeTargets(global)
+	cmd.RegisterFlagCompletionFunc("arn", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if !strings.HasPrefix(toComplete, "arn:") {
+			toComplete = "arn:" + strings.TrimPrefix(toComplete, "arn")
+		}
+		return completeTargets(global)(cmd, args, toComplete)
+	})
+}
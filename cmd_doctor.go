@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCommand(global *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the credentials, identity, IAM permissions and endpoints iam-show runs with",
+		Long: "Print where the credentials came from, who they belong to, the region and endpoints IAM and STS\n" +
+			"are called at, and try each IAM read call show needs on the caller's own role or user, to find out\n" +
+			"why iam-show fails with AccessDenied. Exits with code 1 when the credentials cannot be retrieved or\n" +
+			"a call is denied.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(cmd.Context(), global)
+		},
+	}
+}
+
+func runDoctor(ctx context.Context, global *globalOptions) error {
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+
+	bold := color.New(color.Bold).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	profile, region, regionFrom := configuredProfile(a.cfg)
+
+	fmt.Fprintf(w, "%s\n", bold("==> configuration <=="))
+	fmt.Fprintf(w, "profile\t%s\n", profile)
+	if region == "" {
+		fmt.Fprintf(w, "region\t%s\n", faint("none configured"))
+	} else {
+		fmt.Fprintf(w, "region\t%s, from %s\n", region, regionFrom)
+	}
+	fmt.Fprintf(w, "partition\t%s, with IAM and STS called in %s\n", a.partition(), global.iamRegion)
+	fips, dualStack := aws.FIPSEndpointStateUnset, aws.DualStackEndpointStateUnset
+	if global.fips {
+		fips = aws.FIPSEndpointStateEnabled
+	}
+	if global.dualStack {
+		dualStack = aws.DualStackEndpointStateEnabled
+	}
+	iamEndpoints := iam.EndpointResolverOptions{UseFIPSEndpoint: fips, UseDualStackEndpoint: dualStack}
+	if endpoint, err := iam.NewDefaultEndpointResolver().ResolveEndpoint(global.iamRegion, iamEndpoints); err == nil {
+		fmt.Fprintf(w, "iam endpoint\t%s\n", endpoint.URL)
+	}
+	stsEndpoints := sts.EndpointResolverOptions{UseFIPSEndpoint: fips, UseDualStackEndpoint: dualStack}
+	if endpoint, err := sts.NewDefaultEndpointResolver().ResolveEndpoint(global.iamRegion, stsEndpoints); err == nil {
+		fmt.Fprintf(w, "sts endpoint\t%s\n", endpoint.URL)
+	}
+
+	fmt.Fprintf(w, "%s\n", bold("==> credentials <=="))
+	if a.cfg.Credentials == nil {
+		fmt.Fprintf(w, "source\t%s\n", red("none found"))
+		w.Flush()
+		return &exitCodeError{code: exitFailed, msg: "no credentials found: set AWS_PROFILE, the AWS_ACCESS_KEY_ID environment variables or run on a machine with an instance role"}
+	}
+	creds, err := a.cfg.Credentials.Retrieve(a.ctx)
+	if err != nil {
+		fmt.Fprintf(w, "source\t%s\n", red("could not be retrieved"))
+		w.Flush()
+		return fmt.Errorf("retrieving credentials: %w", a.describe(err))
+	}
+	if len(global.assumeRoles) > 0 {
+		fmt.Fprintf(w, "source\t%s\n", "--assume-role, from the credentials of profile "+profile)
+		for i, value := range global.assumeRoles {
+			hop, _ := parseAssumeRole(value)
+			fmt.Fprintf(w, "hop %d\t%s\n", i+1, hop.role)
+		}
+	} else {
+		fmt.Fprintf(w, "source\t%s\n", credentialSource(creds.Source, profile))
+	}
+	fmt.Fprintf(w, "access key\t%s\n", creds.AccessKeyID)
+	if creds.CanExpire {
+		fmt.Fprintf(w, "expires\t%s, in %s\n", creds.Expires.Local().Format(time.RFC3339), time.Until(creds.Expires).Round(time.Minute))
+	}
+	identity, err := sts.NewFromConfig(a.cfg, a.opts.pinSTS).GetCallerIdentity(a.ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		fmt.Fprintf(w, "caller\t%s\n", red("unknown"))
+		w.Flush()
+		return fmt.Errorf("getting caller identity: %w", a.describe(err))
+	}
+	callerArn := aws.ToString(identity.Arn)
+	fmt.Fprintf(w, "caller\t%s\n", callerArn)
+	fmt.Fprintf(w, "account\t%s\n", aws.ToString(identity.Account))
+
+	fmt.Fprintf(w, "%s\n", bold("==> permissions <=="))
+	checks := permissionChecks(a.ctx, iam.NewFromConfig(a.cfg, a.opts.pinIAM), callerArn)
+	denied := 0
+	for _, c := range checks {
+		switch {
+		case c.skipped != "":
+			fmt.Fprintf(w, "%s\t%s\n", c.action, faint("not tried: "+c.skipped))
+		case isAccessDenied(c.err):
+			denied++
+			fmt.Fprintf(w, "%s\t%s\n", c.action, red("denied"))
+		case c.err != nil:
+			fmt.Fprintf(w, "%s\t%s\n", c.action, red("failed: "+a.describe(c.err).Error()))
+		default:
+			fmt.Fprintf(w, "%s\t%s\n", c.action, green("allowed"))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if denied > 0 {
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d IAM calls iam-show makes are denied to %s", denied, len(checks), callerArn)}
+	}
+	return nil
+}
+
+// configuredProfile returns the profile cfg was loaded from, and the region
+// configured before --partition picked the one IAM is called in, with where
+// it was set.
+func configuredProfile(cfg aws.Config) (profile, region, from string) {
+	profile = awsProfile()
+	for _, source := range cfg.ConfigSources {
+		switch source := source.(type) {
+		case config.EnvConfig:
+			if source.Region != "" && region == "" {
+				region, from = source.Region, "AWS_REGION"
+			}
+		case config.SharedConfig:
+			if source.Profile != "" {
+				profile = source.Profile
+			}
+			if source.Region != "" && region == "" {
+				region, from = source.Region, "profile "+source.Profile
+			}
+		}
+	}
+	return profile, region, from
+}
+
+// credentialSource describes the provider that resolved the credentials,
+// from the source the SDK records on them.
+func credentialSource(source, profile string) string {
+	switch {
+	case source == config.CredentialsSourceName:
+		return "environment variables AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY"
+	case strings.HasPrefix(source, "SharedConfigCredentials"):
+		return "access key of profile " + profile + " in the shared credentials file"
+	case source == "SSOProvider":
+		return "IAM Identity Center (SSO) session of profile " + profile
+	case source == "AssumeRoleProvider":
+		return "role assumed by profile " + profile
+	case source == "WebIdentityCredentials":
+		return "web identity token of AWS_WEB_IDENTITY_TOKEN_FILE"
+	case source == "ProcessProvider":
+		return "credential_process of profile " + profile
+	case source == "EC2RoleProvider":
+		return "instance role from the EC2 instance metadata service (IMDS)"
+	case source == "CredentialsEndpointProvider":
+		return "container credentials endpoint (ECS or EKS)"
+	case source == "StaticCredentials":
+		return "static credentials of --replay"
+	}
+	return source
+}
+
+// permissionCheck is an IAM call doctor tried, or why it could not.
+type permissionCheck struct {
+	action  string
+	err     error
+	skipped string
+}
+
+// permissionChecks tries the calls show makes for the caller's own role or
+// user, followed by those list and completion make, keeping the first item
+// a call returns to try the calls that read it.
+func permissionChecks(ctx context.Context, client *iam.Client, callerArn string) []permissionCheck {
+	checks := []permissionCheck{}
+	try := func(action string, call func() error) {
+		checks = append(checks, permissionCheck{action: action, err: call()})
+	}
+	skip := func(action, reason string) {
+		checks = append(checks, permissionCheck{action: action, skipped: reason})
+	}
+
+	parsed, _ := awsarn.Parse(callerArn)
+	kind, _, _ := strings.Cut(parsed.Resource, "/")
+	name, _ := principalName(callerArn)
+	inline, attached := "", ""
+	switch kind {
+	case "assumed-role", "role":
+		try("iam:GetRole", func() error {
+			_, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(name)})
+			return err
+		})
+		try("iam:ListRolePolicies", func() error {
+			res, err := client.ListRolePolicies(ctx, &iam.ListRolePoliciesInput{RoleName: aws.String(name)})
+			if err == nil && len(res.PolicyNames) > 0 {
+				inline = res.PolicyNames[0]
+			}
+			return err
+		})
+		if inline == "" {
+			skip("iam:GetRolePolicy", "no inline policy to read")
+		} else {
+			try("iam:GetRolePolicy", func() error {
+				_, err := client.GetRolePolicy(ctx, &iam.GetRolePolicyInput{RoleName: aws.String(name), PolicyName: aws.String(inline)})
+				return err
+			})
+		}
+		try("iam:ListAttachedRolePolicies", func() error {
+			res, err := client.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(name)})
+			if err == nil && len(res.AttachedPolicies) > 0 {
+				attached = aws.ToString(res.AttachedPolicies[0].PolicyArn)
+			}
+			return err
+		})
+	case "user":
+		try("iam:GetUser", func() error {
+			_, err := client.GetUser(ctx, &iam.GetUserInput{UserName: aws.String(name)})
+			return err
+		})
+		try("iam:ListUserPolicies", func() error {
+			res, err := client.ListUserPolicies(ctx, &iam.ListUserPoliciesInput{UserName: aws.String(name)})
+			if err == nil && len(res.PolicyNames) > 0 {
+				inline = res.PolicyNames[0]
+			}
+			return err
+		})
+		if inline == "" {
+			skip("iam:GetUserPolicy", "no inline policy to read")
+		} else {
+			try("iam:GetUserPolicy", func() error {
+				_, err := client.GetUserPolicy(ctx, &iam.GetUserPolicyInput{UserName: aws.String(name), PolicyName: aws.String(inline)})
+				return err
+			})
+		}
+		try("iam:ListAttachedUserPolicies", func() error {
+			res, err := client.ListAttachedUserPolicies(ctx, &iam.ListAttachedUserPoliciesInput{UserName: aws.String(name)})
+			if err == nil && len(res.AttachedPolicies) > 0 {
+				attached = aws.ToString(res.AttachedPolicies[0].PolicyArn)
+			}
+			return err
+		})
+		try("iam:ListGroupsForUser", func() error {
+			_, err := client.ListGroupsForUser(ctx, &iam.ListGroupsForUserInput{UserName: aws.String(name)})
+			return err
+		})
+	default:
+		skip("iam:GetRole", "the caller is not a role or user")
+	}
+
+	if attached == "" {
+		skip("iam:GetPolicy", "no attached policy to read")
+		skip("iam:GetPolicyVersion", "no attached policy to read")
+	} else {
+		version := ""
+		try("iam:GetPolicy", func() error {
+			res, err := client.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: aws.String(attached)})
+			if err == nil {
+				version = aws.ToString(res.Policy.DefaultVersionId)
+			}
+			return err
+		})
+		if version == "" {
+			skip("iam:GetPolicyVersion", "no policy version to read")
+		} else {
+			try("iam:GetPolicyVersion", func() error {
+				_, err := client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{PolicyArn: aws.String(attached), VersionId: aws.String(version)})
+				return err
+			})
+		}
+	}
+	try("iam:ListRoles", func() error {
+		_, err := client.ListRoles(ctx, &iam.ListRolesInput{MaxItems: aws.Int32(1)})
+		return err
+	})
+	try("iam:ListUsers", func() error {
+		_, err := client.ListUsers(ctx, &iam.ListUsersInput{MaxItems: aws.Int32(1)})
+		return err
+	})
+	try("iam:ListPolicies", func() error {
+		_, err := client.ListPolicies(ctx, &iam.ListPoliciesInput{Scope: types.PolicyScopeTypeLocal, MaxItems: aws.Int32(1)})
+		return err
+	})
+	return checks
+}
+
+// isAccessDenied reports whether err is AWS refusing a call to the caller.
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "AccessDenied", "AccessDeniedException", "UnauthorizedOperation":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+type driftOptions struct {
+	baselineDir string
+	arnFile     string
+	tui         bool
+}
+
+func newDriftCommand(global *globalOptions) *cobra.Command {
+	opts := &driftOptions{}
+	cmd := &cobra.Command{
+		Use:   "drift [arn or name...]",
+		Short: "Compare the statements of principals with approved policy files",
+		Long: "Compare the statements of principals with the approved policy documents in --baseline-dir,\n" +
+			"one per principal, named as show -o policy-json --output-dir names them. Exits with code 3\n" +
+			"when any principal has drifted.",
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDrift(cmd.Context(), global, opts, args)
+		},
+	}
+	cmd.Flags().StringVar(&opts.baselineDir, "baseline-dir", "", "directory of approved policy documents, e.g. written by show -o policy-json --output-dir")
+	cmd.Flags().StringVar(&opts.arnFile, "arn-file", "", "read arns or names from a file, one per line")
+	cmd.Flags().BoolVar(&opts.tui, "tui", false, "browse the drifted statements side by side in an interactive terminal UI")
+	registerTargetCompletion(cmd, global)
+	return cmd
+}
+
+func runDrift(ctx context.Context, global *globalOptions, opts *driftOptions, targets []string) error {
+	if opts.baselineDir == "" {
+		return errors.New("drift needs --baseline-dir")
+	}
+	if opts.arnFile != "" {
+		fileTargets, err := readTargets(opts.arnFile)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, fileTargets...)
+	}
+
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+
+	arns, err := resolvePrincipals(a, targets)
+	if err != nil {
+		return err
+	}
+
+	a.startProgress()
+	results := fetchAll(a.ctx, a.fetcher, arns)
+	a.fetcher.progress.Stop()
+
+	failed, drifted := 0, 0
+	sections := []tuiDiffSection{}
+	for _, result := range results {
+		if result.err != nil {
+			// partial statements would be reported as drift
+			logger.Warn("could not check principal", "arn", result.arn, "error", a.describe(result.err))
+			failed++
+			continue
+		}
+		path := filepath.Join(opts.baselineDir, outputFileName(result.arn, "policy-json"))
+		baseline, err := readPolicyFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			logger.Warn("no baseline for principal", "arn", result.arn, "path", path)
+			failed++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		diff := DiffStatements(mergedDocument(baseline).Statement.Statements, mergedDocument(result.statements).Statement.Statements)
+		if diff.Empty() {
+			fmt.Fprintf(os.Stderr, "no drift: %s\n", result.arn)
+			continue
+		}
+		drifted++
+		title := fmt.Sprintf("%s drift from %s", result.arn, path)
+		if opts.tui {
+			sections = append(sections, tuiDiffSection{title: title, diff: diff})
+			continue
+		}
+		presentDrift(os.Stdout, title, diff)
+	}
+	if len(sections) > 0 {
+		if err := runDiffTUI(sections); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d principals could not be checked", failed, len(results))}
+	}
+	if drifted > 0 {
+		return &exitCodeError{code: exitDrift, msg: fmt.Sprintf("%d of %d principals drifted", drifted, len(results))}
+	}
+	return nil
+}
+
+// presentDrift prints a diff like presentDiff, except that statements
+// whose resources or conditions changed are marked ~ and followed by what
+// was approved.
+func presentDrift(w io.Writer, title string, diff StatementDiff) {
+	bold := color.New(color.Bold).SprintFunc()
+	changed, rest := diff.changes()
+	fmt.Fprintf(w, "%s\n", bold("==> "+title+" <=="))
+	presentPrefixed(w, color.New(color.FgGreen).Sprint("+ "), rest.Added)
+	presentPrefixed(w, color.New(color.FgRed).Sprint("- "), rest.Removed)
+	for _, change := range changed {
+		presentPrefixed(w, color.New(color.FgYellow).Sprint("~ "), []Statement{change.after})
+		presentPrefixed(w, color.New(color.Faint).Sprint("  was "), []Statement{change.before})
+	}
+}
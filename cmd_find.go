@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+type findOptions struct {
+	action string
+	list   listOptions
+}
+
+func newFindCommand(global *globalOptions) *cobra.Command {
+	opts := &findOptions{}
+	cmd := &cobra.Command{
+		Use:   "find --action service:action",
+		Short: "List the roles and users whose policies allow an action",
+		Long: "Fetch the statements of every role and user, or those matching --tag, --name and --path-prefix,\n" +
+			"and list those with an Allow statement of the action, with the policies and resources that allow\n" +
+			"it. The action may have wildcards, such as kms:*, to find any of the actions it matches. Actions\n" +
+			"denied on every resource without conditions are not listed; other conditions and denies are\n" +
+			"not evaluated.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runFind(cmd.Context(), global, opts)
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&opts.action, "action", "", "action to look for, such as kms:Decrypt or kms:*")
+	flags.StringSliceVar(&opts.list.tags, "tag", nil, "only look at roles and users with this tag, as key=value or key; repeat to require several")
+	flags.StringVar(&opts.list.pathPrefix, "path-prefix", "", "only look at roles and users under this path, e.g. /service-role/")
+	flags.StringVar(&opts.list.name, "name", "", "only look at roles and users whose name contains this, ignoring case")
+	opts.list.accounts.addFlags(flags)
+	return cmd
+}
+
+func runFind(ctx context.Context, global *globalOptions, opts *findOptions) error {
+	action := Action(opts.action)
+	if action == "" {
+		return fmt.Errorf("find needs --action")
+	}
+	if action != "*" && !actionGrammar.MatchString(string(action)) {
+		return fmt.Errorf("--action %q is not an action, which look like service:action", action)
+	}
+	filters, err := parseTagFilters(opts.list.tags)
+	if err != nil {
+		return err
+	}
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+
+	apps := []*app{a}
+	if opts.list.accounts.enabled() {
+		if apps, err = opts.list.accounts.apps(a); err != nil {
+			return err
+		}
+	}
+	opts.list.accounts.resolveNames(apps)
+	opts.list.summary = true
+	a.startProgress()
+	listed := make([]accountCandidates, len(apps))
+	var g errgroup.Group
+	for i, accountApp := range apps {
+		i, accountApp := i, accountApp
+		g.Go(func() error {
+			listed[i] = listAccount(accountApp, a.fetcher.progress, &opts.list, filters)
+			return nil
+		})
+	}
+	g.Wait()
+	a.fetcher.progress.Stop()
+
+	account := ""
+	if opts.list.accounts.enabled() {
+		account = "ACCOUNT\t"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, account+"KIND\tNAME\tPOLICIES\tRESOURCES\tCONDITIONAL\tARN")
+	failedAccounts, failed, total, found := 0, 0, 0, 0
+	for _, l := range listed {
+		if l.err != nil {
+			if len(apps) == 1 {
+				return a.describe(l.err)
+			}
+			logger.Warn("could not list account", "account", l.app.account, "error", a.describe(l.err))
+			failedAccounts++
+			continue
+		}
+		for i, c := range l.candidates {
+			total++
+			result := l.results[i]
+			if !result.shown() {
+				logger.Warn("could not fetch principal", "arn", c.Arn, "error", a.describe(result.err))
+				failed++
+				continue
+			}
+			granting := grantingStatements(result.statements, action)
+			if len(granting) == 0 {
+				continue
+			}
+			found++
+			policies, resources := grantingSources(granting)
+			conditional := true
+			for _, s := range granting {
+				if len(s.Condition) == 0 {
+					conditional = false
+				}
+			}
+			fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\n", accountColumn(l.app), c.Kind, c.Name, strings.Join(policies, ", "), strings.Join(resources, ", "), yesNo(conditional), arnColumn(l.app, c.Arn))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	switch {
+	case failed > 0:
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d principals could not be fetched", failed, total)}
+	case failedAccounts > 0:
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d accounts could not be listed", failedAccounts, len(apps))}
+	case found == 0:
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("none of %d roles and users allow %s", total, action)}
+	}
+	return nil
+}
+
+// grantingStatements returns the Allow statements with an action pattern
+// matching some of the actions action does, or none when a Deny without
+// conditions of every resource covers action.
+func grantingStatements(statements []Statement, action Action) []Statement {
+	granting := []Statement{}
+	query := strings.ToLower(string(action))
+	for _, s := range statements {
+		if s.Effect == "Deny" && len(s.Condition) == 0 && coversAllResources(s.Resource.Resources, []string{"*"}) && coversAll(s.Action.Actions, []Action{action}) {
+			return nil
+		}
+		if s.Effect != "Allow" {
+			continue
+		}
+		for _, pattern := range s.Action.Actions {
+			if patternsOverlap(strings.ToLower(string(pattern)), query) {
+				granting = append(granting, s)
+				break
+			}
+		}
+	}
+	return granting
+}
+
+// grantingSources returns the distinct policies and resources of statements,
+// sorted, naming the group of group policies.
+func grantingSources(statements []Statement) (policies, resources []string) {
+	seenPolicies, seenResources := map[string]bool{}, map[string]bool{}
+	for _, s := range statements {
+		policy := s.Source.Policy
+		if s.Source.Group != "" {
+			policy += " (group " + s.Source.Group + ")"
+		}
+		if !seenPolicies[policy] {
+			seenPolicies[policy] = true
+			policies = append(policies, policy)
+		}
+		for _, resource := range s.Resource.Resources {
+			if !seenResources[resource] {
+				seenResources[resource] = true
+				resources = append(resources, resource)
+			}
+		}
+	}
+	sort.Strings(policies)
+	sort.Strings(resources)
+	return policies, resources
+}
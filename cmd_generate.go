@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// trailOptions are the flags that select which CloudTrail events are read.
+type trailOptions struct {
+	days           int
+	regions        []string
+	eventDataStore string
+}
+
+func (o *trailOptions) addFlags(flags *pflag.FlagSet) {
+	flags.IntVar(&o.days, "days", 90, "how many days of CloudTrail history to look at")
+	flags.StringSliceVar(&o.regions, "regions", nil, "regions whose CloudTrail event history is read (default us-east-1,us-west-2, or two regions of --partition); global services such as IAM log to the first region of the partition")
+	flags.StringVar(&o.eventDataStore, "event-data-store", "", "query this CloudTrail Lake event data store instead of the event history, which also covers data events")
+}
+
+// validate checks the flags once, before any principal is queried.
+func (o *trailOptions) validate() error {
+	if o.days <= 0 {
+		return errors.New("--days must be positive")
+	}
+	if o.eventDataStore == "" && o.period() > lookupEventsRetention {
+		logger.Warn("CloudTrail event history only covers the last 90 days, use --event-data-store for longer")
+	}
+	return nil
+}
+
+func (o *trailOptions) period() time.Duration {
+	return time.Duration(o.days) * 24 * time.Hour
+}
+
+// query selects the events of principal, in partition when --regions is
+// not given.
+func (o *trailOptions) query(principal, partition string) trailQuery {
+	regions := o.regions
+	if len(regions) == 0 {
+		regions = partitionTrailRegions[partition]
+	}
+	return trailQuery{
+		principal:      principal,
+		since:          time.Now().Add(-o.period()),
+		regions:        regions,
+		eventDataStore: o.eventDataStore,
+	}
+}
+
+func newGenerateCommand(global *globalOptions) *cobra.Command {
+	opts := &trailOptions{}
+	cmd := &cobra.Command{
+		Use:   "generate [arn or name]",
+		Short: "Generate a least privilege policy from the calls a role or user made",
+		Long: "Generate a policy document allowing only the actions a role or user performed according to\n" +
+			"CloudTrail, and print how it differs from what the principal is granted now.\n\n" +
+			"The document goes to stdout and the differences to stderr. Resources are always \"*\", so\n" +
+			"review and narrow them before using the document.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGenerate(cmd.Context(), global, opts, args)
+		},
+	}
+	opts.addFlags(cmd.Flags())
+	registerTargetCompletion(cmd, global)
+	return cmd
+}
+
+func runGenerate(ctx context.Context, global *globalOptions, opts *trailOptions, targets []string) error {
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+
+	arns, err := resolvePrincipals(a, targets)
+	if err != nil {
+		return err
+	}
+	arn := arns[0]
+	if t := a.fetcher.arnType(arn); t != RoleArn && t != UserArn {
+		return fmt.Errorf("%s is not a role or user, only principals make calls", arn)
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	a.startProgress()
+	results := fetchAll(a.ctx, a.fetcher, arns)
+	a.fetcher.progress.Stop()
+	if results[0].err != nil {
+		return fmt.Errorf("%s: %w", arn, a.describe(results[0].err))
+	}
+
+	used, err := usedActions(a.ctx, a.cfg, opts.query(arn, a.partition()))
+	if err != nil {
+		return a.describe(err)
+	}
+	if len(used) == 0 {
+		return fmt.Errorf("no CloudTrail events for %s in the last %d days", arn, opts.days)
+	}
+
+	generated := generatedStatements(used)
+	presenter := newPolicyJSONPresenter(os.Stdout)
+	for _, statement := range generated {
+		presenter.PrintStatement(statement)
+	}
+	if err := presenter.Finish(); err != nil {
+		return err
+	}
+
+	granted := []Statement{}
+	for _, statement := range results[0].statements {
+		if statement.Effect == "Allow" {
+			granted = append(granted, statement)
+		}
+	}
+	diff := DiffStatements(granted, generated)
+	if !diff.Empty() {
+		fmt.Fprintln(os.Stderr)
+		presentDiff(os.Stderr, arn+" granted -> generated", diff)
+	}
+	return nil
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+type listOptions struct {
+	tags       []string
+	summary    bool
+	sort       string
+	pathPrefix string
+	name       string
+	accounts   accountOptions
+	// kind is role or user for list roles and list users, and empty for
+	// both
+	kind string
+}
+
+func newListCommand(global *globalOptions) *cobra.Command {
+	opts := &listOptions{}
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List roles and users, optionally only those with given tags",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runList(cmd.Context(), global, opts)
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringSliceVar(&opts.tags, "tag", nil, "only list roles and users with this tag, as key=value or key; repeat to require several")
+	flags.StringSliceVar(&opts.tags, "tags", nil, "same as --tag")
+	flags.MarkHidden("tags")
+	flags.StringVar(&opts.pathPrefix, "path-prefix", "", "only list roles and users under this path, e.g. /service-role/")
+	flags.StringVar(&opts.name, "name", "", "only list roles and users whose name contains this, ignoring case")
+	flags.BoolVar(&opts.summary, "summary", false, "fetch the statements of each principal and show how many policies and statements it has, by inline, customer and AWS managed policies, and its highest risk")
+	flags.StringVar(&opts.sort, "sort", "", "with --summary, risk lists the principals with the riskiest statements first")
+	opts.accounts.addFlags(flags)
+	cmd.AddCommand(newListRolesCommand(global, opts))
+	cmd.AddCommand(newListUsersCommand(global, opts))
+	cmd.AddCommand(newListPoliciesCommand(global, opts))
+	return cmd
+}
+
+func newListRolesCommand(global *globalOptions, opts *listOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "roles",
+		Short: "List roles; with --summary, also when each was last used and whether it has admin access",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.kind = "role"
+			return runList(cmd.Context(), global, opts)
+		},
+	}
+}
+
+func newListUsersCommand(global *globalOptions, opts *listOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "users",
+		Short: "List users; with --summary, also their groups, attached policies, console access and key age",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.kind = "user"
+			return runList(cmd.Context(), global, opts)
+		},
+	}
+}
+
+func newListPoliciesCommand(global *globalOptions, opts *listOptions) *cobra.Command {
+	scope := ""
+	cmd := &cobra.Command{
+		Use:   "policies",
+		Short: "List managed policies with how many principals each is attached to, flagging those attached to none",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.summary || opts.sort != "" {
+				return fmt.Errorf("--summary and --sort do not apply to list policies")
+			}
+			return runListPolicies(cmd.Context(), global, opts, scope)
+		},
+	}
+	cmd.Flags().StringVar(&scope, "scope", "local", "which managed policies to list: local for customer managed, aws for AWS managed, or all")
+	return cmd
+}
+
+// listColumns are the --summary columns list roles and list users add for
+// their kind of principal, before the arn. load is called once per account
+// and returns what gives the values of each principal.
+type listColumns struct {
+	header []string
+	load   func(a *app) (columnValues, error)
+}
+
+type columnValues func(c Candidate, result principalResult) ([]string, error)
+
+var kindColumns = map[string]listColumns{
+	"role": {header: []string{"LAST USED", "ADMIN"}, load: roleColumns},
+	"user": {header: []string{"GROUPS", "ATTACHED", "CONSOLE", "KEY AGE"}, load: userColumns},
+}
+
+func roleColumns(a *app) (columnValues, error) {
+	now := time.Now()
+	return func(c Candidate, result principalResult) ([]string, error) {
+		lastUsed, err := a.fetcher.RoleLastUsed(a.ctx, c.Name)
+		if err != nil {
+			return nil, err
+		}
+		used := "never"
+		if !lastUsed.IsZero() {
+			used = daysAgo(lastUsed, now)
+		}
+		return []string{used, yesNo(hasAdminAccess(result.statements))}, nil
+	}, nil
+}
+
+// userColumns reads console access and key ages from the credential report
+// of the account, fetched once. They are left unknown when it cannot be.
+func userColumns(a *app) (columnValues, error) {
+	report, err := fetchCredentialReport(a.ctx, a.fetcher.client)
+	if err != nil {
+		logger.Warn("could not get the credential report for console access and key ages", "error", a.describe(err))
+	}
+	now := time.Now()
+	return func(c Candidate, result principalResult) ([]string, error) {
+		groups := 0
+		pages := iam.NewListGroupsForUserPaginator(a.fetcher.client, &iam.ListGroupsForUserInput{UserName: aws.String(c.Name)})
+		for pages.HasMorePages() {
+			page, err := pages.NextPage(a.ctx)
+			if err != nil {
+				return nil, fmt.Errorf("listing groups of user %s: %w", c.Name, err)
+			}
+			groups += len(page.Groups)
+		}
+		attached := map[string]bool{}
+		for _, s := range result.statements {
+			if s.Source.Arn != "" && s.Source.Group == "" {
+				attached[s.Source.Arn] = true
+			}
+		}
+		console, keyAge := "-", "-"
+		if entry, ok := report[c.Arn]; ok {
+			console, keyAge = yesNo(entry.passwordEnabled), oldestKeyAge(entry, now)
+		}
+		return []string{fmt.Sprint(groups), fmt.Sprint(len(attached)), console, keyAge}, nil
+	}, nil
+}
+
+// oldestKeyAge is how long ago the oldest active access key of a user was
+// created or rotated.
+func oldestKeyAge(entry credentialEntry, now time.Time) string {
+	var oldest time.Time
+	for _, key := range entry.keys {
+		rotated, err := time.Parse(time.RFC3339, key.lastRotated)
+		if !key.active || err != nil {
+			continue
+		}
+		if oldest.IsZero() || rotated.Before(oldest) {
+			oldest = rotated
+		}
+	}
+	if oldest.IsZero() {
+		return "no keys"
+	}
+	return fmt.Sprintf("%d days", int(now.Sub(oldest).Hours()/24))
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// hasAdminAccess reports whether statements allow every action, or every
+// action but those of a NotAction, on every resource without conditions, as
+// AdministratorAccess and PowerUserAccess do.
+func hasAdminAccess(statements []Statement) bool {
+	for _, s := range statements {
+		everyAction := len(s.NotAction.Actions) > 0 || len(s.Action.Actions) > 0 && coversAll(s.Action.Actions, []Action{"*"})
+		if s.Effect == "Allow" && len(s.Condition) == 0 && everyAction && coversAllResources(s.Resource.Resources, []string{"*"}) {
+			return true
+		}
+	}
+	return false
+}
+
+// accountCandidates are the roles and users listed in an account.
+type accountCandidates struct {
+	app        *app
+	candidates []Candidate
+	results    []principalResult
+	// columns holds the kindColumns values of each candidate
+	columns [][]string
+	err     error
+}
+
+func runList(ctx context.Context, global *globalOptions, opts *listOptions) error {
+	filters, err := parseTagFilters(opts.tags)
+	if err != nil {
+		return err
+	}
+	if opts.sort != "" && (opts.sort != "risk" || !opts.summary) {
+		return fmt.Errorf("unknown sort order %q, expected risk with --summary", opts.sort)
+	}
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+
+	apps := []*app{a}
+	if opts.accounts.enabled() {
+		if apps, err = opts.accounts.apps(a); err != nil {
+			return err
+		}
+	}
+	opts.accounts.resolveNames(apps)
+	if opts.summary {
+		a.startProgress()
+	}
+	listed := make([]accountCandidates, len(apps))
+	var g errgroup.Group
+	for i, accountApp := range apps {
+		i, accountApp := i, accountApp
+		g.Go(func() error {
+			listed[i] = listAccount(accountApp, a.fetcher.progress, opts, filters)
+			return nil
+		})
+	}
+	g.Wait()
+	a.fetcher.progress.Stop()
+
+	failedAccounts, total := 0, 0
+	for _, l := range listed {
+		if l.err != nil {
+			if len(apps) == 1 {
+				return a.describe(l.err)
+			}
+			logger.Warn("could not list account", "account", l.app.account, "error", a.describe(l.err))
+			failedAccounts++
+		}
+		total += len(l.candidates)
+	}
+	accountsFailed := func() error {
+		if failedAccounts > 0 {
+			return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d accounts could not be listed", failedAccounts, len(apps))}
+		}
+		return nil
+	}
+	if total == 0 && failedAccounts == 0 {
+		return &exitCodeError{code: exitFailed, msg: "no roles or users match"}
+	}
+
+	account := ""
+	if opts.accounts.enabled() {
+		account = "ACCOUNT\t"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if !opts.summary {
+		fmt.Fprintln(w, account+"KIND\tNAME\tARN")
+		for _, l := range listed {
+			for _, c := range l.candidates {
+				fmt.Fprintf(w, "%s%s\t%s\t%s\n", accountColumn(l.app), c.Kind, c.Name, arnColumn(l.app, c.Arn))
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return accountsFailed()
+	}
+
+	failed := 0
+	type row struct {
+		app     *app
+		c       Candidate
+		result  principalResult
+		risk    int
+		columns []string
+	}
+	rows := []row{}
+	for _, l := range listed {
+		for i, c := range l.candidates {
+			highest, _ := principalRisk(l.results[i].statements)
+			rows = append(rows, row{l.app, c, l.results[i], highest.score, l.columns[i]})
+		}
+	}
+	if opts.sort == "risk" {
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].risk > rows[j].risk })
+	}
+	extra := ""
+	for _, header := range kindColumns[opts.kind].header {
+		extra += header + "\t"
+	}
+	fmt.Fprintln(w, account+"KIND\tNAME\tPOLICIES\tSTATEMENTS\tINLINE\tCUSTOMER\tAWS\tRISK\t"+extra+"ARN")
+	for _, r := range rows {
+		if !r.result.shown() {
+			logger.Warn("could not summarize principal", "arn", r.c.Arn, "error", a.describe(r.result.err))
+			fmt.Fprintf(w, "%s%s\t%s\t-\t-\t-\t-\t-\t-\t%s%s\n", accountColumn(r.app), r.c.Kind, r.c.Name, strings.Join(append(r.columns, ""), "\t"), arnColumn(r.app, r.c.Arn))
+			failed++
+			continue
+		}
+		inline, customer, awsManaged := countBySource(r.result.statements)
+		fmt.Fprintf(w, "%s%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s%s\n", accountColumn(r.app), r.c.Kind, r.c.Name, countPolicies(r.result.statements), len(r.result.statements), inline, customer, awsManaged, r.risk, strings.Join(append(r.columns, ""), "\t"), arnColumn(r.app, r.c.Arn))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d principals could not be summarized", failed, total)}
+	}
+	return accountsFailed()
+}
+
+// listAccount lists the roles and users of the account of a matching the
+// options and filters, and fetches their statements and kindColumns when
+// summarizing.
+func listAccount(a *app, progress *Progress, opts *listOptions, filters []tagFilter) accountCandidates {
+	var candidates []Candidate
+	var err error
+	switch opts.kind {
+	case "role":
+		candidates, err = a.fetcher.listRoleCandidates(a.ctx, opts.pathPrefix)
+	case "user":
+		candidates, err = a.fetcher.listUserCandidates(a.ctx, opts.pathPrefix)
+	default:
+		candidates, err = a.fetcher.ListPrincipals(a.ctx, opts.pathPrefix)
+	}
+	if err != nil {
+		return accountCandidates{app: a, err: err}
+	}
+	if opts.name != "" {
+		named := []Candidate{}
+		for _, c := range candidates {
+			if strings.Contains(strings.ToLower(c.Name), strings.ToLower(opts.name)) {
+				named = append(named, c)
+			}
+		}
+		candidates = named
+	}
+	candidates, err = a.fetcher.filterByTags(a.ctx, candidates, filters)
+	if err != nil {
+		return accountCandidates{app: a, err: err}
+	}
+	listed := accountCandidates{app: a, candidates: candidates}
+	if !opts.summary {
+		return listed
+	}
+	arns := []string{}
+	for _, c := range candidates {
+		arns = append(arns, c.Arn)
+	}
+	a.fetcher.progress = progress
+	listed.results = fetchAll(a.ctx, a.fetcher, arns)
+
+	columns := kindColumns[opts.kind]
+	listed.columns = make([][]string, len(candidates))
+	unknown := make([]string, len(columns.header))
+	for i := range unknown {
+		unknown[i] = "-"
+	}
+	var values columnValues
+	if columns.load != nil {
+		if values, err = columns.load(a); err != nil {
+			logger.Warn("could not summarize principals", "columns", strings.Join(columns.header, ", "), "error", a.describe(err))
+		}
+	}
+	var g errgroup.Group
+	g.SetLimit(a.fetcher.concurrencyLimit())
+	for i, c := range candidates {
+		i, c := i, c
+		listed.columns[i] = unknown
+		if values == nil || !listed.results[i].shown() {
+			continue
+		}
+		g.Go(func() error {
+			row, err := values(c, listed.results[i])
+			if err != nil {
+				logger.Warn("could not summarize principal", "arn", c.Arn, "error", a.describe(err))
+				return nil
+			}
+			listed.columns[i] = row
+			return nil
+		})
+	}
+	g.Wait()
+	return listed
+}
+
+// accountColumn is the ACCOUNT cell of a row listed with --accounts.
+func accountColumn(a *app) string {
+	if a.account == "" {
+		return ""
+	}
+	return withAccountName(a.account) + "\t"
+}
+
+// arnColumn is the ARN cell of a row, followed by the account name unless
+// the ACCOUNT cell has it.
+func arnColumn(a *app, arn string) string {
+	if a.account != "" {
+		return arn
+	}
+	return withAccountName(arn)
+}
+
+// countPolicies counts the distinct policies statements came from.
+func countPolicies(statements []Statement) int {
+	type key struct{ group, policy string }
+	seen := map[key]bool{}
+	for _, s := range statements {
+		seen[key{s.Source.Group, s.Source.Policy}] = true
+	}
+	return len(seen)
+}
+
+// countBySource counts the statements that come from inline policies,
+// including those of groups, from customer managed policies and from AWS
+// managed policies.
+func countBySource(statements []Statement) (inline, customer, awsManaged int) {
+	for _, s := range statements {
+		switch {
+		case s.Source.Arn == "":
+			inline++
+		case isAWSManagedPolicy(s.Source.Arn):
+			awsManaged++
+		default:
+			customer++
+		}
+	}
+	return inline, customer, awsManaged
+}
+
+// policyScopes maps the values of list policies --scope to IAM scopes.
+var policyScopes = map[string]types.PolicyScopeType{
+	"local": types.PolicyScopeTypeLocal,
+	"aws":   types.PolicyScopeTypeAws,
+	"all":   types.PolicyScopeTypeAll,
+}
+
+// listedPolicy is a managed policy listed in an account.
+type listedPolicy struct {
+	Candidate
+	attachments int
+	boundaries  int
+}
+
+// orphaned reports whether the customer managed policy is neither attached
+// to a principal nor used as a permissions boundary, so that it could be
+// deleted. AWS managed policies cannot be deleted, so they never are.
+func (p listedPolicy) orphaned() bool {
+	return p.attachments == 0 && p.boundaries == 0 && !isAWSManagedPolicy(p.Arn)
+}
+
+// listManagedPolicies lists the managed policies of scope, or only those
+// whose path starts with pathPrefix when it is set.
+func (f *Fetcher) listManagedPolicies(ctx context.Context, scope types.PolicyScopeType, pathPrefix string) ([]listedPolicy, error) {
+	listed := []listedPolicy{}
+	var prefix *string
+	if pathPrefix != "" {
+		prefix = aws.String(pathPrefix)
+	}
+	pages := iam.NewListPoliciesPaginator(f.client, &iam.ListPoliciesInput{Scope: scope, PathPrefix: prefix})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing policies: %w", err)
+		}
+		for _, policy := range page.Policies {
+			listed = append(listed, listedPolicy{
+				Candidate:   Candidate{Kind: "policy", Name: aws.ToString(policy.PolicyName), Arn: aws.ToString(policy.Arn)},
+				attachments: int(aws.ToInt32(policy.AttachmentCount)),
+				boundaries:  int(aws.ToInt32(policy.PermissionsBoundaryUsageCount)),
+			})
+		}
+	}
+	return listed, nil
+}
+
+// accountPolicies are the managed policies listed in an account.
+type accountPolicies struct {
+	app      *app
+	policies []listedPolicy
+	err      error
+}
+
+func runListPolicies(ctx context.Context, global *globalOptions, opts *listOptions, scopeName string) error {
+	scope, ok := policyScopes[scopeName]
+	if !ok {
+		return fmt.Errorf("unknown scope %q, expected local, aws or all", scopeName)
+	}
+	filters, err := parseTagFilters(opts.tags)
+	if err != nil {
+		return err
+	}
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+
+	apps := []*app{a}
+	if opts.accounts.enabled() {
+		if apps, err = opts.accounts.apps(a); err != nil {
+			return err
+		}
+	}
+	opts.accounts.resolveNames(apps)
+	listed := make([]accountPolicies, len(apps))
+	var g errgroup.Group
+	for i, accountApp := range apps {
+		i, accountApp := i, accountApp
+		g.Go(func() error {
+			listed[i] = listAccountPolicies(accountApp, scope, opts, filters)
+			return nil
+		})
+	}
+	g.Wait()
+
+	failedAccounts, total := 0, 0
+	for _, l := range listed {
+		if l.err != nil {
+			if len(apps) == 1 {
+				return a.describe(l.err)
+			}
+			logger.Warn("could not list account", "account", l.app.account, "error", a.describe(l.err))
+			failedAccounts++
+		}
+		total += len(l.policies)
+	}
+	if total == 0 && failedAccounts == 0 {
+		return &exitCodeError{code: exitFailed, msg: "no policies match"}
+	}
+
+	account := ""
+	if opts.accounts.enabled() {
+		account = "ACCOUNT\t"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, account+"NAME\tATTACHMENTS\tBOUNDARIES\tORPHANED\tARN")
+	orphaned, customer := 0, 0
+	for _, l := range listed {
+		for _, p := range l.policies {
+			if p.orphaned() {
+				orphaned++
+			}
+			if !isAWSManagedPolicy(p.Arn) {
+				customer++
+			}
+			fmt.Fprintf(w, "%s%s\t%d\t%d\t%s\t%s\n", accountColumn(l.app), p.Name, p.attachments, p.boundaries, yesNo(p.orphaned()), arnColumn(l.app, p.Arn))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	faint := color.New(color.Faint).SprintFunc()
+	if customer > 0 {
+		fmt.Fprintln(os.Stderr, faint(fmt.Sprintf("%d of %d customer managed policies are attached to nothing and not used as a permissions boundary, so could be deleted", orphaned, customer)))
+	}
+	if failedAccounts > 0 {
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d accounts could not be listed", failedAccounts, len(apps))}
+	}
+	return nil
+}
+
+// listAccountPolicies lists the managed policies of scope in the account of a
+// matching the options and filters.
+func listAccountPolicies(a *app, scope types.PolicyScopeType, opts *listOptions, filters []tagFilter) accountPolicies {
+	policies, err := a.fetcher.listManagedPolicies(a.ctx, scope, opts.pathPrefix)
+	if err != nil {
+		return accountPolicies{app: a, err: err}
+	}
+	candidates := []Candidate{}
+	byArn := map[string]listedPolicy{}
+	for _, p := range policies {
+		if opts.name != "" && !strings.Contains(strings.ToLower(p.Name), strings.ToLower(opts.name)) {
+			continue
+		}
+		candidates = append(candidates, p.Candidate)
+		byArn[p.Arn] = p
+	}
+	candidates, err = a.fetcher.filterByTags(a.ctx, candidates, filters)
+	if err != nil {
+		return accountPolicies{app: a, err: err}
+	}
+	listed := accountPolicies{app: a}
+	for _, c := range candidates {
+		listed.policies = append(listed.policies, byArn[c.Arn])
+	}
+	return listed
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+type matrixOptions struct {
+	output     string
+	outputFile string
+	list       listOptions
+}
+
+func newMatrixCommand(global *globalOptions) *cobra.Command {
+	opts := &matrixOptions{}
+	cmd := &cobra.Command{
+		Use:   "matrix",
+		Short: "Print a grid of roles and users against the services they can use, as csv or html",
+		Long: "Fetch the statements of every role and user, or those matching --tag, --name and --path-prefix,\n" +
+			"and print a grid of them against every service any of them has actions of. Each cell is the\n" +
+			"most a principal is allowed on the service: none, read for List and Read actions, write for\n" +
+			"Write and Tagging actions, or admin for Permissions management actions or every action of the\n" +
+			"service. Resources and conditions are not taken into account.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMatrix(cmd.Context(), global, opts)
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.output, "output", "o", "csv", "output format: csv or html")
+	flags.StringVar(&opts.outputFile, "output-file", "", "write the matrix to this file instead of stdout")
+	flags.StringSliceVar(&opts.list.tags, "tag", nil, "only include roles and users with this tag, as key=value or key; repeat to require several")
+	flags.StringVar(&opts.list.pathPrefix, "path-prefix", "", "only include roles and users under this path, e.g. /service-role/")
+	flags.StringVar(&opts.list.name, "name", "", "only include roles and users whose name contains this, ignoring case")
+	opts.list.accounts.addFlags(flags)
+	return cmd
+}
+
+func runMatrix(ctx context.Context, global *globalOptions, opts *matrixOptions) error {
+	if opts.output != "csv" && opts.output != "html" {
+		return fmt.Errorf("unknown output format %q, expected csv or html", opts.output)
+	}
+	filters, err := parseTagFilters(opts.list.tags)
+	if err != nil {
+		return err
+	}
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+
+	apps := []*app{a}
+	if opts.list.accounts.enabled() {
+		if apps, err = opts.list.accounts.apps(a); err != nil {
+			return err
+		}
+	}
+	opts.list.accounts.resolveNames(apps)
+	opts.list.summary = true
+	a.startProgress()
+	listed := make([]accountCandidates, len(apps))
+	var g errgroup.Group
+	for i, accountApp := range apps {
+		i, accountApp := i, accountApp
+		g.Go(func() error {
+			listed[i] = listAccount(accountApp, a.fetcher.progress, &opts.list, filters)
+			return nil
+		})
+	}
+	g.Wait()
+	a.fetcher.progress.Stop()
+
+	principals := []principalLevels{}
+	failedAccounts, failed, total := 0, 0, 0
+	for _, l := range listed {
+		if l.err != nil {
+			if len(apps) == 1 {
+				return a.describe(l.err)
+			}
+			logger.Warn("could not list account", "account", l.app.account, "error", a.describe(l.err))
+			failedAccounts++
+			continue
+		}
+		for i, c := range l.candidates {
+			total++
+			result := l.results[i]
+			if !result.shown() {
+				logger.Warn("could not fetch principal", "arn", c.Arn, "error", a.describe(result.err))
+				failed++
+				continue
+			}
+			levels, everything := serviceLevels(result.statements)
+			principals = append(principals, principalLevels{
+				row:        matrixRow{Account: withAccountName(l.app.account), Kind: c.Kind, Name: c.Name, Arn: c.Arn},
+				levels:     levels,
+				everything: everything,
+			})
+		}
+	}
+	if total == 0 && failedAccounts == 0 {
+		return &exitCodeError{code: exitFailed, msg: "no roles or users match"}
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.outputFile != "" {
+		f, err := os.Create(opts.outputFile)
+		if err != nil {
+			return fmt.Errorf("creating output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	m := newAccessMatrix(principals, opts.list.accounts.enabled())
+	if opts.output == "html" {
+		err = m.writeHTML(out)
+	} else {
+		err = m.writeCSV(out)
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case failed > 0:
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d principals could not be fetched", failed, total)}
+	case failedAccounts > 0:
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d accounts could not be listed", failedAccounts, len(apps))}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+const mcpProtocolVersion = "2024-11-05"
+
+// JSON-RPC error codes used by the MCP server.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+func newMCPCommand(global *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "mcp",
+		Short: "Run a Model Context Protocol server on stdio",
+		Long: "Run a Model Context Protocol server on stdin and stdout, so that AI assistants can look up\n" +
+			"statements, simulate requests and compare principals. Every tool is read only.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := global.loadConfig(cmd.Context())
+			if err != nil {
+				return err
+			}
+			s := &mcpServer{statementService: newStatementService(global, cfg, 0)}
+			return s.serve(cmd.Context(), os.Stdin, os.Stdout)
+		},
+	}
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	Annotations map[string]bool        `json:"annotations"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError"`
+}
+
+func stringProperty(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+func stringListProperty(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": map[string]string{"type": "string"}, "description": description}
+}
+
+func contextProperty(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": []string{"string", "array"}, "items": map[string]string{"type": "string"}},
+		"description":          description,
+	}
+}
+
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+var mcpTools = []mcpTool{
+	{
+		Name:        "show_statements",
+		Description: "List the effective identity policy statements of an IAM role, user or managed policy, with the policy each came from.",
+		InputSchema: objectSchema(map[string]interface{}{
+			"principal": stringProperty("role, user or customer managed policy name or arn; the caller identity when empty"),
+		}),
+	},
+	{
+		Name:        "simulate",
+		Description: "Decide whether a principal's identity policies allow actions on resources. Conditions are only evaluated when a context is given.",
+		InputSchema: objectSchema(map[string]interface{}{
+			"principal": stringProperty("role, user or customer managed policy name or arn; the caller identity when empty"),
+			"actions":   stringListProperty("actions such as s3:GetObject"),
+			"resources": stringListProperty("resource arns; defaults to *"),
+			"context":   contextProperty("condition key values of the request, such as {\"aws:SourceIp\": \"10.0.0.5\"}; conditions are not evaluated without one"),
+			"sessionPolicy": map[string]interface{}{
+				"type":        "object",
+				"description": "session policy document the principal's role session was assumed with; only what both it and the role allow is allowed",
+			},
+		}, "actions"),
+	},
+	{
+		Name:        "diff_principals",
+		Description: "Compare the statements of two principals or policies and list the ones only one of them has.",
+		InputSchema: objectSchema(map[string]interface{}{
+			"before": stringProperty("role, user or policy name or arn to compare from"),
+			"after":  stringProperty("role, user or policy name or arn to compare to"),
+		}, "before", "after"),
+	},
+}
+
+func init() {
+	for i := range mcpTools {
+		mcpTools[i].Annotations = map[string]bool{"readOnlyHint": true, "openWorldHint": true}
+	}
+}
+
+type mcpServer struct {
+	*statementService
+}
+
+// serve handles newline delimited JSON-RPC messages from r until it is
+// closed. Logs go to stderr so that stdout only carries responses.
+func (s *mcpServer) serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	encoder := json.NewEncoder(w)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			encoder.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, err.Error()}})
+			continue
+		}
+		if req.ID == nil {
+			// notifications such as notifications/initialized need no reply
+			continue
+		}
+
+		res := rpcResponse{JSONRPC: "2.0", ID: req.ID}
+		res.Result, res.Error = s.handle(ctx, req)
+		if err := encoder.Encode(res); err != nil {
+			return fmt.Errorf("writing response: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading requests: %w", err)
+	}
+	return nil
+}
+
+func (s *mcpServer) handle(ctx context.Context, req rpcRequest) (interface{}, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "iam-show", "version": "dev"},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": mcpTools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		if len(params.Arguments) == 0 {
+			params.Arguments = json.RawMessage("{}")
+		}
+		result, err := s.callTool(ctx, params.Name, params.Arguments)
+		var invalid *rpcError
+		if errors.As(err, &invalid) {
+			return nil, invalid
+		}
+		if err != nil {
+			logger.Info("tool call failed", "tool", params.Name, "error", err)
+			return mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+		}
+		text, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, &rpcError{rpcInvalidRequest, err.Error()}
+		}
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: string(text)}}}, nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, "method not found: " + req.Method}
+}
+
+// callTool runs a tool. Errors of type *rpcError are protocol errors, others
+// are reported to the model as a failed tool call.
+func (s *mcpServer) callTool(ctx context.Context, name string, arguments json.RawMessage) (interface{}, error) {
+	switch name {
+	case "show_statements":
+		var args struct {
+			Principal string `json:"principal"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		res, _, err := s.statements(ctx, args.Principal)
+		if err != nil {
+			return nil, err
+		}
+		return statementsResponse{Principal: res.arn, Statements: toJSONStatements(res.statements), Warnings: res.warnings}, nil
+
+	case "simulate":
+		var req simulateRequest
+		if err := json.Unmarshal(arguments, &req); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		if len(req.Actions) == 0 {
+			return nil, &rpcError{rpcInvalidParams, "no actions to simulate"}
+		}
+		res, _, err := s.statements(ctx, req.Principal)
+		if err != nil {
+			return nil, err
+		}
+		return simulate(res, req), nil
+
+	case "diff_principals":
+		var args struct {
+			Before string `json:"before"`
+			After  string `json:"after"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		if args.Before == "" || args.After == "" {
+			return nil, &rpcError{rpcInvalidParams, "both before and after are required"}
+		}
+		before, _, err := s.statements(ctx, args.Before)
+		if err != nil {
+			return nil, err
+		}
+		after, _, err := s.statements(ctx, args.After)
+		if err != nil {
+			return nil, err
+		}
+		diff := DiffStatements(before.statements, after.statements)
+		return map[string]interface{}{
+			"before":  before.arn,
+			"after":   after.arn,
+			"added":   toJSONStatements(diff.Added),
+			"removed": toJSONStatements(diff.Removed),
+		}, nil
+	}
+	return nil, &rpcError{rpcInvalidParams, "unknown tool: " + name}
+}
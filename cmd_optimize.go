@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func newOptimizeCommand(global *globalOptions) *cobra.Command {
+	var policyFile string
+	cmd := &cobra.Command{
+		Use:   "optimize [arn or name]",
+		Short: "Print a smaller policy document equivalent to a principal's statements",
+		Long: "Combine the statements of a role, user, group or policy into one document, merging statements\n" +
+			"that share their effect, condition and actions or resources, and dropping actions, resources\n" +
+			"and statements that a wildcard already covers.\n\n" +
+			"The document goes to stdout and what was changed to stderr.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runOptimize(cmd.Context(), global, policyFile, args)
+		},
+	}
+	cmd.Flags().StringVar(&policyFile, "policy-file", "", "optimize a local policy document without calling AWS, or - for stdin")
+	registerTargetCompletion(cmd, global)
+	return cmd
+}
+
+func runOptimize(ctx context.Context, global *globalOptions, policyFile string, targets []string) error {
+	var statements []Statement
+	if policyFile != "" {
+		if len(targets) > 0 {
+			return fmt.Errorf("--policy-file cannot be combined with a target")
+		}
+		var err error
+		statements, err = readPolicyFile(policyFile)
+		if err != nil {
+			return err
+		}
+	} else {
+		a, err := global.newApp(ctx)
+		if err != nil {
+			return err
+		}
+		defer a.cancel()
+
+		arns, err := resolvePrincipals(a, targets)
+		if err != nil {
+			return err
+		}
+		a.startProgress()
+		results := fetchAll(a.ctx, a.fetcher, arns)
+		a.fetcher.progress.Stop()
+		if results[0].err != nil {
+			return fmt.Errorf("%s: %w", arns[0], a.describe(results[0].err))
+		}
+		statements = results[0].statements
+	}
+
+	optimized, report, err := optimizeStatements(statements)
+	if err != nil {
+		return err
+	}
+	presenter := newPolicyJSONPresenter(os.Stdout)
+	for _, statement := range optimized {
+		presenter.PrintStatement(statement)
+	}
+	if err := presenter.Finish(); err != nil {
+		return err
+	}
+	presentOptimizeReport(os.Stderr, statements, optimized, report)
+	return nil
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	exitFailed  = 1
+	exitPartial = 2
+	exitDrift   = 3
+)
+
+// exitCodeError makes the command exit with code, printing msg first when it
+// is set.
+type exitCodeError struct {
+	code int
+	msg  string
+}
+
+func (e *exitCodeError) Error() string {
+	if e.msg == "" {
+		return fmt.Sprintf("exit code %d", e.code)
+	}
+	return e.msg
+}
+
+// globalOptions are the flags shared by every subcommand that talks to AWS.
+type globalOptions struct {
+	record      string
+	replay      string
+	cacheTTL    time.Duration
+	noCache     bool
+	refresh     bool
+	concurrency int
+	maxRetries  int
+	verbosity   int
+	debug       bool
+	keepGoing   bool
+	noProgress  bool
+	timeout     time.Duration
+	callTimeout time.Duration
+	source      string
+	aggregator  string
+	partition   string
+	fips        bool
+	dualStack   bool
+	rps         float64
+	burst       int
+	ssoLogin    bool
+	assumeRoles []string
+	// iamRegion is the region of the partition IAM and STS are called in,
+	// set by loadConfig
+	iamRegion string
+}
+
+func (o *globalOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.record, "record", "", "save every AWS API response to this directory")
+	flags.StringVar(&o.replay, "replay", "", "serve AWS API responses from a directory saved with --record instead of calling AWS")
+	flags.DurationVar(&o.cacheTTL, "cache-ttl", 24*time.Hour, "how long cached managed policy documents stay valid")
+	flags.BoolVar(&o.noCache, "no-cache", false, "do not read or write the policy cache")
+	flags.BoolVar(&o.refresh, "refresh", false, "ignore cached policy documents and fetch them again")
+	flags.IntVar(&o.concurrency, "concurrency", defaultConcurrency, "maximum number of policies or principals fetched at once")
+	flags.IntVar(&o.maxRetries, "max-retries", defaultMaxRetries, "maximum number of times a throttled or failed AWS API call is retried")
+	flags.CountVarP(&o.verbosity, "verbose", "v", "log every AWS API call to stderr; repeat for more detail")
+	flags.BoolVar(&o.debug, "debug", false, "log every AWS API call with its parameters and retries to stderr (same as -vv)")
+	flags.BoolVar(&o.keepGoing, "keep-going", false, "show the policies that could be fetched when others fail, and list the failures as warnings with exit code 2")
+	flags.BoolVar(&o.noProgress, "no-progress", false, "do not show a progress indicator on stderr")
+	flags.DurationVar(&o.timeout, "timeout", 5*time.Minute, "give up on the whole run after this long (0 for no limit)")
+	flags.DurationVar(&o.callTimeout, "call-timeout", 30*time.Second, "give up on a single AWS API call, including retries, after this long (0 for no limit)")
+	flags.StringVar(&o.source, "source", "iam", "where roles, users and policies are read from: iam, or config to read an AWS Config aggregator")
+	flags.StringVar(&o.partition, "partition", "", "AWS partition to call: aws, aws-us-gov or aws-cn (defaults to the partition of the configured region)")
+	flags.BoolVar(&o.fips, "fips", false, "call the FIPS 140-2 validated endpoints of AWS services")
+	flags.BoolVar(&o.dualStack, "dualstack", false, "call the dual-stack endpoints of AWS services, which accept IPv6")
+	flags.StringVar(&o.aggregator, "aggregator", "", "name of the AWS Config aggregator read with --source config")
+	flags.Float64Var(&o.rps, "rps", 0, "call IAM at most this many times a second, retries included (0 for no limit)")
+	flags.IntVar(&o.burst, "burst", 0, "how many IAM calls --rps lets through at once after a pause (defaults to --rps rounded up)")
+	flags.BoolVar(&o.ssoLogin, "sso-login", false, "run aws sso login first when the IAM Identity Center session of the profile has expired")
+	flags.StringArrayVar(&o.assumeRoles, "assume-role", nil, "arn of a role to call AWS as, optionally followed by ,external-id=,session-name= or ,duration=; repeat to assume each role with the one before")
+}
+
+func (o *globalOptions) setupLogging() {
+	level := logLevel(o.verbosity)
+	if o.debug {
+		level = levelDebug
+	}
+	if level > levelWarn {
+		logger = NewLogger(os.Stderr, level)
+	}
+}
+
+func (o *globalOptions) loadConfig(ctx context.Context) (aws.Config, error) {
+	if o.record != "" && o.replay != "" {
+		return aws.Config{}, errors.New("--record and --replay cannot be used together")
+	}
+
+	configOptions := []func(*config.LoadOptions) error{
+		config.WithRetryer(newRetryer(o.maxRetries)),
+	}
+	if o.fips {
+		configOptions = append(configOptions, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+	if o.dualStack {
+		configOptions = append(configOptions, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
+	apiOptions := []func(*middleware.Stack) error{}
+	if logger.Enabled(levelInfo) {
+		apiOptions = append(apiOptions, logAPICalls)
+	}
+	if o.callTimeout > 0 {
+		apiOptions = append(apiOptions, callTimeout(o.callTimeout))
+	}
+	if o.rps < 0 || o.burst < 0 {
+		return aws.Config{}, errors.New("--rps and --burst cannot be negative")
+	}
+	if o.burst > 0 && o.rps == 0 {
+		return aws.Config{}, errors.New("--burst needs --rps")
+	}
+	hops := []assumeRoleHop{}
+	for _, value := range o.assumeRoles {
+		hop, err := parseAssumeRole(value)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		hops = append(hops, hop)
+	}
+	if o.rps > 0 {
+		burst := o.burst
+		if burst == 0 {
+			burst = int(math.Ceil(o.rps))
+		}
+		apiOptions = append(apiOptions, rateLimit(o.rps, burst))
+	}
+	configOptions = append(configOptions, config.WithAPIOptions(apiOptions))
+	if o.replay != "" {
+		configOptions = append(configOptions,
+			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("replay", "replay", "")),
+			config.WithRetryer(func() aws.Retryer { return aws.NopRetryer{} }),
+		)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, configOptions...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("unable to load SDK config, %w", err)
+	}
+	partition := o.partition
+	if partition == "" {
+		partition = regionPartition(cfg.Region)
+	}
+	region, ok := partitionRegions[partition]
+	if !ok {
+		return aws.Config{}, fmt.Errorf("unknown partition %q, expected aws, aws-us-gov or aws-cn", partition)
+	}
+	// other services, such as Config for --source config, are called in the
+	// configured region
+	o.iamRegion = region
+	if cfg.Region == "" {
+		cfg.Region = region
+	}
+	if o.record != "" {
+		cfg.HTTPClient, err = newRecordingClient(cfg.HTTPClient, o.record)
+		if err != nil {
+			return aws.Config{}, err
+		}
+	}
+	if o.replay != "" {
+		cfg.HTTPClient = &replayClient{dir: o.replay}
+	}
+	if o.ssoLogin && o.replay == "" {
+		if err := ensureSSOSession(ctx, cfg); err != nil {
+			return aws.Config{}, err
+		}
+	}
+	if len(hops) > 0 {
+		cfg = assumeRoles(cfg, hops, o.pinSTS)
+	}
+	return cfg, nil
+}
+
+// partitionRegions are the regions IAM and STS are called in for each
+// partition. IAM is global within a partition, so any of its regions would
+// do.
+var partitionRegions = map[string]string{
+	"aws":        "us-west-2",
+	"aws-us-gov": "us-gov-west-1",
+	"aws-cn":     "cn-north-1",
+}
+
+// pinIAM and pinSTS are client options calling IAM and STS in the region
+// of the partition, whatever region the config has.
+func (o *globalOptions) pinIAM(opts *iam.Options) {
+	if o.iamRegion != "" {
+		opts.Region = o.iamRegion
+	}
+}
+
+func (o *globalOptions) pinSTS(opts *sts.Options) {
+	if o.iamRegion != "" {
+		opts.Region = o.iamRegion
+	}
+}
+
+// partitionTrailRegions are the regions whose CloudTrail event history is
+// read by default in each partition, starting with the one global services
+// such as IAM log to.
+var partitionTrailRegions = map[string][]string{
+	"aws":        {"us-east-1", "us-west-2"},
+	"aws-us-gov": {"us-gov-west-1", "us-gov-east-1"},
+	"aws-cn":     {"cn-north-1", "cn-northwest-1"},
+}
+
+// regionPartition returns the partition region is in, defaulting to aws.
+func regionPartition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	}
+	return "aws"
+}
+
+// app holds what a subcommand needs to talk to AWS.
+type app struct {
+	opts    *globalOptions
+	ctx     context.Context
+	cancel  context.CancelFunc
+	cfg     aws.Config
+	fetcher *Fetcher
+	// account is the account of an app for --accounts
+	account string
+}
+
+// partition is the partition IAM and STS are called in.
+func (a *app) partition() string {
+	return regionPartition(a.opts.iamRegion)
+}
+
+func (o *globalOptions) newApp(ctx context.Context) (*app, error) {
+	cfg, err := o.loadConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return o.appFromConfig(ctx, cfg)
+}
+
+// appFromConfig builds an app around an already loaded config, so that long
+// running commands can load it once and start a fresh app per request.
+func (o *globalOptions) appFromConfig(ctx context.Context, cfg aws.Config) (*app, error) {
+	fetcher, err := o.newFetcher(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cancel := func() {}
+	if o.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+	}
+
+	return &app{
+		opts:    o,
+		ctx:     ctx,
+		cancel:  cancel,
+		cfg:     cfg,
+		fetcher: fetcher,
+	}, nil
+}
+
+// newFetcher returns a fetcher calling the source of roles, users and
+// policies with cfg.
+func (o *globalOptions) newFetcher(cfg aws.Config) (*Fetcher, error) {
+	var client IAMAPI
+	switch o.source {
+	case "iam":
+		client = iam.NewFromConfig(cfg, o.pinIAM)
+	case "config":
+		if o.aggregator == "" {
+			return nil, errors.New("--source config needs --aggregator")
+		}
+		client = newConfigIAM(cfg, o.aggregator, o.pinIAM)
+	default:
+		return nil, fmt.Errorf("unknown source %q, expected iam or config", o.source)
+	}
+
+	fetcher := NewFetcher(client, cfg)
+	fetcher.sts = sts.NewFromConfig(cfg, o.pinSTS)
+	fetcher.concurrency = o.concurrency
+	fetcher.keepGoing = o.keepGoing
+	if !o.noCache && o.record == "" && o.replay == "" {
+		cacheDir, err := defaultCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		fetcher.cache = NewCache(cacheDir, o.cacheTTL, o.refresh)
+	}
+	return fetcher, nil
+}
+
+func (a *app) startProgress() {
+	if !a.opts.noProgress {
+		a.fetcher.progress = NewProgress(os.Stderr)
+	}
+}
+
+// describe replaces the SDK's deadline errors with a message saying which of
+// the timeouts was hit, and those of an expired IAM Identity Center session
+// with how to log in again.
+func (a *app) describe(err error) error {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return describeSSO(err)
+	}
+	if a.ctx.Err() != nil {
+		return fmt.Errorf("timed out after %s (see --timeout)", a.opts.timeout)
+	}
+	return fmt.Errorf("AWS API call timed out after %s (see --call-timeout): %w", a.opts.callTimeout, err)
+}
+
+// legacyArgs rewrites the -arn flag of versions before subcommands, which
+// took flags with one dash, to --arn, since pflag would read it as -a -r -n.
+func legacyArgs(args []string) []string {
+	out := make([]string, len(args))
+	copy(out, args)
+	for i, arg := range out {
+		if arg == "--" {
+			break
+		}
+		if arg == "-arn" || strings.HasPrefix(arg, "-arn=") {
+			out[i] = "-" + arg
+		}
+	}
+	return out
+}
+
+func newRootCommand() *cobra.Command {
+	opts := &globalOptions{}
+	show := &showOptions{}
+
+	root := &cobra.Command{
+		Use:   "iam-show [arn or name...]",
+		Short: "Show iam policy statements in the console",
+		Long: "Show iam policy statements in the console.\n\n" +
+			"Running iam-show with arns or names and no subcommand is the same as running iam-show show.",
+		Args:          cobra.ArbitraryArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			opts.setupLogging()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runShow(cmd.Context(), opts, show, args)
+		},
+	}
+	opts.addFlags(root.PersistentFlags())
+	show.addFlags(root.Flags())
+	markShowConflicts(root)
+	registerTargetCompletion(root, opts)
+
+	root.AddCommand(newShowCommand(opts))
+	root.AddCommand(newServeCommand(opts))
+	root.AddCommand(newMCPCommand(opts))
+	root.AddCommand(newSnapshotCommand(opts))
+	root.AddCommand(newHistoryCommand(opts))
+	root.AddCommand(newDiffCommand(opts))
+	root.AddCommand(newDriftCommand(opts))
+	root.AddCommand(newGenerateCommand(opts))
+	root.AddCommand(newListCommand(opts))
+	root.AddCommand(newOptimizeCommand(opts))
+	root.AddCommand(newStaleCommand(opts))
+	root.AddCommand(newFindCommand(opts))
+	root.AddCommand(newSimulateCommand(opts))
+	root.AddCommand(newMatrixCommand(opts))
+	root.AddCommand(newValidateCommand(opts))
+	root.AddCommand(newDoctorCommand(opts))
+
+	return root
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+//go:embed web/index.html
+var webFiles embed.FS
+
+type serveOptions struct {
+	web         string
+	responseTTL time.Duration
+}
+
+func newServeCommand(global *globalOptions) *cobra.Command {
+	opts := &serveOptions{}
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve a web UI and JSON API for browsing permissions",
+		Long: "Serve a small web UI and a JSON API for browsing the permissions of roles, users and policies.\n\n" +
+			"API endpoints:\n" +
+			"  GET  /principals/{arn or name}/statements\n" +
+			"  POST /simulate  {\"principal\": ..., \"actions\": [...], \"resources\": [...], \"context\": {...}, \"sessionPolicy\": {...}}\n\n" +
+			"Every request uses the credentials iam-show was started with and is logged to stderr; --timeout applies to each request.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(cmd.Context(), global, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.web, "web", "localhost:8080", "address to serve the web UI and API on, e.g. :8080 to share it with others")
+	cmd.Flags().DurationVar(&opts.responseTTL, "response-ttl", time.Minute, "how long a principal's statements are reused between requests (0 to fetch them every time)")
+	return cmd
+}
+
+func runServe(ctx context.Context, global *globalOptions, opts *serveOptions) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	cfg, err := global.loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	s := &webServer{
+		statementService: newStatementService(global, cfg, opts.responseTTL),
+		accessLog:        NewLogger(os.Stderr, levelInfo),
+	}
+
+	listener, err := net.Listen("tcp", opts.web)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", opts.web, err)
+	}
+	server := &http.Server{Handler: s.routes(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "serving on http://%s\n", listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving: %w", err)
+	}
+	return nil
+}
+
+type webServer struct {
+	*statementService
+	accessLog *Logger
+}
+
+func (s *webServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/api/principals", s.handlePrincipals)
+	mux.HandleFunc("/api/statements", s.handleStatements)
+	mux.HandleFunc("/principals/", s.handlePrincipalStatements)
+	mux.HandleFunc("/simulate", s.handleSimulate)
+	return s.logRequests(mux)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests writes an access log line for every request, so that what was
+// queried through the server's identity can be audited.
+func (s *webServer) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		s.accessLog.Info("request",
+			"method", r.Method,
+			"path", r.URL.RequestURI(),
+			"remote", r.RemoteAddr,
+			"status", rec.status,
+			"duration", time.Since(start).Round(time.Millisecond),
+		)
+	})
+}
+
+func (s *webServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	page, err := webFiles.ReadFile("web/index.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+func (s *webServer) handlePrincipals(w http.ResponseWriter, r *http.Request) {
+	a, err := s.global.appFromConfig(r.Context(), s.cfg)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer a.cancel()
+
+	candidates, err := a.fetcher.ListPrincipals(a.ctx, "")
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, a.describe(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, candidates)
+}
+
+func (s *webServer) handleStatements(w http.ResponseWriter, r *http.Request) {
+	s.writeStatements(w, r, r.URL.Query().Get("target"))
+}
+
+// handlePrincipalStatements serves GET /principals/{arn or name}/statements.
+// Arns contain slashes, so everything between the prefix and the suffix is
+// taken as the target.
+func (s *webServer) handlePrincipalStatements(w http.ResponseWriter, r *http.Request) {
+	target := strings.TrimPrefix(r.URL.Path, "/principals/")
+	if !strings.HasSuffix(target, "/statements") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+		return
+	}
+	target = strings.TrimSuffix(target, "/statements")
+	if target == "" {
+		writeJSONError(w, http.StatusBadRequest, errors.New("missing principal"))
+		return
+	}
+	s.writeStatements(w, r, target)
+}
+
+func (s *webServer) writeStatements(w http.ResponseWriter, r *http.Request, target string) {
+	res, status, err := s.statements(r.Context(), target)
+	if err != nil {
+		writeJSONError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, statementsResponse{
+		Principal:  res.arn,
+		Statements: toJSONStatements(res.statements),
+		Warnings:   res.warnings,
+	})
+}
+
+// handleSimulate evaluates every action against every resource using the
+// principal's identity policies, defaulting to the "*" resource.
+func (s *webServer) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+		return
+	}
+	var req simulateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("decoding request: %w", err))
+		return
+	}
+	if len(req.Actions) == 0 {
+		writeJSONError(w, http.StatusBadRequest, errors.New("no actions to simulate"))
+		return
+	}
+
+	res, status, err := s.statements(r.Context(), req.Principal)
+	if err != nil {
+		writeJSONError(w, status, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, simulate(res, req))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn("could not write response", "error", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	logger.Info("request failed", "status", status, "error", err)
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,997 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/term"
+)
+
+type showOptions struct {
+	arn         string
+	arnFile     string
+	policyFile  string
+	terraform   string
+	pick        bool
+	dryRun      bool
+	tui         bool
+	watch       bool
+	interval    time.Duration
+	notify      notifyOptions
+	accounts    accountOptions
+	output      string
+	usage       bool
+	trail       trailOptions
+	credentials bool
+	schema      bool
+	jsonVersion int
+	noSummary   bool
+	showTags    bool
+	resolve     bool
+	tags        []string
+	pathPrefix  string
+	sizes       bool
+	lint        bool
+	describe    bool
+	context     []string
+	trust       bool
+	verifyOrg   bool
+	session     string
+	sort        string
+	quiet       bool
+	count       bool
+	wide        bool
+	columns     []string
+	markers     string
+	outputFile  string
+	outputDir   string
+	risk        bool
+	compare     string
+	suggest     bool
+}
+
+func (o *showOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.arn, "arn", "", "arn of managed policy, role, user, codebuild project or codepipeline (defaults to the caller identity)")
+	flags.StringVar(&o.arnFile, "arn-file", "", "file containing one arn or name per line, or - for stdin")
+	flags.StringVar(&o.policyFile, "policy-file", "", "render a local policy document without calling AWS, or - for stdin")
+	flags.StringVar(&o.terraform, "from-terraform", "", "render the IAM policies in a terraform show -json plan or state file without calling AWS")
+	flags.BoolVar(&o.pick, "pick", false, "interactively search for a role or user to show")
+	flags.StringSliceVar(&o.tags, "tag", nil, "only offer roles and users with this tag in --pick, as key=value or key; repeat to require several")
+	flags.StringSliceVar(&o.tags, "tags", nil, "same as --tag")
+	flags.MarkHidden("tags")
+	flags.StringVar(&o.pathPrefix, "path-prefix", "", "only offer roles and users under this path in --pick, e.g. /service-role/")
+	flags.BoolVar(&o.dryRun, "dry-run", false, "print the AWS API calls that would be made without making them")
+	flags.BoolVar(&o.tui, "tui", false, "browse the statements in an interactive terminal UI")
+	flags.BoolVar(&o.watch, "watch", false, "keep fetching the statements and print what changed")
+	flags.DurationVar(&o.interval, "interval", time.Minute, "how often --watch fetches the statements again")
+	o.notify.addFlags(flags)
+	o.accounts.addFlags(flags)
+	flags.StringVarP(&o.output, "output", "o", "text", "output format: "+strings.Join(outputFormats, ", "))
+	flags.BoolVarP(&o.quiet, "quiet", "q", false, "print only the statements, without progress, notes or summaries")
+	flags.BoolVar(&o.noSummary, "no-summary", false, "do not print the line counting policies, statements, warnings and errors at the end")
+	flags.StringVar(&o.markers, "markers", "", "put symbols before Allow and Deny and finding severities, as allow,deny symbols (default "+defaultMarkers+" when given without a value)")
+	flags.Lookup("markers").NoOptDefVal = defaultMarkers
+	flags.BoolVar(&o.wide, "wide", false, "do not wrap long statements to the width of the terminal")
+	flags.BoolVar(&o.count, "count", false, "only print how many statements, actions and resources each principal has")
+	flags.StringVar(&o.compare, "compare-managed", "", "compare the actions of each principal with an AWS managed policy, such as ReadOnlyAccess, after the statements")
+	flags.BoolVar(&o.suggest, "suggest-managed", false, "suggest AWS managed policies that together allow the actions of the inline statements of each principal")
+	flags.BoolVar(&o.risk, "risk", false, "score the risk of each Allow statement and show the highest of each principal")
+	flags.StringVar(&o.outputFile, "output-file", "", "write the output to this file instead of stdout, without colors")
+	flags.StringVar(&o.outputDir, "output-dir", "", "write the statements of each principal to a file of its own in this directory")
+	flags.StringSliceVar(&o.columns, "columns", nil, "columns of csv, markdown and html output, from "+strings.Join(reportColumns, ","))
+	flags.StringVar(&o.sort, "sort", "policy", "order of the statements: "+strings.Join(statementOrders, ", ")+"; actions and resources are always sorted")
+	flags.BoolVar(&o.usage, "usage", false, "mark each allowed action as used or unused according to CloudTrail")
+	o.trail.addFlags(flags)
+	flags.StringSliceVar(&o.context, "context", nil, "evaluate conditions for a request with these condition key values, e.g. aws:SourceIp=10.0.0.5,aws:MultiFactorAuthPresent=true")
+	flags.BoolVar(&o.describe, "describe", false, "describe what each action does, from the embedded action catalog")
+	flags.BoolVar(&o.lint, "lint", false, "check the statements for problems such as allows that a deny overrides, after the statements")
+	flags.BoolVar(&o.trust, "trust", false, "show the trust policy of roles after their statements, with its organization boundary")
+	flags.BoolVar(&o.verifyOrg, "verify-org", false, "check the organization ids in trust policies or --policy-file conditions against the caller's organization")
+	flags.StringVar(&o.session, "session-policy", "", "show what roles allow when assumed with this session policy document")
+	flags.BoolVar(&o.sizes, "sizes", false, "show the size of each policy, and the policies attached and versions of each, against their IAM quotas after the statements")
+	flags.BoolVar(&o.showTags, "show-tags", false, "show the tags of roles, users and policies after their statements")
+	flags.BoolVar(&o.resolve, "resolve-resources", false, "list the s3 buckets, dynamodb tables, sqs queues and sns topics that wildcard resources match after the statements")
+	flags.BoolVar(&o.credentials, "credentials", false, "show password, access key and MFA details of users from the account credential report")
+	flags.BoolVar(&o.schema, "schema", false, "print the JSON Schema of --output json, for --output-version, and exit")
+	flags.IntVar(&o.jsonVersion, "output-version", 1, "version of the --output json and rego-data document: 1, or 2 with statement sources nested and condition values always listed")
+}
+
+func newShowCommand(global *globalOptions) *cobra.Command {
+	opts := &showOptions{}
+	cmd := &cobra.Command{
+		Use:   "show [arn or name...]",
+		Short: "Show the policy statements of principals or policies",
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runShow(cmd.Context(), global, opts, args)
+		},
+	}
+	opts.addFlags(cmd.Flags())
+	markShowConflicts(cmd)
+	registerTargetCompletion(cmd, global)
+	return cmd
+}
+
+// showConflicts lists flags of show each followed by the flags it cannot be
+// used with. markShowConflicts has cobra reject them before runShow.
+var showConflicts = [][]string{
+	{"output-file", "tui", "watch", "output-dir"},
+	{"output-dir", "tui", "watch", "usage", "policy-file", "from-terraform", "lint", "trust", "sizes", "show-tags", "resolve-resources", "credentials", "compare-managed", "suggest-managed"},
+	{"tui", "watch", "usage", "lint", "trust", "sizes", "show-tags", "resolve-resources", "credentials", "compare-managed", "suggest-managed", "account-names"},
+	{"watch", "usage", "lint", "trust", "session-policy", "sizes", "show-tags", "resolve-resources", "credentials", "compare-managed", "suggest-managed", "accounts", "org"},
+	{"policy-file", "from-terraform", "usage", "trust", "session-policy", "sizes", "show-tags", "resolve-resources", "credentials", "compare-managed", "accounts", "org"},
+	{"from-terraform", "usage", "trust", "session-policy", "sizes", "show-tags", "resolve-resources", "credentials", "compare-managed", "suggest-managed", "accounts", "org"},
+	{"usage", "session-policy", "accounts", "org"},
+	{"accounts", "org", "pick", "dry-run", "trust", "show-tags", "credentials", "resolve-resources"},
+	{"org", "pick", "dry-run", "trust", "show-tags", "credentials", "resolve-resources"},
+}
+
+func markShowConflicts(cmd *cobra.Command) {
+	for _, conflict := range showConflicts {
+		for _, other := range conflict[1:] {
+			cmd.MarkFlagsMutuallyExclusive(conflict[0], other)
+		}
+	}
+}
+
+// validate checks what showConflicts cannot: flags that need text output or
+// another flag.
+func (opts *showOptions) validate() error {
+	textOnly := []struct {
+		flag string
+		set  bool
+	}{
+		{"--tui", opts.tui},
+		{"--watch", opts.watch},
+		{"--usage", opts.usage},
+		{"--lint", opts.lint},
+		{"--trust", opts.trust},
+		{"--sizes", opts.sizes},
+		{"--show-tags", opts.showTags},
+		{"--resolve-resources", opts.resolve},
+		{"--credentials", opts.credentials},
+		{"--compare-managed", opts.compare != ""},
+		{"--suggest-managed", opts.suggest},
+		{"--account-names", opts.accounts.names},
+	}
+	for _, f := range textOnly {
+		if f.set && opts.output != "text" {
+			return fmt.Errorf("%s only supports text output", f.flag)
+		}
+	}
+	if (len(opts.tags) > 0 || opts.pathPrefix != "") && !opts.pick {
+		return errors.New("--tag and --path-prefix filter the roles and users offered by --pick")
+	}
+	if opts.verifyOrg && !opts.trust && opts.policyFile == "" {
+		return errors.New("--verify-org checks the organization ids of --trust or --policy-file")
+	}
+	if !opts.watch && (opts.notify.webhook != "" || opts.notify.snsTopic != "") {
+		return errors.New("--notify-webhook and --notify-sns need --watch")
+	}
+	if opts.usage {
+		return opts.trail.validate()
+	}
+	return nil
+}
+
+func runShow(ctx context.Context, global *globalOptions, opts *showOptions, args []string) error {
+	if opts.schema {
+		schema, err := outputSchema(opts.jsonVersion)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(schema)
+		return err
+	}
+	if opts.markers != "" {
+		var err error
+		if markers, err = parseMarkers(opts.markers); err != nil {
+			return err
+		}
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	tagFilters, err := parseTagFilters(opts.tags)
+	if err != nil {
+		return err
+	}
+	var session []Statement
+	if opts.session != "" {
+		if session, err = readSessionPolicy(opts.session); err != nil {
+			return err
+		}
+	}
+	out := os.Stdout
+	width := 0
+	if opts.outputFile != "" || opts.outputDir != "" {
+		// files get no colors, whatever stdout is
+		color.NoColor = true
+	} else if !opts.wide {
+		width = terminalWidth(os.Stdout)
+	}
+	if opts.outputFile != "" {
+		f, err := os.Create(opts.outputFile)
+		if err != nil {
+			return fmt.Errorf("creating output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	presenter, err := opts.newPresenter(global, out, width)
+	if err != nil {
+		return err
+	}
+	if opts.quiet {
+		global.noProgress = true
+	}
+	if opts.tui && !opts.dryRun {
+		if !isatty.IsTerminal(os.Stdout.Fd()) {
+			return errors.New("--tui requires an interactive terminal")
+		}
+		presenter = &sortingPresenter{Presenter: newTUIPresenter(), by: opts.sort}
+	}
+
+	if opts.policyFile != "" {
+		return opts.showPolicyFile(ctx, global, out, presenter)
+	}
+	if opts.terraform != "" {
+		return opts.showTerraform(out, presenter)
+	}
+
+	targets, err := opts.targets(args)
+	if err != nil {
+		return err
+	}
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+	fetcher := a.fetcher
+
+	if opts.dryRun {
+		presentShowPlan(out, fetcher, opts.pick, targets)
+		return nil
+	}
+	if opts.pick || len(targets) == 0 && opts.pickByDefault() {
+		picked, err := pickTarget(a, opts.pathPrefix, tagFilters, !opts.pick)
+		if err != nil {
+			return err
+		}
+		if picked != "" {
+			targets = append(targets, picked)
+		}
+	}
+	if len(targets) == 0 && opts.accounts.enabled() {
+		return errors.New("--accounts and --org need the arns or names of principals to show")
+	}
+	if len(targets) == 0 {
+		arn, err := callerTarget(a, opts.quiet)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, arn)
+	}
+
+	if opts.watch {
+		return runWatch(ctx, global, a.cfg, targets, opts.interval, presenter, opts.notify.newNotifier(a.cfg))
+	}
+
+	if opts.usage {
+		usage := newUsagePresenter(out, opts.trail.days, func(principal string) ([]Action, error) {
+			principal = principalKey(fetcher, principal)
+			if t := fetcher.arnType(principal); t != RoleArn && t != UserArn {
+				return nil, fmt.Errorf("%s is not a role or user", principal)
+			}
+			used, err := usedActions(a.ctx, a.cfg, opts.trail.query(principal, a.partition()))
+			return used, a.describe(err)
+		})
+		presenter = &sortingPresenter{Presenter: usage, by: opts.sort}
+	}
+
+	var accountApps []*app
+	if opts.accounts.enabled() {
+		if accountApps, err = opts.accounts.apps(a); err != nil {
+			return err
+		}
+		opts.accounts.resolveNames(accountApps)
+	} else {
+		opts.accounts.resolveNames([]*app{a})
+	}
+
+	results := opts.fetchResults(a, accountApps, presenter, targets)
+	warnings := []string{}
+	if opts.session != "" {
+		warnings = append(warnings, applySessionPolicy(fetcher, results, session)...)
+	}
+	failed, printWarnings, err := opts.printResults(global, a, presenter, results)
+	if err != nil {
+		return err
+	}
+	warnings = append(warnings, printWarnings...)
+	sectionWarnings, err := opts.presentSections(out, a, results)
+	if err != nil {
+		return err
+	}
+	warnings = append(warnings, sectionWarnings...)
+
+	presentWarnings(warnings)
+	policies, statements := 0, 0
+	for _, result := range results {
+		if result.shown() {
+			policies += countPolicies(result.statements)
+			statements += len(result.statements)
+		}
+	}
+	opts.presentRunSummary(policies, statements, len(warnings), failed)
+
+	if failed > 0 {
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d arns failed", failed, len(results))}
+	}
+	if len(warnings) > 0 {
+		return &exitCodeError{code: exitPartial}
+	}
+	return nil
+}
+
+// fetchResults fetches the statements of targets, in each of accountApps
+// with --accounts. A single target is printed as its policies arrive.
+func (opts *showOptions) fetchResults(a *app, accountApps []*app, presenter Presenter, targets []string) []principalResult {
+	fetcher := a.fetcher
+	a.startProgress()
+
+	var results []principalResult
+	if accountApps != nil {
+		results = fetchAccounts(a.ctx, accountApps, fetcher.progress, targets, fetcher.concurrencyLimit())
+	} else if len(targets) == 1 && !opts.usage && opts.session == "" && opts.outputDir == "" {
+		header := func(arn string) {
+			if wantsHeaders(presenter) {
+				presenter.PrintHeader(arn)
+			}
+		}
+		results = []principalResult{streamOne(a.ctx, fetcher, targets[0], header, func(statements []Statement) {
+			fetcher.progress.Print(func() {
+				for _, statement := range statements {
+					presenter.PrintStatement(statement)
+				}
+			})
+		})}
+	} else {
+		results = fetchAll(a.ctx, fetcher, targets)
+	}
+	fetcher.progress.Stop()
+	if !opts.quiet {
+		for _, result := range results {
+			if service, ok := serviceLinkedService(result.arn); ok && result.shown() {
+				fmt.Fprintf(os.Stderr, "%s is a service-linked role of %s: its policies are managed by AWS and cannot be changed, only the role deleted through the service\n", result.arn, service)
+			}
+		}
+	}
+	return results
+}
+
+// printResults prints the statements of results not already streamed, or
+// writes them to --output-dir, returning how many principals failed and
+// the warnings of those only partly fetched. A single failed principal is
+// an error.
+func (opts *showOptions) printResults(global *globalOptions, a *app, presenter Presenter, results []principalResult) (int, []string, error) {
+	failed := 0
+	warnings := []string{}
+	for _, result := range results {
+		var partial *PartialError
+		if errors.As(result.err, &partial) {
+			for _, err := range partial.Errors {
+				warnings = append(warnings, fmt.Sprintf("%s: %v", result.arn, a.describe(err)))
+			}
+		} else if result.err != nil {
+			if len(results) == 1 {
+				return 0, nil, fmt.Errorf("%s: %w", result.arn, a.describe(result.err))
+			}
+			logger.Warn("could not show principal", "arn", result.arn, "error", a.describe(result.err))
+			failed++
+			continue
+		}
+
+		if opts.outputDir != "" {
+			if err := opts.writeOutputDir(global, result); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+		if result.streamed {
+			continue
+		}
+		if len(results) > 1 || opts.usage || wantsHeaders(presenter) {
+			presenter.PrintHeader(result.arn)
+		}
+		for _, statement := range result.statements {
+			presenter.PrintStatement(statement)
+		}
+	}
+	if opts.outputDir == "" {
+		if err := presenter.Finish(); err != nil {
+			return 0, nil, err
+		}
+	}
+	return failed, warnings, nil
+}
+
+// showPolicyFile prints the statements of --policy-file, calling AWS only
+// for --verify-org, --account-names and --suggest-managed.
+func (opts *showOptions) showPolicyFile(ctx context.Context, global *globalOptions, out io.Writer, presenter Presenter) error {
+	statements, err := readPolicyFile(opts.policyFile)
+	if err != nil {
+		return err
+	}
+	current := ""
+	var a *app
+	if opts.verifyOrg || opts.accounts.names || opts.suggest {
+		a, err = global.newApp(ctx)
+		if err != nil {
+			return err
+		}
+		defer a.cancel()
+		opts.accounts.resolveNames([]*app{a})
+		if opts.verifyOrg {
+			if current, err = currentOrganization(a.ctx, a.cfg); err != nil {
+				return a.describe(err)
+			}
+		}
+	}
+	for _, statement := range statements {
+		presenter.PrintStatement(statement)
+	}
+	if err := presenter.Finish(); err != nil {
+		return err
+	}
+	if !opts.quiet || opts.verifyOrg {
+		presentOrgBoundary(out, statements, opts.verifyOrg, current)
+	}
+	if opts.lint {
+		fmt.Fprintln(out)
+		presentFindings(out, opts.policyFile, lint(statements))
+	}
+	if opts.suggest {
+		fmt.Fprintln(out)
+		presentSuggestion(out, opts.policyFile, suggestManaged(a.ctx, a.fetcher, a.partition(), statements))
+	}
+	opts.presentRunSummary(countPolicies(statements), len(statements), 0, 0)
+	return nil
+}
+
+// showTerraform prints the statements of the principals of --from-terraform.
+func (opts *showOptions) showTerraform(out io.Writer, presenter Presenter) error {
+	sections, err := terraformStatements(opts.terraform)
+	if err != nil {
+		return err
+	}
+	for _, section := range sections {
+		if len(sections) > 1 || wantsHeaders(presenter) {
+			presenter.PrintHeader(section.principal)
+		}
+		for _, statement := range section.statements {
+			presenter.PrintStatement(statement)
+		}
+	}
+	if err := presenter.Finish(); err != nil {
+		return err
+	}
+	if opts.lint {
+		for _, section := range sections {
+			fmt.Fprintln(out)
+			presentFindings(out, section.principal, lint(section.statements))
+		}
+	}
+	policies, statements := 0, 0
+	for _, section := range sections {
+		policies += countPolicies(section.statements)
+		statements += len(section.statements)
+	}
+	opts.presentRunSummary(policies, statements, 0, 0)
+	return nil
+}
+
+// targets are the arns and names of --arn, the arguments and --arn-file.
+func (opts *showOptions) targets(args []string) ([]string, error) {
+	targets := args
+	if opts.arn != "" {
+		targets = append([]string{opts.arn}, targets...)
+	}
+	if opts.arnFile != "" {
+		fileTargets, err := readTargets(opts.arnFile)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, fileTargets...)
+	}
+	return targets, nil
+}
+
+// presentShowPlan prints the calls of --dry-run.
+func presentShowPlan(out io.Writer, fetcher *Fetcher, pick bool, targets []string) {
+	if pick {
+		presentPlan(out, "--pick", "interactive", []plannedCall{
+			{"iam:ListRoles", "all pages"},
+			{"iam:ListUsers", "all pages"},
+			{"...", "then the calls for the picked role or user"},
+		})
+	}
+	if len(targets) == 0 && !pick {
+		presentPlan(out, "caller identity", "current credentials", []plannedCall{
+			{"sts:GetCallerIdentity", ""},
+			{"...", "then the calls for the caller's role or user"},
+		})
+	}
+	for _, target := range targets {
+		presentPlan(out, target, fetcher.describeTarget(target), fetcher.Plan(target))
+	}
+}
+
+// pickByDefault reports whether show without arns or names offers the
+// picker, as it does to someone reading text at a terminal. Pressing enter
+// still shows the caller identity, which is what scripts get.
+func (opts *showOptions) pickByDefault() bool {
+	return !opts.quiet && !opts.accounts.enabled() && opts.output == "text" && opts.outputFile == "" && opts.outputDir == "" &&
+		isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd())
+}
+
+// pickTarget lets the user search the roles and users under pathPrefix
+// matching filters, and returns the arn of the one picked. orCaller lets
+// them pick none, for the caller identity, which is also what they get when
+// the roles and users cannot be listed.
+func pickTarget(a *app, pathPrefix string, filters []tagFilter, orCaller bool) (string, error) {
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		return "", errors.New("--pick requires an interactive terminal")
+	}
+	candidates, err := a.fetcher.ListPrincipals(a.ctx, pathPrefix)
+	if err != nil && orCaller {
+		logger.Info("could not list roles and users to pick from, showing the caller identity", "error", a.describe(err))
+		return "", nil
+	} else if err != nil {
+		return "", a.describe(err)
+	}
+	candidates, err = a.fetcher.filterByTags(a.ctx, candidates, filters)
+	if err != nil {
+		return "", a.describe(err)
+	}
+	if len(candidates) == 0 && orCaller {
+		return "", nil
+	} else if len(candidates) == 0 {
+		return "", errors.New("no roles or users match the tag filters")
+	}
+	picked, err := Pick(os.Stdin, os.Stderr, candidates, orCaller)
+	if err != nil {
+		return "", err
+	}
+	return picked.Arn, nil
+}
+
+// callerTarget returns the arn of the caller, saying on stderr that its
+// permissions are shown unless quiet.
+func callerTarget(a *app, quiet bool) (string, error) {
+	arn, err := a.fetcher.CallerArn(a.ctx)
+	if err != nil {
+		return "", a.describe(err)
+	}
+	note := "showing permissions for " + arn
+	if a.fetcher.arnType(arn) == AssumedRoleArn {
+		roleName, err := principalName(arn)
+		if err != nil {
+			return "", err
+		}
+		note += " (role " + roleName + ")"
+	}
+	if !quiet {
+		fmt.Fprintln(os.Stderr, note)
+	}
+	return arn, nil
+}
+
+// presentSections prints what the flags add after the statements, such as
+// --lint findings and --sizes quotas, returning the warnings of principals
+// they could not be shown for.
+func (opts *showOptions) presentSections(out io.Writer, a *app, results []principalResult) ([]string, error) {
+	warnings := []string{}
+	if opts.lint {
+		for _, result := range results {
+			if result.shown() {
+				fmt.Fprintln(out)
+				presentFindings(out, result.arn, lint(result.statements))
+			}
+		}
+	}
+	if opts.trust {
+		warnings = append(warnings, showTrustPolicies(out, a, results, opts.verifyOrg)...)
+	}
+	if opts.sizes {
+		warnings = append(warnings, showSizes(out, a, results)...)
+	}
+	if opts.showTags {
+		warnings = append(warnings, showTags(out, a, results)...)
+	}
+	if opts.resolve {
+		resolver := newResourceResolver(a)
+		for _, result := range results {
+			if result.shown() {
+				fmt.Fprintln(out)
+				warnings = append(warnings, presentResolved(out, result.arn, a.cfg.Region, resolver.resolve(result.statements))...)
+			}
+		}
+	}
+	if opts.credentials {
+		warnings = append(warnings, showCredentials(out, a, results)...)
+	}
+	if opts.compare != "" {
+		policy, baseline, err := a.fetcher.AWSManagedPolicy(a.ctx, a.partition(), opts.compare)
+		if err != nil {
+			return nil, a.describe(err)
+		}
+		for _, result := range results {
+			if result.shown() {
+				fmt.Fprintln(out)
+				presentComparison(out, result.arn, policy, compareActions(result.statements, baseline))
+			}
+		}
+	}
+	if opts.suggest {
+		for _, result := range results {
+			if result.shown() {
+				fmt.Fprintln(out)
+				presentSuggestion(out, result.arn, suggestManaged(a.ctx, a.fetcher, a.partition(), result.statements))
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// showSizes prints the sizes and quotas of the policies of each principal.
+func showSizes(out io.Writer, a *app, results []principalResult) []string {
+	warnings := []string{}
+	for _, result := range results {
+		if !result.shown() {
+			continue
+		}
+		principalType := a.fetcher.arnType(result.arn)
+		if principalType == AssumedRoleArn {
+			principalType = RoleArn
+		}
+		fmt.Fprintln(out)
+		presentPolicyUsages(out, result.arn, policyUsages(principalType, result.statements))
+		limits, newer, err := a.fetcher.policyLimits(a.ctx, principalType, result.statements)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", result.arn, a.describe(err)))
+		}
+		fmt.Fprintln(out)
+		presentPolicyLimits(out, result.arn, limits, newer, time.Now())
+	}
+	return warnings
+}
+
+// showTags prints the tags of each principal.
+func showTags(out io.Writer, a *app, results []principalResult) []string {
+	warnings := []string{}
+	for _, result := range results {
+		if !result.shown() {
+			continue
+		}
+		tags, err := a.fetcher.Tags(a.ctx, result.arn)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", result.arn, a.describe(err)))
+			continue
+		}
+		fmt.Fprintln(out)
+		presentTags(out, result.arn, tags)
+	}
+	return warnings
+}
+
+// newPresenter returns the presenter of --output writing to w, set up with
+// the other output flags. Statements are wrapped to width when it is not 0.
+func (opts *showOptions) newPresenter(global *globalOptions, w io.Writer, width int) (Presenter, error) {
+	presenter, err := newPresenter(opts.output, w)
+	if err != nil {
+		return nil, err
+	}
+	text, isText := presenter.(*textPresenter)
+	if opts.describe {
+		if !isText || opts.tui || opts.usage {
+			return nil, errors.New("--describe only supports text output, without --tui or --usage")
+		}
+		text.describe = true
+	}
+	if len(opts.context) > 0 {
+		ctx, err := parseRequestContext(opts.context)
+		if err != nil {
+			return nil, err
+		}
+		if !isText || opts.tui || opts.usage {
+			return nil, errors.New("--context only supports text output, without --tui or --usage")
+		}
+		text.context = ctx.withRequestTime(time.Now())
+	}
+	if len(opts.columns) > 0 {
+		columns, err := parseColumns(opts.columns)
+		if err != nil {
+			return nil, err
+		}
+		switch p := presenter.(type) {
+		case *csvPresenter:
+			p.columns = columns
+		case *markdownPresenter:
+			p.columns = columns
+		case *htmlPresenter:
+			p.columns = columns
+		default:
+			return nil, errors.New("--columns only applies to csv, markdown and html output")
+		}
+	}
+	if _, err := outputSchema(opts.jsonVersion); err != nil {
+		return nil, err
+	}
+	if p, ok := presenter.(*regoDataPresenter); ok {
+		p.version = opts.jsonVersion
+	} else if opts.jsonVersion != 1 {
+		return nil, errors.New("--output-version only applies to json and rego-data output")
+	}
+	if opts.risk {
+		if !isText || opts.tui || opts.usage {
+			return nil, errors.New("--risk only supports text output, without --tui or --usage")
+		}
+		text.risk = true
+	}
+	if isText {
+		text.provenance = global.verbosity >= 2 || global.debug
+		text.quiet = opts.quiet
+		text.width = width
+	}
+	if opts.count {
+		if opts.tui || opts.watch || opts.usage || opts.output != "text" {
+			return nil, errors.New("--count cannot be used with --tui, --watch, --usage or --output")
+		}
+		presenter = newCountPresenter(w)
+	}
+	return newSortingPresenter(presenter, opts.sort)
+}
+
+// outputExtensions are the file extensions --output-dir gives each format.
+var outputExtensions = map[string]string{
+	"text":           ".txt",
+	"json":           ".json",
+	"terraform":      ".tf",
+	"cloudformation": ".yaml",
+	"policy-json":    ".json",
+	"cdk-ts":         ".ts",
+	"cdk-go":         ".go",
+	"markdown":       ".md",
+	"html":           ".html",
+	"csv":            ".csv",
+	"flat":           ".txt",
+	"rego-data":      ".json",
+}
+
+// writeOutputDir writes the statements of result to a file of its own in
+// --output-dir.
+func (opts *showOptions) writeOutputDir(global *globalOptions, result principalResult) error {
+	var buf bytes.Buffer
+	presenter, err := opts.newPresenter(global, &buf, 0)
+	if err != nil {
+		return err
+	}
+	if wantsHeaders(presenter) {
+		presenter.PrintHeader(result.arn)
+	}
+	for _, statement := range result.statements {
+		presenter.PrintStatement(statement)
+	}
+	if err := presenter.Finish(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(opts.outputDir, 0o755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(opts.outputDir, outputFileName(result.arn, opts.output)), buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	return nil
+}
+
+// outputFileName names the file --output-dir writes the statements of arn
+// to in format, after its account and resource.
+func outputFileName(arn, format string) string {
+	name := arn
+	if parsed, err := awsarn.Parse(arn); err == nil {
+		name = parsed.AccountID + "-" + parsed.Resource
+	}
+	return strings.NewReplacer("/", "-", ":", "-").Replace(name) + outputExtensions[format]
+}
+
+// terminalWidth returns the width of the terminal f is, or 0 when it is not
+// one.
+func terminalWidth(f *os.File) int {
+	if !isatty.IsTerminal(f.Fd()) {
+		return 0
+	}
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// showCredentials prints the credential report rows of the users in results
+// and returns warnings for the ones it could not show.
+func showCredentials(w io.Writer, a *app, results []principalResult) []string {
+	users := []string{}
+	for _, result := range results {
+		if result.shown() && a.fetcher.arnType(result.arn) == UserArn {
+			users = append(users, result.arn)
+		}
+	}
+	if len(users) == 0 {
+		return []string{"--credentials: no users shown"}
+	}
+
+	report, err := fetchCredentialReport(a.ctx, a.fetcher.client)
+	if err != nil {
+		return []string{fmt.Sprintf("--credentials: %v", a.describe(err))}
+	}
+	warnings := []string{}
+	now := time.Now()
+	for _, arn := range users {
+		entry, ok := report[arn]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s: not in the credential report of this account", arn))
+			continue
+		}
+		fmt.Fprintln(w)
+		presentCredentials(w, entry, now)
+	}
+	return warnings
+}
+
+// showTrustPolicies prints the trust policies of the roles in results and
+// returns warnings for the ones it could not show.
+func showTrustPolicies(w io.Writer, a *app, results []principalResult, verify bool) []string {
+	current := ""
+	if verify {
+		var err error
+		if current, err = currentOrganization(a.ctx, a.cfg); err != nil {
+			return []string{fmt.Sprintf("--verify-org: %v", a.describe(err))}
+		}
+	}
+	warnings := []string{}
+	for _, result := range results {
+		if !result.shown() {
+			continue
+		}
+		if t := a.fetcher.arnType(result.arn); t != RoleArn && t != AssumedRoleArn {
+			continue
+		}
+		statements, err := a.fetcher.TrustPolicy(a.ctx, result.arn)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", result.arn, a.describe(err)))
+			continue
+		}
+		fmt.Fprintln(w)
+		presentTrustPolicy(w, result.arn, statements, verify, current)
+	}
+	return warnings
+}
+
+func presentWarnings(warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+	yellow := color.New(color.FgYellow).SprintFunc()
+	fmt.Fprintf(os.Stderr, "\n%s\n", yellow("warnings:"))
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "  %s\n", warning)
+	}
+}
+
+// presentRunSummary prints a line counting what was shown to stderr, in a
+// fixed form for scripts to check, unless --no-summary, --quiet or --tui.
+func (opts *showOptions) presentRunSummary(policies, statements, warnings, errors int) {
+	if opts.noSummary || opts.quiet || opts.tui {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "iam-show: %d policies, %d statements, %d warnings, %d errors\n", policies, statements, warnings, errors)
+}
+
+type principalResult struct {
+	arn        string
+	statements []Statement
+	err        error
+	streamed   bool
+}
+
+// shown reports whether the statements of the result were printed, which
+// they are unless it failed outright.
+func (r principalResult) shown() bool {
+	var partial *PartialError
+	return r.err == nil || errors.As(r.err, &partial)
+}
+
+// streamOne resolves and fetches a single target, calling header with its
+// arn and then handing statements to sink as they arrive. The result holds
+// them too, but they have been printed.
+func streamOne(ctx context.Context, fetcher *Fetcher, target string, header func(arn string), sink StatementSink) principalResult {
+	arn, err := fetcher.ResolveName(ctx, target)
+	if err != nil {
+		return principalResult{arn: target, err: err}
+	}
+	header(arn)
+	statements, err := fetcher.StreamStatements(ctx, arn, sink)
+	return principalResult{arn: arn, statements: statements, err: err, streamed: true}
+}
+
+// fetchAll resolves and fetches every target concurrently, returning the
+// results in the same order as targets.
+func fetchAll(ctx context.Context, fetcher *Fetcher, targets []string) []principalResult {
+	results := make([]principalResult, len(targets))
+	fetcher.progress.AddPrincipals(len(targets))
+
+	var g errgroup.Group
+	g.SetLimit(fetcher.concurrencyLimit())
+	for i, target := range targets {
+		i, target := i, target
+		g.Go(func() error {
+			defer fetcher.progress.PrincipalDone()
+
+			arn, err := fetcher.ResolveName(ctx, target)
+			if err != nil {
+				results[i] = principalResult{arn: target, err: err}
+				return nil
+			}
+			statements, err := fetcher.FetchStatements(ctx, arn)
+			results[i] = principalResult{arn: arn, statements: statements, err: err}
+			return nil
+		})
+	}
+	g.Wait()
+
+	return results
+}
+
+// readTargets reads one arn or name per line from path, or from stdin when
+// path is "-". Blank lines and lines starting with # are ignored.
+func readTargets(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening arn file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	targets := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading arn file: %w", err)
+	}
+	return targets, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestApp() *app {
+	return &app{opts: &globalOptions{noProgress: true}, ctx: context.Background(), cancel: func() {}, fetcher: newTestFetcher(newFakeIAM())}
+}
+
+// showJSON runs the fetching and printing of show for targets, as
+// `show --output json` does, returning what it printed.
+func showJSON(t *testing.T, opts *showOptions, targets ...string) []byte {
+	t.Helper()
+	a := newTestApp()
+	var buf bytes.Buffer
+	presenter, err := opts.newPresenter(a.opts, &buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := opts.fetchResults(a, nil, presenter, targets)
+	if failed, _, err := opts.printResults(a.opts, a, presenter, results); err != nil || failed > 0 {
+		t.Fatalf("printing results: %d failed, %v", failed, err)
+	}
+	return buf.Bytes()
+}
+
+func TestShowDocumentNamesPrincipal(t *testing.T) {
+	for _, format := range []string{"json", "rego-data"} {
+		t.Run(format, func(t *testing.T) {
+			data := showJSON(t, &showOptions{output: format, sort: "policy", jsonVersion: 1, quiet: true}, "app")
+			var document regoDocument
+			if err := json.Unmarshal(data, &document); err != nil {
+				t.Fatalf("decoding %s: %v", data, err)
+			}
+			if len(document.Principals) != 1 {
+				t.Fatalf("printed %d principals, want 1", len(document.Principals))
+			}
+			if p := document.Principals[0]; p.Principal != "arn:aws:iam::111111111111:role/app" || p.Account != "111111111111" {
+				t.Errorf("printed principal %q in account %q", p.Principal, p.Account)
+			}
+		})
+	}
+}
+
+func TestShowOutputDirNamesPrincipal(t *testing.T) {
+	dir := t.TempDir()
+	showJSON(t, &showOptions{output: "json", sort: "policy", jsonVersion: 1, quiet: true, outputDir: dir}, "app")
+	data, err := os.ReadFile(filepath.Join(dir, "111111111111-role-app.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document regoDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Principals) != 1 || document.Principals[0].Principal != "arn:aws:iam::111111111111:role/app" {
+		t.Errorf("wrote %s, want the principal named", data)
+	}
+}
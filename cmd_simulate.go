@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+type simulateOptions struct {
+	actions   []string
+	resources []string
+	context   []string
+	owner     string
+	callerArn string
+	noPolicy  bool
+}
+
+func newSimulateCommand(global *globalOptions) *cobra.Command {
+	opts := &simulateOptions{}
+	cmd := &cobra.Command{
+		Use:   "simulate [arn or name] --action service:action",
+		Short: "Ask the IAM policy simulator whether a role or user is allowed actions on resources",
+		Long: "Run the IAM policy simulator for each --action on each --resource, or on every resource without\n" +
+			"--resource. The policy of each s3 bucket, sqs queue and sns topic given is fetched and included,\n" +
+			"so that bucket policies and cross-account grants count towards the decision.\n\n" +
+			"The simulator evaluates the principal of a resource policy against an IAM user, so including\n" +
+			"one for a role needs --caller-arn; without it the resource policy is left out. Bucket arns do\n" +
+			"not say which account owns the bucket, which is taken to be the caller's unless --resource-owner\n" +
+			"says otherwise.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSimulate(cmd.Context(), global, opts, args)
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringSliceVar(&opts.actions, "action", nil, "action to simulate, such as s3:GetObject; repeat or separate with commas for several")
+	flags.StringSliceVar(&opts.resources, "resource", nil, "arn of a resource to simulate the actions on; repeat or separate with commas for several")
+	flags.StringSliceVar(&opts.context, "context", nil, "condition key values of the request, e.g. aws:SourceIp=10.0.0.5,aws:MultiFactorAuthPresent=true")
+	flags.StringVar(&opts.owner, "resource-owner", "", "account id owning the resources, for buckets in another account than the caller's")
+	flags.StringVar(&opts.callerArn, "caller-arn", "", "arn of the IAM user the principal of resource policies is evaluated against, needed to include them for roles")
+	flags.BoolVar(&opts.noPolicy, "no-resource-policies", false, "do not fetch and include the policies of the resources")
+	registerTargetCompletion(cmd, global)
+	return cmd
+}
+
+func runSimulate(ctx context.Context, global *globalOptions, opts *simulateOptions, targets []string) error {
+	if len(opts.actions) == 0 {
+		return fmt.Errorf("simulate needs --action")
+	}
+	for _, action := range opts.actions {
+		if !actionGrammar.MatchString(action) {
+			return fmt.Errorf("--action %q is not an action, which look like service:action", action)
+		}
+	}
+	requestCtx, err := parseRequestContext(opts.context)
+	if err != nil {
+		return err
+	}
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+
+	arns, err := resolvePrincipals(a, targets)
+	if err != nil {
+		return err
+	}
+	arn := arns[0]
+	principalType := a.fetcher.arnType(arn)
+	if principalType != RoleArn && principalType != UserArn {
+		return fmt.Errorf("%s is not a role or user", arn)
+	}
+	owner := opts.owner
+	if owner != "" && !strings.HasPrefix(owner, "arn:") {
+		owner = fmt.Sprintf("arn:%s:iam::%s:root", a.partition(), owner)
+	}
+	resources := opts.resources
+	if len(resources) == 0 {
+		resources = []string{"*"}
+	}
+
+	client := iam.NewFromConfig(a.cfg, a.opts.pinIAM)
+	results := []types.EvaluationResult{}
+	policies := map[string]string{}
+	for _, resource := range resources {
+		input := &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(arn),
+			ActionNames:     opts.actions,
+			ContextEntries:  contextEntries(requestCtx),
+		}
+		if opts.callerArn != "" {
+			input.CallerArn = aws.String(opts.callerArn)
+		}
+		if owner != "" {
+			input.ResourceOwner = aws.String(owner)
+		}
+		if resource != "*" {
+			input.ResourceArns = []string{resource}
+		}
+		policy := resourcePolicy{}
+		if resource != "*" && !opts.noPolicy {
+			if policy, err = fetchResourcePolicy(a.ctx, a.cfg, resource); err != nil {
+				logger.Warn("could not get resource policy, simulating without it", "resource", resource, "error", a.describe(err))
+			}
+		}
+		if policy.kind != "" && principalType == RoleArn && opts.callerArn == "" {
+			logger.Warn("leaving out resource policy, which needs --caller-arn to be simulated for a role", "resource", resource, "policy", policy.kind)
+			policy = resourcePolicy{}
+		}
+		if policy.kind != "" {
+			policies[resource] = policy.kind
+			input.ResourcePolicy = aws.String(policy.document)
+			if input.ResourceOwner == nil && policy.owner != "" {
+				input.ResourceOwner = aws.String(policy.owner)
+			}
+		}
+		paginator := iam.NewSimulatePrincipalPolicyPaginator(client, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(a.ctx)
+			if err != nil {
+				return fmt.Errorf("simulating %s: %w", arn, a.describe(err))
+			}
+			results = append(results, page.EvaluationResults...)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tRESOURCE\tDECISION\tRESOURCE POLICY\tMATCHED")
+	denied := 0
+	missing := map[string]bool{}
+	for _, result := range results {
+		resource := aws.ToString(result.EvalResourceName)
+		policy := "-"
+		if kind, ok := policies[resource]; ok {
+			policy = kind
+		}
+		if result.EvalDecision != types.PolicyEvaluationDecisionTypeAllowed {
+			denied++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", aws.ToString(result.EvalActionName), resource, result.EvalDecision, policy, matchedPolicies(result.MatchedStatements))
+		for _, key := range result.MissingContextValues {
+			missing[key] = true
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		keys := []string{}
+		for key := range missing {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		faint := color.New(color.Faint).SprintFunc()
+		fmt.Fprintln(os.Stderr, faint("the decisions depend on context keys missing from --context: "+strings.Join(keys, ", ")))
+	}
+	if denied > 0 {
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d requests are denied", denied, len(results))}
+	}
+	return nil
+}
+
+// matchedPolicies names the distinct policies of the statements the
+// simulator matched, or - for none.
+func matchedPolicies(statements []types.Statement) string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, s := range statements {
+		id := aws.ToString(s.SourcePolicyId)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		names = append(names, id)
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// contextEntries turns a request context into simulator context entries,
+// guessing the type of each key from its values: booleans, numbers, dates,
+// ip addresses or ranges, or otherwise strings, as lists for keys with more
+// than one value.
+func contextEntries(ctx requestContext) []types.ContextEntry {
+	keys := []string{}
+	for key := range ctx {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := []types.ContextEntry{}
+	for _, key := range keys {
+		values := ctx[key]
+		keyType := contextKeyType(values)
+		if len(values) > 1 {
+			keyType += "List"
+		}
+		entries = append(entries, types.ContextEntry{
+			ContextKeyName:   aws.String(key),
+			ContextKeyType:   keyType,
+			ContextKeyValues: values,
+		})
+	}
+	return entries
+}
+
+func contextKeyType(values []string) types.ContextKeyTypeEnum {
+	every := func(matches func(string) bool) bool {
+		for _, v := range values {
+			if !matches(v) {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case every(func(v string) bool { return v == "true" || v == "false" }):
+		return types.ContextKeyTypeEnumBoolean
+	case every(func(v string) bool { _, err := strconv.ParseFloat(v, 64); return err == nil }):
+		return types.ContextKeyTypeEnumNumeric
+	case every(func(v string) bool { _, err := time.Parse(time.RFC3339, v); return err == nil }):
+		return types.ContextKeyTypeEnumDate
+	case every(func(v string) bool {
+		_, _, err := net.ParseCIDR(v)
+		return err == nil || net.ParseIP(v) != nil
+	}):
+		return types.ContextKeyTypeEnumIp
+	}
+	return types.ContextKeyTypeEnumString
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type snapshotOptions struct {
+	store string
+}
+
+func (o *snapshotOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.store, "store", "", "directory snapshots are kept in (defaults to iam-show/snapshots in the user config directory)")
+}
+
+func (o *snapshotOptions) openStore() (*snapshotStore, error) {
+	dir := o.store
+	if dir == "" {
+		var err error
+		dir, err = defaultSnapshotDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &snapshotStore{dir: dir}, nil
+}
+
+// principalKey returns the arn snapshots of arn are stored under. Assumed
+// role sessions are stored under their role, so that history survives new
+// sessions.
+func principalKey(f *Fetcher, arn string) string {
+	if f.arnType(arn) != AssumedRoleArn {
+		return arn
+	}
+	roleName, err := principalName(arn)
+	if err != nil {
+		return arn
+	}
+	parsed, _ := awsarn.Parse(arn)
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", parsed.Partition, parsed.AccountID, roleName)
+}
+
+// resolvePrincipals resolves names to arns, using the caller identity when
+// there are no targets.
+func resolvePrincipals(a *app, targets []string) ([]string, error) {
+	if len(targets) == 0 {
+		arn, err := a.fetcher.CallerArn(a.ctx)
+		if err != nil {
+			return nil, a.describe(err)
+		}
+		return []string{principalKey(a.fetcher, arn)}, nil
+	}
+
+	arns := []string{}
+	for _, target := range targets {
+		arn, err := a.fetcher.ResolveName(a.ctx, target)
+		if err != nil {
+			return nil, a.describe(err)
+		}
+		arns = append(arns, principalKey(a.fetcher, arn))
+	}
+	return arns, nil
+}
+
+func newSnapshotCommand(global *globalOptions) *cobra.Command {
+	opts := &snapshotOptions{}
+	notify := &notifyOptions{}
+	cmd := &cobra.Command{
+		Use:   "snapshot [arn or name...]",
+		Short: "Save the current statements of principals for later comparison",
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSnapshot(cmd.Context(), global, opts, notify, args)
+		},
+	}
+	opts.addFlags(cmd.Flags())
+	notify.addFlags(cmd.Flags())
+	registerTargetCompletion(cmd, global)
+	return cmd
+}
+
+func runSnapshot(ctx context.Context, global *globalOptions, opts *snapshotOptions, notify *notifyOptions, targets []string) error {
+	store, err := opts.openStore()
+	if err != nil {
+		return err
+	}
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+
+	arns, err := resolvePrincipals(a, targets)
+	if err != nil {
+		return err
+	}
+
+	a.startProgress()
+	results := fetchAll(a.ctx, a.fetcher, arns)
+	a.fetcher.progress.Stop()
+
+	notifier := notify.newNotifier(a.cfg)
+	takenAt := time.Now()
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			// a partial snapshot would show up as removed statements later
+			logger.Warn("could not snapshot principal", "arn", result.arn, "error", a.describe(result.err))
+			failed++
+			continue
+		}
+		if err := notifySnapshotDrift(a.ctx, store, notifier, result.arn, takenAt, result.statements); err != nil {
+			logger.Warn("could not send change notification", "arn", result.arn, "error", err)
+		}
+		if err := store.Save(result.arn, takenAt, result.statements); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "saved snapshot of %s (%d statements)\n", result.arn, len(result.statements))
+	}
+
+	if failed > 0 {
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d arns failed", failed, len(results))}
+	}
+	return nil
+}
+
+// notifySnapshotDrift compares statements with the latest stored snapshot of
+// principal and notifies when they differ. The first snapshot of a principal
+// is never a change.
+func notifySnapshotDrift(ctx context.Context, store *snapshotStore, notifier *notifier, principal string, at time.Time, statements []Statement) error {
+	if notifier == nil {
+		return nil
+	}
+	snapshots, err := store.List(principal)
+	if err != nil || len(snapshots) == 0 {
+		return err
+	}
+	diff := DiffStatements(snapshots[len(snapshots)-1].statements(), statements)
+	if diff.Empty() {
+		return nil
+	}
+	return notifier.Notify(ctx, newDriftEvent(principal, at, diff))
+}
+
+type historyOptions struct {
+	snapshotOptions
+	patch bool
+}
+
+func newHistoryCommand(global *globalOptions) *cobra.Command {
+	opts := &historyOptions{}
+	cmd := &cobra.Command{
+		Use:   "history <arn or name>",
+		Short: "List the snapshots of a principal and what changed between them",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHistory(cmd.Context(), global, opts, args[0])
+		},
+	}
+	opts.addFlags(cmd.Flags())
+	cmd.Flags().BoolVarP(&opts.patch, "patch", "p", false, "print the statements that changed between snapshots")
+	registerTargetCompletion(cmd, global)
+	return cmd
+}
+
+func runHistory(ctx context.Context, global *globalOptions, opts *historyOptions, target string) error {
+	store, err := opts.openStore()
+	if err != nil {
+		return err
+	}
+
+	arn := target
+	if !strings.HasPrefix(target, "arn:") {
+		a, err := global.newApp(ctx)
+		if err != nil {
+			return err
+		}
+		defer a.cancel()
+		arns, err := resolvePrincipals(a, []string{target})
+		if err != nil {
+			return err
+		}
+		arn = arns[0]
+	}
+
+	snapshots, err := store.List(arn)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return fmt.Errorf("no snapshots of %s in %s", arn, store.dir)
+	}
+
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	for i, snap := range snapshots {
+		line := fmt.Sprintf("%s  %d statements", snap.TakenAt.Local().Format(time.RFC3339), len(snap.Statements))
+		if i == 0 {
+			fmt.Println(line)
+			continue
+		}
+		diff := DiffStatements(snapshots[i-1].statements(), snap.statements())
+		if diff.Empty() {
+			fmt.Printf("%s  unchanged\n", line)
+			continue
+		}
+		fmt.Printf("%s  %s %s\n", line, green(fmt.Sprintf("+%d", len(diff.Added))), red(fmt.Sprintf("-%d", len(diff.Removed))))
+		if opts.patch {
+			presentPrefixed(os.Stdout, color.New(color.FgGreen).Sprint("  + "), diff.Added)
+			presentPrefixed(os.Stdout, color.New(color.FgRed).Sprint("  - "), diff.Removed)
+		}
+	}
+	return nil
+}
+
+type diffOptions struct {
+	snapshotOptions
+	since     string
+	terraform string
+	tui       bool
+}
+
+func newDiffCommand(global *globalOptions) *cobra.Command {
+	opts := &diffOptions{}
+	cmd := &cobra.Command{
+		Use:   "diff <arn or name> [arn or name]",
+		Short: "Compare the statements of two principals, or of one principal now and in a snapshot",
+		Long: "Compare the statements of two principals, or with --since the statements of one principal now\n" +
+			"against its latest snapshot taken at or before that time. With --from-terraform, compare the\n" +
+			"IAM policies in a plan before and after it is applied.",
+		Args: cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDiff(cmd.Context(), global, opts, args)
+		},
+	}
+	opts.addFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.since, "since", "", "compare against the snapshot at this date or time, e.g. 2024-01-01")
+	cmd.Flags().StringVar(&opts.terraform, "from-terraform", "", "compare the IAM policies in a terraform show -json plan file before and after it is applied")
+	cmd.Flags().BoolVar(&opts.tui, "tui", false, "browse the changed statements side by side in an interactive terminal UI")
+	registerTargetCompletion(cmd, global)
+	return cmd
+}
+
+func runDiff(ctx context.Context, global *globalOptions, opts *diffOptions, targets []string) error {
+	if opts.terraform != "" {
+		if len(targets) > 0 || opts.since != "" {
+			return errors.New("--from-terraform takes no principals or --since")
+		}
+		return runTerraformDiff(opts.terraform, opts.tui)
+	}
+	if opts.since == "" && len(targets) != 2 {
+		return errors.New("diff needs two principals, or one and --since")
+	}
+	if opts.since != "" && len(targets) != 1 {
+		return errors.New("--since compares a single principal against its snapshot")
+	}
+
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+
+	arns, err := resolvePrincipals(a, targets)
+	if err != nil {
+		return err
+	}
+
+	var before []Statement
+	var title string
+	if opts.since != "" {
+		since, err := parseSince(opts.since)
+		if err != nil {
+			return err
+		}
+		store, err := opts.openStore()
+		if err != nil {
+			return err
+		}
+		snap, err := store.At(arns[0], since)
+		if err != nil {
+			return err
+		}
+		before = snap.statements()
+		title = fmt.Sprintf("%s since %s", arns[0], snap.TakenAt.Local().Format(time.RFC3339))
+		arns = arns[:1]
+	}
+
+	a.startProgress()
+	results := fetchAll(a.ctx, a.fetcher, arns)
+	a.fetcher.progress.Stop()
+	for _, result := range results {
+		if result.err != nil {
+			return fmt.Errorf("%s: %w", result.arn, a.describe(result.err))
+		}
+	}
+
+	after := results[0].statements
+	if len(results) == 2 {
+		before, after = results[0].statements, results[1].statements
+		title = fmt.Sprintf("%s -> %s", results[0].arn, results[1].arn)
+	}
+
+	diff := DiffStatements(before, after)
+	if diff.Empty() {
+		fmt.Fprintf(os.Stderr, "no differences: %s\n", title)
+		return nil
+	}
+	if opts.tui {
+		return runDiffTUI([]tuiDiffSection{{title: title, diff: diff}})
+	}
+	presentDiff(os.Stdout, title, diff)
+	return nil
+}
+
+func runTerraformDiff(path string, tui bool) error {
+	diffs, err := terraformChanges(path)
+	if err != nil {
+		return err
+	}
+	if len(diffs) == 0 {
+		fmt.Fprintf(os.Stderr, "no IAM policy changes in %s\n", path)
+		return nil
+	}
+	if tui {
+		sections := []tuiDiffSection{}
+		for _, d := range diffs {
+			sections = append(sections, tuiDiffSection{title: d.address, diff: d.diff})
+		}
+		return runDiffTUI(sections)
+	}
+	for _, d := range diffs {
+		presentDiff(os.Stdout, d.address, d.diff)
+	}
+	return nil
+}
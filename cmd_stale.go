@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+type staleOptions struct {
+	days       int
+	pathPrefix string
+	accounts   accountOptions
+}
+
+func newStaleCommand(global *globalOptions) *cobra.Command {
+	opts := &staleOptions{}
+	cmd := &cobra.Command{
+		Use:   "stale",
+		Short: "List roles and users not used within a number of days, to clean them up",
+		Long: "List the roles and users that have not been used within --days: roles by when IAM last saw them\n" +
+			"make a request, which it tracks for 400 days, and users by when they last used their password or\n" +
+			"either access key, from the account credential report. Principals never used count as stale\n" +
+			"once they are older than --days.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStale(cmd.Context(), global, opts)
+		},
+	}
+	cmd.Flags().IntVar(&opts.days, "days", 90, "list principals not used within this many days")
+	cmd.Flags().StringVar(&opts.pathPrefix, "path-prefix", "", "only look at roles and users under this path, e.g. /service-role/")
+	opts.accounts.addFlags(cmd.Flags())
+	return cmd
+}
+
+// stalePrincipal is a role or user not used within the days asked for.
+type stalePrincipal struct {
+	app      *app
+	c        Candidate
+	activity principalActivity
+}
+
+// accountStale are the stale principals of an account, and how many were
+// looked at and could not be.
+type accountStale struct {
+	app     *app
+	stale   []stalePrincipal
+	checked int
+	failed  int
+	err     error
+}
+
+func runStale(ctx context.Context, global *globalOptions, opts *staleOptions) error {
+	if opts.days < 1 {
+		return fmt.Errorf("--days must be at least 1, not %d", opts.days)
+	}
+	if global.source == "config" {
+		// every role would look stale
+		return errors.New("stale needs when roles were last used and created, which Config does not record: run it without --source config")
+	}
+	a, err := global.newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.cancel()
+
+	apps := []*app{a}
+	if opts.accounts.enabled() {
+		if apps, err = opts.accounts.apps(a); err != nil {
+			return err
+		}
+	}
+	opts.accounts.resolveNames(apps)
+	now := time.Now()
+	cutoff := now.AddDate(0, 0, -opts.days)
+	listed := make([]accountStale, len(apps))
+	var g errgroup.Group
+	for i, accountApp := range apps {
+		i, accountApp := i, accountApp
+		g.Go(func() error {
+			listed[i] = staleAccount(accountApp, opts.pathPrefix, cutoff)
+			return nil
+		})
+	}
+	g.Wait()
+
+	stale := []stalePrincipal{}
+	failedAccounts, checked, failed := 0, 0, 0
+	for _, l := range listed {
+		if l.err != nil {
+			if len(apps) == 1 {
+				return a.describe(l.err)
+			}
+			logger.Warn("could not list account", "account", l.app.account, "error", a.describe(l.err))
+			failedAccounts++
+			continue
+		}
+		stale = append(stale, l.stale...)
+		checked += l.checked
+		failed += l.failed
+	}
+	// never used first, then the longest unused
+	sort.SliceStable(stale, func(i, j int) bool {
+		ti, tj := stale[i].activity.lastUsed, stale[j].activity.lastUsed
+		if ti.IsZero() != tj.IsZero() {
+			return ti.IsZero()
+		}
+		return ti.Before(tj)
+	})
+
+	account := ""
+	if opts.accounts.enabled() {
+		account = "ACCOUNT\t"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, account+"KIND\tNAME\tLAST USED\tVIA\tCREATED\tARN")
+	for _, s := range stale {
+		used, via := "never", "-"
+		if !s.activity.lastUsed.IsZero() {
+			used = daysAgo(s.activity.lastUsed, now)
+		}
+		if s.activity.via != "" {
+			via = s.activity.via
+		}
+		created := "-"
+		if !s.activity.created.IsZero() {
+			created = daysAgo(s.activity.created, now)
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\n", accountColumn(s.app), s.c.Kind, s.c.Name, used, via, created, arnColumn(s.app, s.c.Arn))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	faint := color.New(color.Faint).SprintFunc()
+	fmt.Fprintln(os.Stderr, faint(fmt.Sprintf("%d of %d roles and users not used in %d days", len(stale), checked, opts.days)))
+
+	switch {
+	case failed > 0:
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d principals could not be checked", failed, checked+failed)}
+	case failedAccounts > 0:
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d accounts could not be listed", failedAccounts, len(apps))}
+	}
+	return nil
+}
+
+// staleAccount finds the roles and users of the account of a not used since
+// cutoff. Roles are each fetched for when they were last used, and users
+// read from the credential report, counting them all as failed without it.
+func staleAccount(a *app, pathPrefix string, cutoff time.Time) accountStale {
+	roles, err := a.fetcher.listRoleCandidates(a.ctx, pathPrefix)
+	if err != nil {
+		return accountStale{app: a, err: err}
+	}
+	users, err := a.fetcher.listUserCandidates(a.ctx, pathPrefix)
+	if err != nil {
+		return accountStale{app: a, err: err}
+	}
+	result := accountStale{app: a}
+	var report map[string]credentialEntry
+	if len(users) > 0 {
+		if report, err = fetchCredentialReport(a.ctx, a.fetcher.client); err != nil {
+			logger.Warn("could not get the credential report to check users", "error", a.describe(err))
+			result.failed += len(users)
+			users = nil
+		}
+	}
+	var mu sync.Mutex
+	record := func(c Candidate, activity principalActivity, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			logger.Warn("could not check when principal was last used", "arn", c.Arn, "error", a.describe(err))
+			result.failed++
+			return
+		}
+		result.checked++
+		if activity.unusedSince(cutoff) {
+			result.stale = append(result.stale, stalePrincipal{app: a, c: c, activity: activity})
+		}
+	}
+	var g errgroup.Group
+	g.SetLimit(a.fetcher.concurrencyLimit())
+	for _, c := range roles {
+		c := c
+		g.Go(func() error {
+			activity, err := a.fetcher.roleActivity(a.ctx, c.Name)
+			record(c, activity, err)
+			return nil
+		})
+	}
+	g.Wait()
+	for _, c := range users {
+		entry, ok := report[c.Arn]
+		if !ok {
+			record(c, principalActivity{}, fmt.Errorf("user %s is not in the credential report", c.Name))
+			continue
+		}
+		record(c, userActivity(entry), nil)
+	}
+	return result
+}
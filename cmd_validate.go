@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func newValidateCommand(global *globalOptions) *cobra.Command {
+	var policyFiles []string
+	cmd := &cobra.Command{
+		Use:   "validate [policy file...]",
+		Short: "Check policy documents against the IAM policy grammar without calling AWS",
+		Long: "Check that local policy documents are valid JSON and follow the IAM policy grammar: the Version,\n" +
+			"the spelling and types of every element, and the elements each statement needs. Nothing is sent\n" +
+			"to AWS, so it can run as a pre-commit hook. Exits with code 1 when any document has errors;\n" +
+			"warnings alone do not fail.",
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runValidate(append(policyFiles, args...))
+		},
+	}
+	cmd.Flags().StringSliceVar(&policyFiles, "policy-file", nil, "policy document to validate, or - for stdin; repeat for several")
+	return cmd
+}
+
+func runValidate(paths []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("validate needs a policy file, as an argument or with --policy-file")
+	}
+	invalid := 0
+	for _, path := range paths {
+		var document []byte
+		var err error
+		if path == "-" {
+			document, err = io.ReadAll(os.Stdin)
+		} else {
+			document, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return fmt.Errorf("reading policy file: %w", err)
+		}
+		problems := validatePolicy(document)
+		presentProblems(os.Stdout, path, problems)
+		for _, p := range problems {
+			if !p.warning {
+				invalid++
+				break
+			}
+		}
+		if len(problems) == 0 {
+			fmt.Fprintf(os.Stderr, "valid: %s\n", path)
+		}
+	}
+	if invalid > 0 {
+		return &exitCodeError{code: exitFailed, msg: fmt.Sprintf("%d of %d policy files are invalid", invalid, len(paths))}
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestContext holds the condition key values of a request, by lowercase
+// key, since condition keys are case insensitive.
+type requestContext map[string][]string
+
+// parseRequestContext parses key=value pairs. Repeating a key gives it
+// several values, as for aws:TagKeys.
+func parseRequestContext(pairs []string) (requestContext, error) {
+	ctx := requestContext{}
+	for _, pair := range pairs {
+		key, value, found := strings.Cut(pair, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid context %q, expected key=value", pair)
+		}
+		key = strings.ToLower(key)
+		ctx[key] = append(ctx[key], value)
+	}
+	return ctx, nil
+}
+
+// withRequestTime adds aws:CurrentTime and aws:EpochTime, which every
+// request carries, unless ctx already has them.
+func (ctx requestContext) withRequestTime(now time.Time) requestContext {
+	if _, ok := ctx["aws:currenttime"]; !ok {
+		ctx["aws:currenttime"] = []string{now.UTC().Format(time.RFC3339)}
+	}
+	if _, ok := ctx["aws:epochtime"]; !ok {
+		ctx["aws:epochtime"] = []string{strconv.FormatInt(now.Unix(), 10)}
+	}
+	return ctx
+}
+
+// conditionClause is one operator and key of a condition, with whether the
+// request context satisfies it.
+type conditionClause struct {
+	operator string
+	key      string
+	values   []string
+	passed   bool
+	// reason explains a failure, or a pass that is not a plain match
+	reason string
+}
+
+// clauses lists every operator and key of the condition in a stable order,
+// without evaluating them.
+func (c Condition) clauses() []conditionClause {
+	operators := []string{}
+	for operator := range c {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	clauses := []conditionClause{}
+	for _, operator := range operators {
+		keys := []string{}
+		for key := range c[operator] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			clauses = append(clauses, conditionClause{operator: operator, key: key, values: c[operator][key]})
+		}
+	}
+	return clauses
+}
+
+// evaluate checks every clause of the condition against ctx. The condition
+// holds when every clause passes.
+func (c Condition) evaluate(ctx requestContext) []conditionClause {
+	clauses := c.clauses()
+	for i, clause := range clauses {
+		clauses[i].passed, clauses[i].reason = evaluateClause(clause.operator, clause.key, clause.values, ctx)
+	}
+	return clauses
+}
+
+// holds reports whether the condition is satisfied by ctx.
+func (c Condition) holds(ctx requestContext) bool {
+	for _, clause := range c.evaluate(ctx) {
+		if !clause.passed {
+			return false
+		}
+	}
+	return true
+}
+
+func evaluateClause(operator, key string, values []string, ctx requestContext) (bool, string) {
+	actual, present := ctx[strings.ToLower(key)]
+	substituted := []string{}
+	for _, v := range values {
+		substituted = append(substituted, substitutePolicyVariables(v, ctx))
+	}
+	values = substituted
+
+	if operator == "Null" {
+		if len(values) != 1 {
+			return false, "Null takes a single true or false"
+		}
+		wantAbsent := strings.EqualFold(values[0], "true")
+		if wantAbsent == !present {
+			return true, ""
+		}
+		if present {
+			return false, "key is in the context"
+		}
+		return false, "key is not in the context"
+	}
+
+	base := operator
+	forAll := strings.HasPrefix(base, "ForAllValues:")
+	base = strings.TrimPrefix(strings.TrimPrefix(base, "ForAllValues:"), "ForAnyValue:")
+	ifExists := strings.HasSuffix(base, "IfExists")
+	base = strings.TrimSuffix(base, "IfExists")
+
+	match, negated, ok := conditionOperators(base)
+	if !ok {
+		return false, "unsupported operator " + operator
+	}
+	if !present {
+		switch {
+		case ifExists:
+			return true, "key is not in the context"
+		case forAll:
+			return true, "key is not in the context, so every value matches"
+		case negated:
+			return true, "key is not in the context"
+		}
+		return false, "key is not in the context"
+	}
+
+	matchesAny := func(v string) bool {
+		for _, want := range values {
+			if match(want, v) {
+				return true
+			}
+		}
+		return false
+	}
+	var passed bool
+	switch {
+	case forAll:
+		passed = true
+		for _, v := range actual {
+			if matchesAny(v) == negated {
+				passed = false
+			}
+		}
+	case negated:
+		passed = true
+		for _, v := range actual {
+			if matchesAny(v) {
+				passed = false
+			}
+		}
+	default:
+		for _, v := range actual {
+			if matchesAny(v) {
+				passed = true
+			}
+		}
+	}
+	if passed {
+		return true, ""
+	}
+	return false, "got " + strings.Join(actual, ", ")
+}
+
+// conditionOperators returns the match function of a condition operator
+// without its IfExists suffix or set prefix, and whether it is negated.
+func conditionOperators(operator string) (match func(want, got string) bool, negated bool, ok bool) {
+	switch operator {
+	case "StringEquals", "StringNotEquals":
+		match = func(want, got string) bool { return want == got }
+	case "StringEqualsIgnoreCase", "StringNotEqualsIgnoreCase":
+		match = strings.EqualFold
+	case "StringLike", "StringNotLike":
+		match = resourceMatch
+	case "NumericEquals", "NumericNotEquals":
+		match = numericMatch(func(want, got float64) bool { return got == want })
+	case "NumericLessThan":
+		match = numericMatch(func(want, got float64) bool { return got < want })
+	case "NumericLessThanEquals":
+		match = numericMatch(func(want, got float64) bool { return got <= want })
+	case "NumericGreaterThan":
+		match = numericMatch(func(want, got float64) bool { return got > want })
+	case "NumericGreaterThanEquals":
+		match = numericMatch(func(want, got float64) bool { return got >= want })
+	case "DateEquals", "DateNotEquals":
+		match = dateMatch(func(want, got time.Time) bool { return got.Equal(want) })
+	case "DateLessThan":
+		match = dateMatch(func(want, got time.Time) bool { return got.Before(want) })
+	case "DateLessThanEquals":
+		match = dateMatch(func(want, got time.Time) bool { return !got.After(want) })
+	case "DateGreaterThan":
+		match = dateMatch(func(want, got time.Time) bool { return got.After(want) })
+	case "DateGreaterThanEquals":
+		match = dateMatch(func(want, got time.Time) bool { return !got.Before(want) })
+	case "Bool":
+		match = strings.EqualFold
+	case "BinaryEquals":
+		match = func(want, got string) bool { return want == got }
+	case "IpAddress", "NotIpAddress":
+		match = ipMatch
+	case "ArnEquals", "ArnLike", "ArnNotEquals", "ArnNotLike":
+		match = resourceMatch
+	default:
+		return nil, false, false
+	}
+	negated = strings.Contains(operator, "Not")
+	return match, negated, true
+}
+
+func numericMatch(compare func(want, got float64) bool) func(want, got string) bool {
+	return func(want, got string) bool {
+		w, err := strconv.ParseFloat(want, 64)
+		if err != nil {
+			return false
+		}
+		g, err := strconv.ParseFloat(got, 64)
+		if err != nil {
+			return false
+		}
+		return compare(w, g)
+	}
+}
+
+// parseConditionDate accepts the date formats IAM does: ISO 8601 dates and
+// times, and epoch seconds.
+func parseConditionDate(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0), true
+	}
+	return time.Time{}, false
+}
+
+func dateMatch(compare func(want, got time.Time) bool) func(want, got string) bool {
+	return func(want, got string) bool {
+		w, ok := parseConditionDate(want)
+		if !ok {
+			return false
+		}
+		g, ok := parseConditionDate(got)
+		if !ok {
+			return false
+		}
+		return compare(w, g)
+	}
+}
+
+func ipMatch(want, got string) bool {
+	ip := net.ParseIP(got)
+	if ip == nil {
+		return false
+	}
+	if !strings.Contains(want, "/") {
+		return ip.Equal(net.ParseIP(want))
+	}
+	_, network, err := net.ParseCIDR(want)
+	return err == nil && network.Contains(ip)
+}
+
+var policyVariable = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// substitutePolicyVariables replaces ${key} with its value in ctx, and the
+// escapes ${*}, ${?} and ${$} with their characters. Variables missing from
+// ctx are left as written.
+func substitutePolicyVariables(s string, ctx requestContext) string {
+	return policyVariable.ReplaceAllStringFunc(s, func(variable string) string {
+		name := variable[2 : len(variable)-1]
+		switch name {
+		case "*", "?", "$":
+			return name
+		}
+		if values, ok := ctx[strings.ToLower(name)]; ok && len(values) == 1 {
+			return values[0]
+		}
+		return variable
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import "strings"
+
+// globalConditionKeys are the aws: condition keys, which apply to every
+// action although not every request carries all of them.
+var globalConditionKeys = []string{
+	"aws:AssumedRoot",
+	"aws:CalledVia",
+	"aws:CalledViaFirst",
+	"aws:CalledViaLast",
+	"aws:ChatbotSourceArn",
+	"aws:CurrentTime",
+	"aws:Ec2InstanceSourcePrivateIPv4",
+	"aws:Ec2InstanceSourceVpc",
+	"aws:EpochTime",
+	"aws:FederatedProvider",
+	"aws:MultiFactorAuthAge",
+	"aws:MultiFactorAuthPresent",
+	"aws:PrincipalAccount",
+	"aws:PrincipalArn",
+	"aws:PrincipalIsAWSService",
+	"aws:PrincipalOrgID",
+	"aws:PrincipalOrgPaths",
+	"aws:PrincipalServiceName",
+	"aws:PrincipalServiceNamesList",
+	"aws:PrincipalTag/*",
+	"aws:PrincipalType",
+	"aws:Referer",
+	"aws:RequestedRegion",
+	"aws:RequestTag/*",
+	"aws:ResourceAccount",
+	"aws:ResourceOrgID",
+	"aws:ResourceOrgPaths",
+	"aws:ResourceTag/*",
+	"aws:SecureTransport",
+	"aws:SourceAccount",
+	"aws:SourceArn",
+	"aws:SourceIdentity",
+	"aws:SourceIp",
+	"aws:SourceOrgID",
+	"aws:SourceOrgPaths",
+	"aws:SourceVpc",
+	"aws:SourceVpcArn",
+	"aws:SourceVpce",
+	"aws:TagKeys",
+	"aws:TokenIssueTime",
+	"aws:UserAgent",
+	"aws:userid",
+	"aws:username",
+	"aws:ViaAWSService",
+	"aws:VpceAccount",
+	"aws:VpceOrgID",
+	"aws:VpceOrgPaths",
+	"aws:VpcSourceIp",
+}
+
+// crossServiceConditionKeys belong to one service but are set on requests
+// to any, such as the instance a role's credentials were delivered to.
+var crossServiceConditionKeys = []string{
+	"ec2:RoleDelivery",
+	"ec2:SourceInstanceARN",
+	"glue:CredentialIssuingService",
+	"glue:RoleAssumedBy",
+	"identitystore:UserId",
+	"lambda:SourceFunctionArn",
+	"ssm:SourceInstanceARN",
+}
+
+func matchConditionKey(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if wildcardMatch(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// federationConditionKey reports whether key is set by an identity
+// provider, such as saml:aud or token.actions.githubusercontent.com:sub.
+// Those are only checked by trust policies.
+func federationConditionKey(prefix string) bool {
+	return prefix == "saml" || strings.Contains(prefix, ".")
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// Configuration item resource types read by the AWS Config backend.
+const (
+	configRoleType   = "AWS::IAM::Role"
+	configUserType   = "AWS::IAM::User"
+	configPolicyType = "AWS::IAM::Policy"
+	configGroupType  = "AWS::IAM::Group"
+)
+
+type targetAccountKey struct{}
+
+// withTargetAccount records the account of the arn being fetched, so that
+// backends which see several accounts know which one a bare name is in.
+func withTargetAccount(ctx context.Context, arn string) context.Context {
+	parsed, err := awsarn.Parse(arn)
+	if err != nil || parsed.AccountID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, targetAccountKey{}, parsed.AccountID)
+}
+
+func targetAccount(ctx context.Context) string {
+	account, _ := ctx.Value(targetAccountKey{}).(string)
+	return account
+}
+
+// configItem is a configuration item as returned by an advanced query.
+type configItem struct {
+	AccountID     string          `json:"accountId"`
+	Arn           string          `json:"arn"`
+	ResourceName  string          `json:"resourceName"`
+	Configuration configIAMEntity `json:"configuration"`
+	Tags          []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"tags"`
+}
+
+func (item *configItem) iamTags() []types.Tag {
+	tags := []types.Tag{}
+	for _, tag := range item.Tags {
+		tags = append(tags, types.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)})
+	}
+	return tags
+}
+
+// configIAMEntity holds the fields of role, user and policy configuration
+// items that statements are built from. Documents are url encoded, as they
+// are in the IAM API.
+type configIAMEntity struct {
+	Path                     string               `json:"path"`
+	AssumeRolePolicyDocument string               `json:"assumeRolePolicyDocument"`
+	RolePolicyList           []configInlinePolicy `json:"rolePolicyList"`
+	UserPolicyList           []configInlinePolicy `json:"userPolicyList"`
+	GroupPolicyList          []configInlinePolicy `json:"groupPolicyList"`
+	GroupList                []string             `json:"groupList"`
+	AttachedManagedPolicies  []struct {
+		PolicyArn  string `json:"policyArn"`
+		PolicyName string `json:"policyName"`
+	} `json:"attachedManagedPolicies"`
+	PolicyName                    string `json:"policyName"`
+	DefaultVersionID              string `json:"defaultVersionId"`
+	AttachmentCount               int32  `json:"attachmentCount"`
+	PermissionsBoundaryUsageCount int32  `json:"permissionsBoundaryUsageCount"`
+	PolicyVersionList             []struct {
+		Document  string `json:"document"`
+		VersionID string `json:"versionId"`
+	} `json:"policyVersionList"`
+}
+
+type configInlinePolicy struct {
+	PolicyName     string `json:"policyName"`
+	PolicyDocument string `json:"policyDocument"`
+}
+
+// configIAM implements IAMAPI over the IAM configuration items recorded in
+// an AWS Config aggregator, so that every account in it can be read from the
+// aggregator account. AWS managed policies are not recorded by Config and
+// are read from IAM, where they are the same in every account.
+type configIAM struct {
+	client     *configservice.Client
+	iam        *iam.Client
+	aggregator string
+
+	mu    sync.Mutex
+	items map[string]*configItem
+}
+
+var _ IAMAPI = (*configIAM)(nil)
+
+func newConfigIAM(cfg aws.Config, aggregator string, optFns ...func(*iam.Options)) *configIAM {
+	return &configIAM{
+		client:     configservice.NewFromConfig(cfg),
+		iam:        iam.NewFromConfig(cfg, optFns...),
+		aggregator: aggregator,
+		items:      map[string]*configItem{},
+	}
+}
+
+// query runs an advanced query against the aggregator and returns every
+// matching item.
+func (c *configIAM) query(ctx context.Context, where string) ([]configItem, error) {
+	expression := "SELECT accountId, arn, resourceName, configuration, tags WHERE " + where
+	paginator := configservice.NewSelectAggregateResourceConfigPaginator(c.client, &configservice.SelectAggregateResourceConfigInput{
+		ConfigurationAggregatorName: aws.String(c.aggregator),
+		Expression:                  aws.String(expression),
+	})
+	items := []configItem{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("querying config aggregator %s: %w", c.aggregator, err)
+		}
+		for _, result := range page.Results {
+			var item configItem
+			if err := json.Unmarshal([]byte(result), &item); err != nil {
+				return nil, fmt.Errorf("decoding configuration item: %w", err)
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// queryValueChars are the characters of IAM names, paths and arns, which
+// have no quotes to escape in a query.
+var queryValueChars = regexp.MustCompile(`^[\w+=,.@:/-]*$`)
+
+// checkQueryValue refuses a value to put between quotes in a query that no
+// IAM name or arn could be.
+func checkQueryValue(value string) error {
+	if !queryValueChars.MatchString(value) {
+		return fmt.Errorf("%q is not an IAM name or arn", value)
+	}
+	return nil
+}
+
+// item returns the single configuration item of a resource type with the
+// given name, in the account of the arn being fetched when it is known.
+func (c *configIAM) item(ctx context.Context, resourceType, name string) (*configItem, error) {
+	account := targetAccount(ctx)
+	key := resourceType + "/" + account + "/" + name
+
+	c.mu.Lock()
+	cached, ok := c.items[key]
+	c.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	for _, value := range []string{name, account} {
+		if err := checkQueryValue(value); err != nil {
+			return nil, err
+		}
+	}
+	where := fmt.Sprintf("resourceType = '%s' AND resourceName = '%s'", resourceType, name)
+	if account != "" {
+		where += fmt.Sprintf(" AND accountId = '%s'", account)
+	}
+	items, err := c.query(ctx, where)
+	if err != nil {
+		return nil, err
+	}
+	switch len(items) {
+	case 0:
+		return nil, &types.NoSuchEntityException{Message: aws.String(fmt.Sprintf("no %s named %s in config aggregator %s", resourceType, name, c.aggregator))}
+	case 1:
+	default:
+		accounts := []string{}
+		for _, item := range items {
+			accounts = append(accounts, item.AccountID)
+		}
+		return nil, fmt.Errorf("%s %s exists in accounts %s, pass its arn instead", resourceType, name, strings.Join(accounts, ", "))
+	}
+
+	c.mu.Lock()
+	c.items[key] = &items[0]
+	c.mu.Unlock()
+	return &items[0], nil
+}
+
+// policyItem looks up a customer managed policy by arn.
+func (c *configIAM) policyItem(ctx context.Context, arn string) (*configItem, error) {
+	c.mu.Lock()
+	cached, ok := c.items[arn]
+	c.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	if err := checkQueryValue(arn); err != nil {
+		return nil, err
+	}
+	items, err := c.query(ctx, fmt.Sprintf("resourceType = '%s' AND arn = '%s'", configPolicyType, arn))
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, &types.NoSuchEntityException{Message: aws.String(fmt.Sprintf("policy %s not found in config aggregator %s", arn, c.aggregator))}
+	}
+
+	c.mu.Lock()
+	c.items[arn] = &items[0]
+	c.mu.Unlock()
+	return &items[0], nil
+}
+
+func isAWSManagedPolicy(arn string) bool {
+	return strings.Contains(arn, ":iam::aws:policy/")
+}
+
+func attachedPolicies(item *configItem) []types.AttachedPolicy {
+	attached := []types.AttachedPolicy{}
+	for _, p := range item.Configuration.AttachedManagedPolicies {
+		attached = append(attached, types.AttachedPolicy{PolicyArn: aws.String(p.PolicyArn), PolicyName: aws.String(p.PolicyName)})
+	}
+	return attached
+}
+
+func inlinePolicyNames(policies []configInlinePolicy) []string {
+	names := []string{}
+	for _, p := range policies {
+		names = append(names, p.PolicyName)
+	}
+	return names
+}
+
+func inlinePolicyDocument(item *configItem, policies []configInlinePolicy, name string) (*string, error) {
+	for _, p := range policies {
+		if p.PolicyName == name {
+			return aws.String(p.PolicyDocument), nil
+		}
+	}
+	return nil, &types.NoSuchEntityException{Message: aws.String(fmt.Sprintf("no inline policy %s on %s", name, item.Arn))}
+}
+
+func (c *configIAM) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	item, err := c.item(ctx, configRoleType, aws.ToString(params.RoleName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetRoleOutput{Role: &types.Role{Arn: aws.String(item.Arn), RoleName: aws.String(item.ResourceName), Path: aws.String(item.Configuration.Path),
+		AssumeRolePolicyDocument: aws.String(item.Configuration.AssumeRolePolicyDocument)}}, nil
+}
+
+func (c *configIAM) ListAttachedRolePolicies(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+	item, err := c.item(ctx, configRoleType, aws.ToString(params.RoleName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListAttachedRolePoliciesOutput{AttachedPolicies: attachedPolicies(item)}, nil
+}
+
+func (c *configIAM) ListRolePolicies(ctx context.Context, params *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+	item, err := c.item(ctx, configRoleType, aws.ToString(params.RoleName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListRolePoliciesOutput{PolicyNames: inlinePolicyNames(item.Configuration.RolePolicyList)}, nil
+}
+
+func (c *configIAM) GetRolePolicy(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error) {
+	item, err := c.item(ctx, configRoleType, aws.ToString(params.RoleName))
+	if err != nil {
+		return nil, err
+	}
+	document, err := inlinePolicyDocument(item, item.Configuration.RolePolicyList, aws.ToString(params.PolicyName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetRolePolicyOutput{PolicyName: params.PolicyName, RoleName: params.RoleName, PolicyDocument: document}, nil
+}
+
+func (c *configIAM) GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+	item, err := c.item(ctx, configUserType, aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetUserOutput{User: &types.User{Arn: aws.String(item.Arn), UserName: aws.String(item.ResourceName), Path: aws.String(item.Configuration.Path)}}, nil
+}
+
+func (c *configIAM) ListAttachedUserPolicies(ctx context.Context, params *iam.ListAttachedUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+	item, err := c.item(ctx, configUserType, aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListAttachedUserPoliciesOutput{AttachedPolicies: attachedPolicies(item)}, nil
+}
+
+func (c *configIAM) ListUserPolicies(ctx context.Context, params *iam.ListUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+	item, err := c.item(ctx, configUserType, aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListUserPoliciesOutput{PolicyNames: inlinePolicyNames(item.Configuration.UserPolicyList)}, nil
+}
+
+func (c *configIAM) GetUserPolicy(ctx context.Context, params *iam.GetUserPolicyInput, optFns ...func(*iam.Options)) (*iam.GetUserPolicyOutput, error) {
+	item, err := c.item(ctx, configUserType, aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	document, err := inlinePolicyDocument(item, item.Configuration.UserPolicyList, aws.ToString(params.PolicyName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetUserPolicyOutput{PolicyName: params.PolicyName, UserName: params.UserName, PolicyDocument: document}, nil
+}
+
+func (c *configIAM) ListGroupsForUser(ctx context.Context, params *iam.ListGroupsForUserInput, optFns ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error) {
+	item, err := c.item(ctx, configUserType, aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	groups := []types.Group{}
+	for _, name := range item.Configuration.GroupList {
+		groups = append(groups, types.Group{GroupName: aws.String(name)})
+	}
+	return &iam.ListGroupsForUserOutput{Groups: groups}, nil
+}
+
+func (c *configIAM) ListAttachedGroupPolicies(ctx context.Context, params *iam.ListAttachedGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedGroupPoliciesOutput, error) {
+	item, err := c.item(ctx, configGroupType, aws.ToString(params.GroupName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListAttachedGroupPoliciesOutput{AttachedPolicies: attachedPolicies(item)}, nil
+}
+
+func (c *configIAM) ListGroupPolicies(ctx context.Context, params *iam.ListGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListGroupPoliciesOutput, error) {
+	item, err := c.item(ctx, configGroupType, aws.ToString(params.GroupName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListGroupPoliciesOutput{PolicyNames: inlinePolicyNames(item.Configuration.GroupPolicyList)}, nil
+}
+
+func (c *configIAM) GetGroupPolicy(ctx context.Context, params *iam.GetGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.GetGroupPolicyOutput, error) {
+	item, err := c.item(ctx, configGroupType, aws.ToString(params.GroupName))
+	if err != nil {
+		return nil, err
+	}
+	document, err := inlinePolicyDocument(item, item.Configuration.GroupPolicyList, aws.ToString(params.PolicyName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetGroupPolicyOutput{PolicyName: params.PolicyName, GroupName: params.GroupName, PolicyDocument: document}, nil
+}
+
+// errNoCredentialReport is returned for the credential report, which
+// Config does not record.
+var errNoCredentialReport = errors.New("config aggregators do not record the credential report, run without --source config for it")
+
+func (c *configIAM) GenerateCredentialReport(ctx context.Context, params *iam.GenerateCredentialReportInput, optFns ...func(*iam.Options)) (*iam.GenerateCredentialReportOutput, error) {
+	return nil, errNoCredentialReport
+}
+
+func (c *configIAM) GetCredentialReport(ctx context.Context, params *iam.GetCredentialReportInput, optFns ...func(*iam.Options)) (*iam.GetCredentialReportOutput, error) {
+	return nil, errNoCredentialReport
+}
+
+func (c *configIAM) ListRoleTags(ctx context.Context, params *iam.ListRoleTagsInput, optFns ...func(*iam.Options)) (*iam.ListRoleTagsOutput, error) {
+	item, err := c.item(ctx, configRoleType, aws.ToString(params.RoleName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListRoleTagsOutput{Tags: item.iamTags()}, nil
+}
+
+func (c *configIAM) ListUserTags(ctx context.Context, params *iam.ListUserTagsInput, optFns ...func(*iam.Options)) (*iam.ListUserTagsOutput, error) {
+	item, err := c.item(ctx, configUserType, aws.ToString(params.UserName))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListUserTagsOutput{Tags: item.iamTags()}, nil
+}
+
+func (c *configIAM) ListPolicyTags(ctx context.Context, params *iam.ListPolicyTagsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyTagsOutput, error) {
+	item, err := c.policyItem(ctx, aws.ToString(params.PolicyArn))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.ListPolicyTagsOutput{Tags: item.iamTags()}, nil
+}
+
+func (c *configIAM) ListPolicyVersions(ctx context.Context, params *iam.ListPolicyVersionsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyVersionsOutput, error) {
+	arn := aws.ToString(params.PolicyArn)
+	if isAWSManagedPolicy(arn) {
+		return c.iam.ListPolicyVersions(ctx, params, optFns...)
+	}
+	item, err := c.policyItem(ctx, arn)
+	if err != nil {
+		return nil, err
+	}
+	versions := []types.PolicyVersion{}
+	for _, version := range item.Configuration.PolicyVersionList {
+		versions = append(versions, types.PolicyVersion{
+			VersionId:        aws.String(version.VersionID),
+			IsDefaultVersion: version.VersionID == item.Configuration.DefaultVersionID,
+		})
+	}
+	return &iam.ListPolicyVersionsOutput{Versions: versions}, nil
+}
+
+func (c *configIAM) GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	arn := aws.ToString(params.PolicyArn)
+	if isAWSManagedPolicy(arn) {
+		return c.iam.GetPolicy(ctx, params, optFns...)
+	}
+	item, err := c.policyItem(ctx, arn)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetPolicyOutput{Policy: &types.Policy{
+		Arn:              aws.String(item.Arn),
+		PolicyName:       aws.String(item.Configuration.PolicyName),
+		DefaultVersionId: aws.String(item.Configuration.DefaultVersionID),
+	}}, nil
+}
+
+func (c *configIAM) GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	arn := aws.ToString(params.PolicyArn)
+	if isAWSManagedPolicy(arn) {
+		return c.iam.GetPolicyVersion(ctx, params, optFns...)
+	}
+	item, err := c.policyItem(ctx, arn)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range item.Configuration.PolicyVersionList {
+		if version.VersionID == aws.ToString(params.VersionId) {
+			return &iam.GetPolicyVersionOutput{PolicyVersion: &types.PolicyVersion{
+				Document:  aws.String(version.Document),
+				VersionId: params.VersionId,
+			}}, nil
+		}
+	}
+	return nil, &types.NoSuchEntityException{Message: aws.String(fmt.Sprintf("version %s of %s not recorded by config", aws.ToString(params.VersionId), arn))}
+}
+
+// listItems lists every item of a resource type in the aggregator.
+func (c *configIAM) listItems(ctx context.Context, resourceType string) ([]configItem, error) {
+	return c.query(ctx, fmt.Sprintf("resourceType = '%s'", resourceType))
+}
+
+func (c *configIAM) ListRoles(ctx context.Context, params *iam.ListRolesInput, optFns ...func(*iam.Options)) (*iam.ListRolesOutput, error) {
+	items, err := c.listItems(ctx, configRoleType)
+	if err != nil {
+		return nil, err
+	}
+	roles := []types.Role{}
+	for _, item := range items {
+		if !strings.HasPrefix(item.Configuration.Path, aws.ToString(params.PathPrefix)) {
+			continue
+		}
+		roles = append(roles, types.Role{Arn: aws.String(item.Arn), RoleName: aws.String(item.ResourceName), Path: aws.String(item.Configuration.Path)})
+	}
+	return &iam.ListRolesOutput{Roles: roles}, nil
+}
+
+func (c *configIAM) ListUsers(ctx context.Context, params *iam.ListUsersInput, optFns ...func(*iam.Options)) (*iam.ListUsersOutput, error) {
+	items, err := c.listItems(ctx, configUserType)
+	if err != nil {
+		return nil, err
+	}
+	users := []types.User{}
+	for _, item := range items {
+		if !strings.HasPrefix(item.Configuration.Path, aws.ToString(params.PathPrefix)) {
+			continue
+		}
+		users = append(users, types.User{Arn: aws.String(item.Arn), UserName: aws.String(item.ResourceName), Path: aws.String(item.Configuration.Path)})
+	}
+	return &iam.ListUsersOutput{Users: users}, nil
+}
+
+// ListPolicies lists the customer managed policies recorded by Config, and
+// reads AWS managed policies from IAM, as Config does not record them.
+func (c *configIAM) ListPolicies(ctx context.Context, params *iam.ListPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+	if params.Scope == types.PolicyScopeTypeAws {
+		return c.iam.ListPolicies(ctx, params, optFns...)
+	}
+	items, err := c.listItems(ctx, configPolicyType)
+	if err != nil {
+		return nil, err
+	}
+	policies := []types.Policy{}
+	for _, item := range items {
+		if !strings.HasPrefix(item.Configuration.Path, aws.ToString(params.PathPrefix)) {
+			continue
+		}
+		policies = append(policies, types.Policy{
+			Arn:                           aws.String(item.Arn),
+			PolicyName:                    aws.String(item.ResourceName),
+			Path:                          aws.String(item.Configuration.Path),
+			AttachmentCount:               aws.Int32(item.Configuration.AttachmentCount),
+			PermissionsBoundaryUsageCount: aws.Int32(item.Configuration.PermissionsBoundaryUsageCount),
+		})
+	}
+	if params.Scope == types.PolicyScopeTypeAll {
+		pages := iam.NewListPoliciesPaginator(c.iam, &iam.ListPoliciesInput{Scope: types.PolicyScopeTypeAws, PathPrefix: params.PathPrefix})
+		for pages.HasMorePages() {
+			page, err := pages.NextPage(ctx, optFns...)
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, page.Policies...)
+		}
+	}
+	return &iam.ListPoliciesOutput{Policies: policies}, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/fatih/color"
+)
+
+// credentialKey is one of the two access keys a credential report row
+// describes.
+type credentialKey struct {
+	active      bool
+	lastRotated string
+	lastUsed    string
+	service     string
+	region      string
+}
+
+// credentialEntry is a user's row of the account credential report. Times
+// are kept as reported, where N/A and no_information mean there is none.
+type credentialEntry struct {
+	arn             string
+	created         string
+	passwordEnabled bool
+	passwordChanged string
+	passwordUsed    string
+	mfaActive       bool
+	keys            [2]credentialKey
+}
+
+// fetchCredentialReport generates the account credential report, waiting
+// for it when IAM is still building it, and returns its rows by user arn.
+func fetchCredentialReport(ctx context.Context, client IAMAPI) (map[string]credentialEntry, error) {
+	for {
+		res, err := client.GenerateCredentialReport(ctx, &iam.GenerateCredentialReportInput{})
+		if err != nil {
+			return nil, fmt.Errorf("generating credential report: %w", err)
+		}
+		if res.State == types.ReportStateTypeComplete {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	res, err := client.GetCredentialReport(ctx, &iam.GetCredentialReportInput{})
+	if err != nil {
+		return nil, fmt.Errorf("getting credential report: %w", err)
+	}
+	return parseCredentialReport(res.Content)
+}
+
+func parseCredentialReport(content []byte) (map[string]credentialEntry, error) {
+	rows, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading credential report: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("empty credential report")
+	}
+
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	get := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	entries := map[string]credentialEntry{}
+	for _, row := range rows[1:] {
+		entry := credentialEntry{
+			arn:             get(row, "arn"),
+			created:         get(row, "user_creation_time"),
+			passwordEnabled: get(row, "password_enabled") == "true",
+			passwordChanged: get(row, "password_last_changed"),
+			passwordUsed:    get(row, "password_last_used"),
+			mfaActive:       get(row, "mfa_active") == "true",
+		}
+		for i := range entry.keys {
+			prefix := fmt.Sprintf("access_key_%d_", i+1)
+			entry.keys[i] = credentialKey{
+				active:      get(row, prefix+"active") == "true",
+				lastRotated: get(row, prefix+"last_rotated"),
+				lastUsed:    get(row, prefix+"last_used_date"),
+				service:     get(row, prefix+"last_used_service"),
+				region:      get(row, prefix+"last_used_region"),
+			}
+		}
+		entries[entry.arn] = entry
+	}
+	return entries, nil
+}
+
+// credentialAge describes a credential report time relative to now.
+func credentialAge(value string, now time.Time) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "never"
+	}
+	return daysAgo(t, now)
+}
+
+// daysAgo describes t as a number of whole days before now.
+func daysAgo(t, now time.Time) string {
+	days := int(now.Sub(t).Hours() / 24)
+	switch days {
+	case 0:
+		return "today"
+	case 1:
+		return "1 day ago"
+	}
+	return fmt.Sprintf("%d days ago", days)
+}
+
+func presentCredentials(w io.Writer, entry credentialEntry, now time.Time) {
+	bold := color.New(color.Bold).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+
+	fmt.Fprintf(w, "%s\n", bold("==> "+entry.arn+" credentials <=="))
+	if entry.passwordEnabled {
+		fmt.Fprintf(w, "password      enabled, changed %s, last used %s\n",
+			credentialAge(entry.passwordChanged, now), credentialAge(entry.passwordUsed, now))
+	} else {
+		fmt.Fprintf(w, "password      %s\n", faint("disabled"))
+	}
+	if entry.mfaActive {
+		fmt.Fprintln(w, "mfa           active")
+	} else {
+		fmt.Fprintf(w, "mfa           %s\n", red("not active"))
+	}
+	for i, key := range entry.keys {
+		if !key.active {
+			fmt.Fprintf(w, "access key %d  %s\n", i+1, faint("inactive"))
+			continue
+		}
+		used := credentialAge(key.lastUsed, now)
+		if used != "never" && key.service != "N/A" {
+			used += fmt.Sprintf(" (%s in %s)", key.service, key.region)
+		}
+		fmt.Fprintf(w, "access key %d  active, rotated %s, last used %s\n", i+1, credentialAge(key.lastRotated, now), used)
+	}
+}
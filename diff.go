@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// StatementDiff lists the statements only found on one side of a
+// comparison.
+type StatementDiff struct {
+	Added   []Statement
+	Removed []Statement
+}
+
+func (d StatementDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// statementKey normalizes a statement so that reordering its actions,
+// resources or condition values, or moving it to another policy, does not
+// count as a change. The Sid only names the statement, so renaming it does
+// not either.
+func statementKey(s Statement) string {
+	return actionsKey(s) + "\n" + resourcesKey(s.Resource.Resources) + "\n!" + resourcesKey(s.NotResource.Resources) +
+		"\n" + s.Condition.key() + "\n" + principalsKey(s)
+}
+
+func resourcesKey(resources []string) string {
+	sorted := append([]string{}, resources...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// actionsKey is the part of statementKey for the effect and actions, and
+// the actions a NotAction leaves out.
+func actionsKey(s Statement) string {
+	key := func(actions []Action) string {
+		lower := []string{}
+		for _, action := range actions {
+			lower = append(lower, strings.ToLower(string(action)))
+		}
+		sort.Strings(lower)
+		return strings.Join(lower, ",")
+	}
+	return s.Effect + "\n" + key(s.Action.Actions) + "\n!" + key(s.NotAction.Actions)
+}
+
+// DiffStatements compares two sets of statements, counting duplicates, and
+// keeps the order the statements appeared in.
+func DiffStatements(before, after []Statement) StatementDiff {
+	counts := map[string]int{}
+	for _, s := range before {
+		counts[statementKey(s)]++
+	}
+
+	diff := StatementDiff{}
+	for _, s := range after {
+		key := statementKey(s)
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		diff.Added = append(diff.Added, s)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		key := statementKey(before[i])
+		if counts[key] > 0 {
+			counts[key]--
+			diff.Removed = append([]Statement{before[i]}, diff.Removed...)
+		}
+	}
+	return diff
+}
+
+// statementChange is a statement whose effect and actions stayed the same
+// while its resources or conditions changed.
+type statementChange struct {
+	before Statement
+	after  Statement
+}
+
+// changes pairs the removed and added statements of d that have the same
+// effect and actions, and returns those pairs and what is left unpaired.
+func (d StatementDiff) changes() (changed []statementChange, rest StatementDiff) {
+	paired := map[int]bool{}
+	for _, removed := range d.Removed {
+		key := actionsKey(removed)
+		found := false
+		for i, added := range d.Added {
+			if !paired[i] && actionsKey(added) == key {
+				paired[i] = true
+				changed = append(changed, statementChange{before: removed, after: added})
+				found = true
+				break
+			}
+		}
+		if !found {
+			rest.Removed = append(rest.Removed, removed)
+		}
+	}
+	for i, added := range d.Added {
+		if !paired[i] {
+			rest.Added = append(rest.Added, added)
+		}
+	}
+	return changed, rest
+}
+
+// normalizeStatements returns a copy of statements with actions and
+// resources sorted and the statements ordered by their key, so that two
+// fetches of unchanged policies serialize identically.
+func normalizeStatements(statements []Statement) []Statement {
+	out := []Statement{}
+	for _, s := range statements {
+		out = append(out, sortedStatement(s))
+	}
+	sort.SliceStable(out, func(i, j int) bool { return statementKey(out[i]) < statementKey(out[j]) })
+	return out
+}
+
+// sortedStatement returns a copy of s with its actions and resources, and
+// those it leaves out, sorted. The slices are copied, since managed policy
+// statements are shared.
+func sortedStatement(s Statement) Statement {
+	sortActions := func(actions []Action) []Action {
+		sorted := append([]Action{}, actions...)
+		sort.Slice(sorted, func(i, j int) bool { return strings.ToLower(string(sorted[i])) < strings.ToLower(string(sorted[j])) })
+		return sorted
+	}
+	sortResources := func(resources []string) []string {
+		sorted := append([]string{}, resources...)
+		sort.Strings(sorted)
+		return sorted
+	}
+	s.Action.Actions = sortActions(s.Action.Actions)
+	s.NotAction.Actions = sortActions(s.NotAction.Actions)
+	s.Resource.Resources = sortResources(s.Resource.Resources)
+	s.NotResource.Resources = sortResources(s.NotResource.Resources)
+	return s
+}
+
+// presentDiff prints the statements added to and removed from a principal,
+// prefixed with + and - like a unified diff.
+func presentDiff(w io.Writer, title string, diff StatementDiff) {
+	bold := color.New(color.Bold).SprintFunc()
+	fmt.Fprintf(w, "%s\n", bold("==> "+title+" <=="))
+	presentPrefixed(w, color.New(color.FgGreen).Sprint("+ "), diff.Added)
+	presentPrefixed(w, color.New(color.FgRed).Sprint("- "), diff.Removed)
+}
+
+func presentPrefixed(w io.Writer, prefix string, statements []Statement) {
+	var buf bytes.Buffer
+	for _, statement := range statements {
+		statement.Present(&buf)
+	}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		fmt.Fprintf(w, "%s%s\n", prefix, scanner.Text())
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDiffStatements(t *testing.T) {
+	tests := []struct {
+		name           string
+		before, after  string
+		added, removed string
+	}{
+		{
+			name:    "reordered",
+			before:  `[{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":["arn:aws:s3:::a","arn:aws:s3:::b"]},{"Effect":"Deny","Action":"iam:*","Resource":"*"}]`,
+			after:   `[{"Effect":"Deny","Action":"iam:*","Resource":"*"},{"Effect":"Allow","Action":["S3:PutObject","s3:GetObject"],"Resource":["arn:aws:s3:::b","arn:aws:s3:::a"]}]`,
+			added:   `null`,
+			removed: `null`,
+		},
+		{
+			name:    "renamed sid",
+			before:  `[{"Sid":"Read","Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]`,
+			after:   `[{"Sid":"ReadObjects","Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]`,
+			added:   `null`,
+			removed: `null`,
+		},
+		{
+			name:    "added and removed",
+			before:  `[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"},{"Effect":"Allow","Action":"s3:ListBucket","Resource":"*"}]`,
+			after:   `[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"},{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]`,
+			added:   `[{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]`,
+			removed: `[{"Effect":"Allow","Action":"s3:ListBucket","Resource":"*"}]`,
+		},
+		{
+			name:    "duplicates",
+			before:  `[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]`,
+			after:   `[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"},{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]`,
+			added:   `[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]`,
+			removed: `null`,
+		},
+		{
+			name:    "not action",
+			before:  `[{"Effect":"Allow","Action":"iam:*","Resource":"*"}]`,
+			after:   `[{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}]`,
+			added:   `[{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}]`,
+			removed: `[{"Effect":"Allow","Action":"iam:*","Resource":"*"}]`,
+		},
+		{
+			name:    "condition",
+			before:  `[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*","Condition":{"StringEquals":{"aws:PrincipalTag/team":["a","b"]}}}]`,
+			after:   `[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*","Condition":{"StringEquals":{"aws:PrincipalTag/team":["b","a"]}}}]`,
+			added:   `null`,
+			removed: `null`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffStatements(mustParse(t, `{"Statement":`+tt.before+`}`), mustParse(t, `{"Statement":`+tt.after+`}`))
+			for _, side := range []struct {
+				name       string
+				statements []Statement
+				want       string
+			}{{"added", diff.Added, tt.added}, {"removed", diff.Removed, tt.removed}} {
+				got, err := json.Marshal(side.statements)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != side.want {
+					t.Errorf("%s %s, want %s", side.name, got, side.want)
+				}
+			}
+			if diff.Empty() != (tt.added == "null" && tt.removed == "null") {
+				t.Errorf("Empty() = %v", diff.Empty())
+			}
+		})
+	}
+}
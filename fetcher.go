@@ -0,0 +1,747 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/codepipeline"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"golang.org/x/sync/errgroup"
+)
+
+// IAMAPI is the set of IAM operations the fetcher uses. *iam.Client
+// implements it, and tests or other backends can substitute their own.
+type IAMAPI interface {
+	GenerateCredentialReport(ctx context.Context, params *iam.GenerateCredentialReportInput, optFns ...func(*iam.Options)) (*iam.GenerateCredentialReportOutput, error)
+	GetCredentialReport(ctx context.Context, params *iam.GetCredentialReportInput, optFns ...func(*iam.Options)) (*iam.GetCredentialReportOutput, error)
+	GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error)
+	GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error)
+	GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	GetRolePolicy(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error)
+	GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error)
+	GetUserPolicy(ctx context.Context, params *iam.GetUserPolicyInput, optFns ...func(*iam.Options)) (*iam.GetUserPolicyOutput, error)
+	GetGroupPolicy(ctx context.Context, params *iam.GetGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.GetGroupPolicyOutput, error)
+	ListAttachedGroupPolicies(ctx context.Context, params *iam.ListAttachedGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedGroupPoliciesOutput, error)
+	ListAttachedRolePolicies(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error)
+	ListAttachedUserPolicies(ctx context.Context, params *iam.ListAttachedUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error)
+	ListGroupPolicies(ctx context.Context, params *iam.ListGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListGroupPoliciesOutput, error)
+	ListGroupsForUser(ctx context.Context, params *iam.ListGroupsForUserInput, optFns ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error)
+	ListPolicies(ctx context.Context, params *iam.ListPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListPoliciesOutput, error)
+	ListPolicyTags(ctx context.Context, params *iam.ListPolicyTagsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyTagsOutput, error)
+	ListPolicyVersions(ctx context.Context, params *iam.ListPolicyVersionsInput, optFns ...func(*iam.Options)) (*iam.ListPolicyVersionsOutput, error)
+	ListRolePolicies(ctx context.Context, params *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error)
+	ListRoleTags(ctx context.Context, params *iam.ListRoleTagsInput, optFns ...func(*iam.Options)) (*iam.ListRoleTagsOutput, error)
+	ListRoles(ctx context.Context, params *iam.ListRolesInput, optFns ...func(*iam.Options)) (*iam.ListRolesOutput, error)
+	ListUserPolicies(ctx context.Context, params *iam.ListUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error)
+	ListUserTags(ctx context.Context, params *iam.ListUserTagsInput, optFns ...func(*iam.Options)) (*iam.ListUserTagsOutput, error)
+	ListUsers(ctx context.Context, params *iam.ListUsersInput, optFns ...func(*iam.Options)) (*iam.ListUsersOutput, error)
+}
+
+var _ IAMAPI = (*iam.Client)(nil)
+
+type Fetcher struct {
+	client       IAMAPI
+	codebuild    *codebuild.Client
+	codepipeline *codepipeline.Client
+	sts          *sts.Client
+	cache        *Cache
+	concurrency  int
+	keepGoing    bool
+	progress     *Progress
+	w            io.Writer
+
+	mu       sync.Mutex
+	policies map[string]*policyEntry
+}
+
+// policyEntry memoizes the statements of a managed policy for the duration
+// of a run. done is closed once statements and err are set.
+type policyEntry struct {
+	done       chan struct{}
+	statements []Statement
+	err        error
+}
+
+// NewFetcher creates a fetcher that reads IAM data through client. cfg is
+// used for the other services the fetcher needs, such as STS.
+func NewFetcher(client IAMAPI, cfg aws.Config) *Fetcher {
+	return &Fetcher{
+		client:       client,
+		codebuild:    codebuild.NewFromConfig(cfg),
+		codepipeline: codepipeline.NewFromConfig(cfg),
+		sts:          sts.NewFromConfig(cfg),
+		concurrency:  defaultConcurrency,
+		w:            os.Stdout,
+		policies:     map[string]*policyEntry{},
+	}
+}
+
+const defaultConcurrency = 8
+
+type ArnType string
+
+const (
+	RoleArn         ArnType = "role"
+	UserArn                 = "user"
+	PolicyArn               = "policy"
+	AssumedRoleArn          = "assumed-role"
+	CodeBuildArn            = "codebuild"
+	CodePipelineArn         = "codepipeline"
+)
+
+func (f *Fetcher) FetchStatements(ctx context.Context, arn string) ([]Statement, error) {
+	return f.StreamStatements(ctx, arn, nil)
+}
+
+// StatementSink receives the statements of each policy as soon as it and
+// every policy before it have been fetched.
+type StatementSink func([]Statement)
+
+// StreamStatements fetches the statements for arn like FetchStatements, and
+// additionally hands them to sink policy by policy while the fetch is still
+// in progress. sink may be nil.
+func (f *Fetcher) StreamStatements(ctx context.Context, arn string, sink StatementSink) ([]Statement, error) {
+	ctx = withTargetAccount(ctx, arn)
+	fetchPrincipal := func(fetch func(context.Context, string, StatementSink) ([]Statement, error)) ([]Statement, error) {
+		var principalSink StatementSink
+		if sink != nil {
+			principalSink = func(statements []Statement) { sink(withProvenance(statements, arn, nil)) }
+		}
+		statements, err := fetch(ctx, arn, principalSink)
+		return withProvenance(statements, arn, nil), err
+	}
+	switch f.arnType(arn) {
+	case RoleArn:
+		return fetchPrincipal(f.fetchRoleStatements)
+	case UserArn:
+		return fetchPrincipal(f.fetchUserStatements)
+	case AssumedRoleArn:
+		return fetchPrincipal(f.fetchAssumedRoleStatements)
+	case PolicyArn:
+		statements, err := f.fetchPolicyStatements(ctx, arn)
+		if err == nil && sink != nil {
+			sink(statements)
+		}
+		return statements, err
+	case CodeBuildArn:
+		return f.fetchCodeBuildStatements(ctx, arn, sink)
+	case CodePipelineArn:
+		return f.fetchCodePipelineStatements(ctx, arn, sink)
+	default:
+		return nil, fmt.Errorf("cannot fetch the statements of %s", arn)
+	}
+}
+
+func (f *Fetcher) arnType(arn string) ArnType {
+	parsed, err := awsarn.Parse(arn)
+	if err != nil {
+		return RoleArn
+	}
+	kind, _, _ := strings.Cut(parsed.Resource, "/")
+	switch {
+	case parsed.Service == "codebuild":
+		return CodeBuildArn
+	case parsed.Service == "codepipeline":
+		return CodePipelineArn
+	case kind == "policy":
+		return PolicyArn
+	case kind == "assumed-role":
+		return AssumedRoleArn
+	case kind == "user":
+		return UserArn
+	}
+	return RoleArn
+}
+
+func (f *Fetcher) fetchRoleStatements(ctx context.Context, arn string, sink StatementSink) ([]Statement, error) {
+	roleName, err := principalName(arn)
+	if err != nil {
+		return nil, fmt.Errorf("getting role name: %w", err)
+	}
+	return f.getStatementsForRole(ctx, roleName, sink)
+}
+
+// principalName returns the name of the role, user or policy in arn without
+// its path, such as my-role in
+// arn:aws:iam::123456789012:role/service-role/my-role. The name of an
+// assumed role session is that of its role.
+func principalName(arn string) (string, error) {
+	parsed, err := awsarn.Parse(arn)
+	if err != nil {
+		return "", fmt.Errorf("invalid arn format: %s", arn)
+	}
+	kind, rest, _ := strings.Cut(parsed.Resource, "/")
+	if kind == "assumed-role" {
+		rest, _, _ = strings.Cut(rest, "/")
+	}
+	name := rest[strings.LastIndex(rest, "/")+1:]
+	if name == "" {
+		return "", fmt.Errorf("invalid arn format: %s", arn)
+	}
+	return name, nil
+}
+
+// serviceLinkedService returns the service a service-linked role belongs to,
+// such as ecs.amazonaws.com for
+// arn:aws:iam::123456789012:role/aws-service-role/ecs.amazonaws.com/AWSServiceRoleForECS.
+// AWS creates these roles under the /aws-service-role/ path.
+func serviceLinkedService(arn string) (string, bool) {
+	parsed, err := awsarn.Parse(arn)
+	if err != nil {
+		return "", false
+	}
+	const prefix = "role/aws-service-role/"
+	if !strings.HasPrefix(parsed.Resource, prefix) {
+		return "", false
+	}
+	service, _, found := strings.Cut(strings.TrimPrefix(parsed.Resource, prefix), "/")
+	if !found {
+		return "", false
+	}
+	return service, true
+}
+
+func (f *Fetcher) getStatementsForRole(ctx context.Context, roleName string, sink StatementSink) ([]Statement, error) {
+	refs := []policyRef{}
+
+	// attached policies
+
+	attached := iam.NewListAttachedRolePoliciesPaginator(f.client, &iam.ListAttachedRolePoliciesInput{
+		RoleName: aws.String(roleName),
+	})
+	for attached.HasMorePages() {
+		page, err := attached.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting role policies for %s: %w", roleName, err)
+		}
+		for _, policy := range page.AttachedPolicies {
+			refs = append(refs, policyRef{name: *policy.PolicyName, arn: *policy.PolicyArn, calls: []string{"iam:ListAttachedRolePolicies"}})
+		}
+	}
+
+	// role policies
+	inline := iam.NewListRolePoliciesPaginator(f.client, &iam.ListRolePoliciesInput{
+		RoleName: aws.String(roleName),
+	})
+	for inline.HasMorePages() {
+		page, err := inline.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing inline role policies for %s: %w", roleName, err)
+		}
+		for _, policyName := range page.PolicyNames {
+			refs = append(refs, policyRef{name: policyName, calls: []string{"iam:ListRolePolicies", "iam:GetRolePolicy"}})
+		}
+	}
+
+	return f.fetchPolicies(ctx, refs, func(ctx context.Context, policyName string) (*string, error) {
+		policyRes, err := f.client.GetRolePolicy(ctx, &iam.GetRolePolicyInput{
+			PolicyName: aws.String(policyName),
+			RoleName:   aws.String(roleName),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return policyRes.PolicyDocument, nil
+	}, sink)
+}
+
+// policyRef is a policy attached to a principal. Inline policies have no
+// arn and are fetched by name through the principal. calls are the API
+// calls that found the policy, and fetched it when it is inline.
+type policyRef struct {
+	name  string
+	arn   string
+	calls []string
+}
+
+type inlinePolicyGetter func(ctx context.Context, policyName string) (*string, error)
+
+// fetchPolicies fetches the statements of every policy concurrently, up to
+// the fetcher's concurrency limit, and returns them attached policies first,
+// each sorted by name, so that the order does not depend on how IAM lists
+// them.
+func (f *Fetcher) fetchPolicies(ctx context.Context, refs []policyRef, getInline inlinePolicyGetter, sink StatementSink) ([]Statement, error) {
+	sort.SliceStable(refs, func(i, j int) bool {
+		if (refs[i].arn == "") != (refs[j].arn == "") {
+			return refs[i].arn != ""
+		}
+		return refs[i].name < refs[j].name
+	})
+	results := make([][]Statement, len(refs))
+	failures := make([]error, len(refs))
+
+	f.progress.AddPolicies(len(refs))
+
+	var mu sync.Mutex
+	done := make([]bool, len(refs))
+	next := 0
+	emit := func(i int) {
+		if sink == nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		done[i] = true
+		for next < len(refs) && done[next] {
+			sink(results[next])
+			next++
+		}
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(f.concurrencyLimit())
+	for i, ref := range refs {
+		i, ref := i, ref
+		g.Go(func() error {
+			statements, err := f.fetchPolicy(gctx, ref, getInline)
+			results[i] = statements
+			f.progress.PolicyDone()
+			if err == nil {
+				emit(i)
+				return nil
+			}
+
+			if f.keepGoing {
+				failures[i] = err
+				emit(i)
+				return nil
+			}
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	allStatements := []Statement{}
+	for _, statements := range results {
+		allStatements = append(allStatements, statements...)
+	}
+
+	partial := &PartialError{}
+	for _, err := range failures {
+		partial.add(err)
+	}
+	if len(partial.Errors) > 0 {
+		return allStatements, partial
+	}
+	return allStatements, nil
+}
+
+func (f *Fetcher) fetchPolicy(ctx context.Context, ref policyRef, getInline inlinePolicyGetter) ([]Statement, error) {
+	if ref.arn != "" {
+		statements, err := f.FetchStatements(ctx, ref.arn)
+		if err != nil {
+			return statements, fmt.Errorf("fetching policy statements for %s: %w", ref.name, err)
+		}
+		return withProvenance(statements, "", ref.calls), nil
+	}
+
+	document, err := getInline(ctx, ref.name)
+	if err != nil {
+		return nil, fmt.Errorf("getting inline policy %s: %w", ref.name, err)
+	}
+	statements, err := decodeDocument(*document)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse policy document %s: %w", ref.name, err)
+	}
+	return withSource(statements, StatementSource{Policy: ref.name, Size: documentSize(*document), Calls: ref.calls}), nil
+}
+
+// PartialError is returned alongside the statements that could be fetched
+// when some of a principal's policies failed and the fetcher was asked to
+// keep going.
+type PartialError struct {
+	Errors []error
+}
+
+func (e *PartialError) add(err error) {
+	if err == nil {
+		return
+	}
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		e.Errors = append(e.Errors, partial.Errors...)
+		return
+	}
+	e.Errors = append(e.Errors, err)
+}
+
+func (e *PartialError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%d policies could not be fetched", len(e.Errors))
+}
+
+func (f *Fetcher) concurrencyLimit() int {
+	if f.concurrency < 1 {
+		return 1
+	}
+	return f.concurrency
+}
+
+func (f *Fetcher) fetchAssumedRoleStatements(ctx context.Context, arn string, sink StatementSink) ([]Statement, error) {
+	roleName, err := principalName(arn)
+	if err != nil {
+		return nil, fmt.Errorf("getting role name: %w", err)
+	}
+	return f.getStatementsForRole(ctx, roleName, sink)
+}
+
+func (f *Fetcher) fetchUserStatements(ctx context.Context, arn string, sink StatementSink) ([]Statement, error) {
+	userName, err := principalName(arn)
+	if err != nil {
+		return nil, fmt.Errorf("getting user name: %w", err)
+	}
+	return f.getStatementsForUser(ctx, userName, sink)
+}
+
+func (f *Fetcher) getStatementsForUser(ctx context.Context, userName string, sink StatementSink) ([]Statement, error) {
+	refs := []policyRef{}
+
+	// attached policies
+	attached := iam.NewListAttachedUserPoliciesPaginator(f.client, &iam.ListAttachedUserPoliciesInput{
+		UserName: aws.String(userName),
+	})
+	for attached.HasMorePages() {
+		page, err := attached.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting user policies for %s: %w", userName, err)
+		}
+		for _, policy := range page.AttachedPolicies {
+			refs = append(refs, policyRef{name: *policy.PolicyName, arn: *policy.PolicyArn, calls: []string{"iam:ListAttachedUserPolicies"}})
+		}
+	}
+
+	// user policies
+	inline := iam.NewListUserPoliciesPaginator(f.client, &iam.ListUserPoliciesInput{
+		UserName: aws.String(userName),
+	})
+	for inline.HasMorePages() {
+		page, err := inline.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing inline user policies for %s: %w", userName, err)
+		}
+		for _, policyName := range page.PolicyNames {
+			refs = append(refs, policyRef{name: policyName, calls: []string{"iam:ListUserPolicies", "iam:GetUserPolicy"}})
+		}
+	}
+
+	statements, err := f.fetchPolicies(ctx, refs, func(ctx context.Context, policyName string) (*string, error) {
+		policyRes, err := f.client.GetUserPolicy(ctx, &iam.GetUserPolicyInput{
+			PolicyName: aws.String(policyName),
+			UserName:   aws.String(userName),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return policyRes.PolicyDocument, nil
+	}, sink)
+	var partial *PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return nil, err
+	}
+	failures := &PartialError{}
+	failures.add(err)
+
+	// groups
+	groups := []types.Group{}
+	groupPages := iam.NewListGroupsForUserPaginator(f.client, &iam.ListGroupsForUserInput{
+		UserName: aws.String(userName),
+	})
+	for groupPages.HasMorePages() {
+		page, err := groupPages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing groups for %s: %w", userName, err)
+		}
+		groups = append(groups, page.Groups...)
+	}
+	sort.Slice(groups, func(i, j int) bool { return aws.ToString(groups[i].GroupName) < aws.ToString(groups[j].GroupName) })
+	for _, group := range groups {
+		groupStatements, err := f.getStatementsForGroup(ctx, *group.GroupName, sink)
+		if err != nil && !errors.As(err, &partial) {
+			return nil, err
+		}
+		failures.add(err)
+		statements = append(statements, groupStatements...)
+	}
+	if len(failures.Errors) > 0 {
+		return statements, failures
+	}
+	return statements, nil
+}
+
+// getStatementsForGroup fetches the policies of a group a user is in,
+// attributing every statement to the group.
+func (f *Fetcher) getStatementsForGroup(ctx context.Context, groupName string, sink StatementSink) ([]Statement, error) {
+	refs := []policyRef{}
+
+	attached := iam.NewListAttachedGroupPoliciesPaginator(f.client, &iam.ListAttachedGroupPoliciesInput{
+		GroupName: aws.String(groupName),
+	})
+	for attached.HasMorePages() {
+		page, err := attached.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting group policies for %s: %w", groupName, err)
+		}
+		for _, policy := range page.AttachedPolicies {
+			refs = append(refs, policyRef{name: *policy.PolicyName, arn: *policy.PolicyArn, calls: []string{"iam:ListGroupsForUser", "iam:ListAttachedGroupPolicies"}})
+		}
+	}
+
+	inline := iam.NewListGroupPoliciesPaginator(f.client, &iam.ListGroupPoliciesInput{
+		GroupName: aws.String(groupName),
+	})
+	for inline.HasMorePages() {
+		page, err := inline.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing inline group policies for %s: %w", groupName, err)
+		}
+		for _, policyName := range page.PolicyNames {
+			refs = append(refs, policyRef{name: policyName, calls: []string{"iam:ListGroupsForUser", "iam:ListGroupPolicies", "iam:GetGroupPolicy"}})
+		}
+	}
+
+	var groupSink StatementSink
+	if sink != nil {
+		groupSink = func(statements []Statement) { sink(withGroup(statements, groupName)) }
+	}
+	statements, err := f.fetchPolicies(ctx, refs, func(ctx context.Context, policyName string) (*string, error) {
+		policyRes, err := f.client.GetGroupPolicy(ctx, &iam.GetGroupPolicyInput{
+			PolicyName: aws.String(policyName),
+			GroupName:  aws.String(groupName),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return policyRes.PolicyDocument, nil
+	}, groupSink)
+	if err != nil {
+		err = fmt.Errorf("group %s: %w", groupName, err)
+	}
+	return withGroup(statements, groupName), err
+}
+
+// CallerArn returns the arn of the principal the current credentials belong to.
+func (f *Fetcher) CallerArn(ctx context.Context) (string, error) {
+	res, err := f.sts.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("getting caller identity: %w", err)
+	}
+	if res.Arn == nil {
+		return "", fmt.Errorf("caller identity has no arn")
+	}
+	return *res.Arn, nil
+}
+
+// ResolveName turns a bare role, user or customer managed policy name into
+// its arn. Values that are already arns are returned unchanged.
+func (f *Fetcher) ResolveName(ctx context.Context, name string) (string, error) {
+	if strings.HasPrefix(name, "arn:") {
+		return name, nil
+	}
+
+	var notFound *types.NoSuchEntityException
+
+	roleRes, err := f.client.GetRole(ctx, &iam.GetRoleInput{
+		RoleName: aws.String(name),
+	})
+	if err == nil {
+		return *roleRes.Role.Arn, nil
+	} else if !errors.As(err, &notFound) {
+		return "", fmt.Errorf("getting role %s: %w", name, err)
+	}
+
+	userRes, err := f.client.GetUser(ctx, &iam.GetUserInput{
+		UserName: aws.String(name),
+	})
+	if err == nil {
+		return *userRes.User.Arn, nil
+	} else if !errors.As(err, &notFound) {
+		return "", fmt.Errorf("getting user %s: %w", name, err)
+	}
+
+	identity, err := f.sts.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("getting caller identity: %w", err)
+	}
+	policyRes, err := f.client.GetPolicy(ctx, &iam.GetPolicyInput{
+		PolicyArn: aws.String(fmt.Sprintf("arn:%s:iam::%s:policy/%s", arnPartition(aws.ToString(identity.Arn)), *identity.Account, name)),
+	})
+	if err == nil {
+		return *policyRes.Policy.Arn, nil
+	} else if !errors.As(err, &notFound) {
+		return "", fmt.Errorf("getting policy %s: %w", name, err)
+	}
+
+	return "", &nameNotFoundError{name: name}
+}
+
+// nameNotFoundError is the error of ResolveName for a name that no role,
+// user or customer managed policy has.
+type nameNotFoundError struct {
+	name string
+}
+
+func (e *nameNotFoundError) Error() string {
+	return "no role, user or customer managed policy named " + e.name
+}
+
+func (f *Fetcher) fetchPolicyStatements(ctx context.Context, arn string) ([]Statement, error) {
+	f.mu.Lock()
+	entry, ok := f.policies[arn]
+	if !ok {
+		entry = &policyEntry{done: make(chan struct{})}
+		f.policies[arn] = entry
+	}
+	f.mu.Unlock()
+
+	if ok {
+		select {
+		case <-entry.done:
+			return entry.statements, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	entry.statements, entry.err = f.loadPolicyStatements(ctx, arn)
+	close(entry.done)
+	return entry.statements, entry.err
+}
+
+func (f *Fetcher) loadPolicyStatements(ctx context.Context, arn string) ([]Statement, error) {
+	// fetch policy details and get default version
+	res, err := f.client.GetPolicy(ctx, &iam.GetPolicyInput{
+		PolicyArn: aws.String(arn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting policy: %w", err)
+	}
+	versionP := res.Policy.DefaultVersionId
+	if versionP == nil {
+		return nil, fmt.Errorf("could not get policy version")
+	}
+	version := *versionP
+	source := StatementSource{Policy: aws.ToString(res.Policy.PolicyName), Arn: arn, Version: version}
+
+	cacheKey := "policy-version:" + arn + ":" + version
+	if document, ok := f.cache.Get(cacheKey); ok {
+		statements, err := decodeDocument(string(document))
+		if err == nil {
+			source.Size = documentSize(string(document))
+			source.Calls = []string{"iam:GetPolicy", "policy cache"}
+			return withSource(statements, source), nil
+		}
+	}
+
+	// fetch policy version information
+	versionRes, err := f.client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+		PolicyArn: aws.String(arn),
+		VersionId: aws.String(version),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting policy version: %w", err)
+	}
+	policyVersion := *versionRes.PolicyVersion
+	if policyVersion.Document == nil {
+		return nil, fmt.Errorf("no document found")
+	}
+	statements, err := decodeDocument(*policyVersion.Document)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse policy document: %w", err)
+	}
+	if err := f.cache.Put(cacheKey, []byte(*policyVersion.Document)); err != nil {
+		logger.Warn("could not cache policy document", "arn", arn, "error", err)
+	}
+	source.Size = documentSize(*policyVersion.Document)
+	source.Calls = []string{"iam:GetPolicy", "iam:GetPolicyVersion"}
+	return withSource(statements, source), nil
+}
+
+// arnPartition returns the partition of arn, such as aws-us-gov, defaulting
+// to aws.
+func arnPartition(arn string) string {
+	parsed, err := awsarn.Parse(arn)
+	if err != nil {
+		return "aws"
+	}
+	return parsed.Partition
+}
+
+// arnRegion returns the region component of a regional arn, e.g. the
+// us-east-1 in arn:aws:codebuild:us-east-1:123456789012:project/build.
+func arnRegion(arn string) string {
+	parsed, err := awsarn.Parse(arn)
+	if err != nil {
+		return ""
+	}
+	return parsed.Region
+}
+
+func (f *Fetcher) fetchCodeBuildStatements(ctx context.Context, arn string, sink StatementSink) ([]Statement, error) {
+	_, projectName, found := strings.Cut(arn, ":project/")
+	if !found || projectName == "" {
+		return nil, fmt.Errorf("invalid codebuild project arn format: %s", arn)
+	}
+
+	res, err := f.codebuild.BatchGetProjects(ctx, &codebuild.BatchGetProjectsInput{
+		Names: []string{projectName},
+	}, func(o *codebuild.Options) {
+		o.Region = arnRegion(arn)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting codebuild project %s: %w", projectName, err)
+	}
+	if len(res.Projects) == 0 {
+		return nil, fmt.Errorf("codebuild project %s not found", projectName)
+	}
+	serviceRole := res.Projects[0].ServiceRole
+	if serviceRole == nil {
+		return nil, fmt.Errorf("codebuild project %s has no service role", projectName)
+	}
+
+	statements, err := f.StreamStatements(ctx, *serviceRole, sink)
+	if err != nil {
+		return statements, fmt.Errorf("fetching service role statements for %s: %w", projectName, err)
+	}
+	return statements, nil
+}
+
+func (f *Fetcher) fetchCodePipelineStatements(ctx context.Context, arn string, sink StatementSink) ([]Statement, error) {
+	parsed, err := awsarn.Parse(arn)
+	if err != nil || parsed.Resource == "" {
+		return nil, fmt.Errorf("invalid codepipeline arn format: %s", arn)
+	}
+	pipelineName := parsed.Resource
+
+	res, err := f.codepipeline.GetPipeline(ctx, &codepipeline.GetPipelineInput{
+		Name: aws.String(pipelineName),
+	}, func(o *codepipeline.Options) {
+		o.Region = arnRegion(arn)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting codepipeline %s: %w", pipelineName, err)
+	}
+	if res.Pipeline == nil || res.Pipeline.RoleArn == nil {
+		return nil, fmt.Errorf("codepipeline %s has no service role", pipelineName)
+	}
+
+	statements, err := f.StreamStatements(ctx, *res.Pipeline.RoleArn, sink)
+	if err != nil {
+		return statements, fmt.Errorf("fetching service role statements for %s: %w", pipelineName, err)
+	}
+	return statements, nil
+}
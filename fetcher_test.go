@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// fakeIAM serves an account from maps, one item per page so that every
+// listing takes several calls. Documents hold a single Allow statement on
+// every resource, of the action they name.
+type fakeIAM struct {
+	IAMAPI
+
+	account  string
+	roles    map[string][]string // attached policy arns, then inline names after ""
+	users    map[string][]string
+	groups   map[string][]string
+	inGroups map[string][]string
+	broken   map[string]bool // inline policies that fail to load
+
+	mu       sync.Mutex
+	versions map[string]int // GetPolicyVersion calls by arn
+}
+
+func newFakeIAM() *fakeIAM {
+	return &fakeIAM{
+		account: "111111111111",
+		roles: map[string][]string{
+			"app": {"arn:aws:iam::111111111111:policy/write-logs", "arn:aws:iam::aws:policy/ReadOnlyAccess", "", "s3:PutObject", "s3:DeleteObject"},
+		},
+		users: map[string][]string{
+			"alice": {"", "sqs:SendMessage"},
+		},
+		groups: map[string][]string{
+			"devs": {"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+			"ops":  {"", "ec2:RebootInstances"},
+		},
+		inGroups: map[string][]string{"alice": {"ops", "devs"}},
+		broken:   map[string]bool{},
+		versions: map[string]int{},
+	}
+}
+
+// page returns the item at marker, and the marker of the next one.
+func page(items []string, marker *string) ([]string, *string, bool) {
+	i := 0
+	if marker != nil {
+		i = len(aws.ToString(marker))
+	}
+	if i >= len(items) {
+		return nil, nil, false
+	}
+	if i+1 < len(items) {
+		return items[i : i+1], aws.String(strings.Repeat("m", i+1)), true
+	}
+	return items[i:], nil, false
+}
+
+// split splits the policies of a principal into managed and inline ones.
+func split(policies []string) (managed, inline []string) {
+	for i, p := range policies {
+		if p == "" {
+			return policies[:i], policies[i+1:]
+		}
+	}
+	return policies, nil
+}
+
+func attached(arns []string) []types.AttachedPolicy {
+	out := []types.AttachedPolicy{}
+	for _, arn := range arns {
+		out = append(out, types.AttachedPolicy{PolicyArn: aws.String(arn), PolicyName: aws.String(arn[strings.LastIndex(arn, "/")+1:])})
+	}
+	return out
+}
+
+func document(action string) *string {
+	return aws.String(url.PathEscape(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"` + action + `","Resource":"*"}]}`))
+}
+
+func noSuchEntity() error {
+	return &types.NoSuchEntityException{Message: aws.String("not found")}
+}
+
+func (f *fakeIAM) inline(name string) (*string, error) {
+	if f.broken[name] {
+		return nil, errors.New("access denied")
+	}
+	return document(name), nil
+}
+
+func (f *fakeIAM) ListAttachedRolePolicies(ctx context.Context, params *iam.ListAttachedRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedRolePoliciesOutput, error) {
+	managed, _ := split(f.roles[aws.ToString(params.RoleName)])
+	items, marker, truncated := page(managed, params.Marker)
+	return &iam.ListAttachedRolePoliciesOutput{AttachedPolicies: attached(items), Marker: marker, IsTruncated: truncated}, nil
+}
+
+func (f *fakeIAM) ListRolePolicies(ctx context.Context, params *iam.ListRolePoliciesInput, optFns ...func(*iam.Options)) (*iam.ListRolePoliciesOutput, error) {
+	_, inline := split(f.roles[aws.ToString(params.RoleName)])
+	items, marker, truncated := page(inline, params.Marker)
+	return &iam.ListRolePoliciesOutput{PolicyNames: items, Marker: marker, IsTruncated: truncated}, nil
+}
+
+func (f *fakeIAM) GetRolePolicy(ctx context.Context, params *iam.GetRolePolicyInput, optFns ...func(*iam.Options)) (*iam.GetRolePolicyOutput, error) {
+	document, err := f.inline(aws.ToString(params.PolicyName))
+	return &iam.GetRolePolicyOutput{PolicyDocument: document}, err
+}
+
+func (f *fakeIAM) ListAttachedUserPolicies(ctx context.Context, params *iam.ListAttachedUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+	managed, _ := split(f.users[aws.ToString(params.UserName)])
+	items, marker, truncated := page(managed, params.Marker)
+	return &iam.ListAttachedUserPoliciesOutput{AttachedPolicies: attached(items), Marker: marker, IsTruncated: truncated}, nil
+}
+
+func (f *fakeIAM) ListUserPolicies(ctx context.Context, params *iam.ListUserPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+	_, inline := split(f.users[aws.ToString(params.UserName)])
+	items, marker, truncated := page(inline, params.Marker)
+	return &iam.ListUserPoliciesOutput{PolicyNames: items, Marker: marker, IsTruncated: truncated}, nil
+}
+
+func (f *fakeIAM) GetUserPolicy(ctx context.Context, params *iam.GetUserPolicyInput, optFns ...func(*iam.Options)) (*iam.GetUserPolicyOutput, error) {
+	document, err := f.inline(aws.ToString(params.PolicyName))
+	return &iam.GetUserPolicyOutput{PolicyDocument: document}, err
+}
+
+func (f *fakeIAM) ListGroupsForUser(ctx context.Context, params *iam.ListGroupsForUserInput, optFns ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error) {
+	items, marker, truncated := page(f.inGroups[aws.ToString(params.UserName)], params.Marker)
+	groups := []types.Group{}
+	for _, name := range items {
+		groups = append(groups, types.Group{GroupName: aws.String(name)})
+	}
+	return &iam.ListGroupsForUserOutput{Groups: groups, Marker: marker, IsTruncated: truncated}, nil
+}
+
+func (f *fakeIAM) ListAttachedGroupPolicies(ctx context.Context, params *iam.ListAttachedGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListAttachedGroupPoliciesOutput, error) {
+	managed, _ := split(f.groups[aws.ToString(params.GroupName)])
+	items, marker, truncated := page(managed, params.Marker)
+	return &iam.ListAttachedGroupPoliciesOutput{AttachedPolicies: attached(items), Marker: marker, IsTruncated: truncated}, nil
+}
+
+func (f *fakeIAM) ListGroupPolicies(ctx context.Context, params *iam.ListGroupPoliciesInput, optFns ...func(*iam.Options)) (*iam.ListGroupPoliciesOutput, error) {
+	_, inline := split(f.groups[aws.ToString(params.GroupName)])
+	items, marker, truncated := page(inline, params.Marker)
+	return &iam.ListGroupPoliciesOutput{PolicyNames: items, Marker: marker, IsTruncated: truncated}, nil
+}
+
+func (f *fakeIAM) GetGroupPolicy(ctx context.Context, params *iam.GetGroupPolicyInput, optFns ...func(*iam.Options)) (*iam.GetGroupPolicyOutput, error) {
+	document, err := f.inline(aws.ToString(params.PolicyName))
+	return &iam.GetGroupPolicyOutput{PolicyDocument: document}, err
+}
+
+func (f *fakeIAM) GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	arn := aws.ToString(params.PolicyArn)
+	if !strings.HasSuffix(arn, "/write-logs") && !strings.HasSuffix(arn, "/ReadOnlyAccess") {
+		return nil, noSuchEntity()
+	}
+	name := arn[strings.LastIndex(arn, "/")+1:]
+	return &iam.GetPolicyOutput{Policy: &types.Policy{Arn: params.PolicyArn, PolicyName: aws.String(name), DefaultVersionId: aws.String("v3")}}, nil
+}
+
+func (f *fakeIAM) GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	arn := aws.ToString(params.PolicyArn)
+	f.mu.Lock()
+	f.versions[arn]++
+	f.mu.Unlock()
+	action := "logs:PutLogEvents"
+	if strings.HasSuffix(arn, "/ReadOnlyAccess") {
+		action = "s3:Get*"
+	}
+	return &iam.GetPolicyVersionOutput{PolicyVersion: &types.PolicyVersion{Document: document(action), VersionId: params.VersionId}}, nil
+}
+
+func (f *fakeIAM) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	name := aws.ToString(params.RoleName)
+	if _, ok := f.roles[name]; !ok {
+		return nil, noSuchEntity()
+	}
+	return &iam.GetRoleOutput{Role: &types.Role{RoleName: params.RoleName, Arn: aws.String("arn:aws:iam::" + f.account + ":role/" + name)}}, nil
+}
+
+func (f *fakeIAM) GetUser(ctx context.Context, params *iam.GetUserInput, optFns ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+	name := aws.ToString(params.UserName)
+	if _, ok := f.users[name]; !ok {
+		return nil, noSuchEntity()
+	}
+	return &iam.GetUserOutput{User: &types.User{UserName: params.UserName, Arn: aws.String("arn:aws:iam::" + f.account + ":user/" + name)}}, nil
+}
+
+func newTestFetcher(client *fakeIAM) *Fetcher {
+	return &Fetcher{client: client, sts: newTestSTS(xmlResponse(callerIdentityResponse)), concurrency: 4, policies: map[string]*policyEntry{}}
+}
+
+// fetched summarizes statements as action, policy and group.
+func fetched(statements []Statement) []string {
+	out := []string{}
+	for _, s := range statements {
+		out = append(out, strings.Join([]string{string(s.Action.Actions[0]), s.Source.Policy, s.Source.Group}, " "))
+	}
+	return out
+}
+
+func TestFetchStatements(t *testing.T) {
+	tests := []struct {
+		arn  string
+		want []string
+	}{
+		{
+			arn: "arn:aws:iam::111111111111:role/app",
+			want: []string{
+				"s3:Get* ReadOnlyAccess ",
+				"logs:PutLogEvents write-logs ",
+				"s3:DeleteObject s3:DeleteObject ",
+				"s3:PutObject s3:PutObject ",
+			},
+		},
+		{
+			arn: "arn:aws:sts::111111111111:assumed-role/app/session",
+			want: []string{
+				"s3:Get* ReadOnlyAccess ",
+				"logs:PutLogEvents write-logs ",
+				"s3:DeleteObject s3:DeleteObject ",
+				"s3:PutObject s3:PutObject ",
+			},
+		},
+		{
+			arn: "arn:aws:iam::111111111111:user/alice",
+			want: []string{
+				"sqs:SendMessage sqs:SendMessage ",
+				"s3:Get* ReadOnlyAccess devs",
+				"ec2:RebootInstances ec2:RebootInstances ops",
+			},
+		},
+		{
+			arn:  "arn:aws:iam::111111111111:policy/write-logs",
+			want: []string{"logs:PutLogEvents write-logs "},
+		},
+	}
+	client := newFakeIAM()
+	f := newTestFetcher(client)
+	for _, tt := range tests {
+		t.Run(tt.arn, func(t *testing.T) {
+			statements, err := f.FetchStatements(context.Background(), tt.arn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fetched(statements); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fetched %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if calls := client.versions["arn:aws:iam::aws:policy/ReadOnlyAccess"]; calls != 1 {
+		t.Errorf("fetched ReadOnlyAccess %d times, want once", calls)
+	}
+}
+
+func TestFetchStatementsFailures(t *testing.T) {
+	client := newFakeIAM()
+	client.broken["s3:PutObject"] = true
+
+	_, err := newTestFetcher(client).FetchStatements(context.Background(), "arn:aws:iam::111111111111:role/app")
+	if err == nil || !strings.Contains(err.Error(), "getting inline policy s3:PutObject: access denied") {
+		t.Errorf("fetching with a broken policy: %v", err)
+	}
+
+	f := newTestFetcher(client)
+	f.keepGoing = true
+	statements, err := f.FetchStatements(context.Background(), "arn:aws:iam::111111111111:role/app")
+	var partial *PartialError
+	if !errors.As(err, &partial) || len(partial.Errors) != 1 {
+		t.Errorf("fetching with --keep-going: %v, want a partial error", err)
+	}
+	if len(statements) != 3 {
+		t.Errorf("fetched %q with --keep-going, want the 3 other statements", fetched(statements))
+	}
+
+	_, err = f.FetchStatements(context.Background(), "arn:aws:s3:::bucket")
+	if err == nil {
+		t.Error("fetched the statements of a bucket")
+	}
+}
+
+func TestResolveName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"app", "arn:aws:iam::111111111111:role/app"},
+		{"alice", "arn:aws:iam::111111111111:user/alice"},
+		{"write-logs", "arn:aws:iam::111111111111:policy/write-logs"},
+		{"arn:aws:iam::222222222222:role/other", "arn:aws:iam::222222222222:role/other"},
+	}
+	f := newTestFetcher(newFakeIAM())
+	for _, tt := range tests {
+		got, err := f.ResolveName(context.Background(), tt.name)
+		if err != nil {
+			t.Errorf("ResolveName(%s): %v", tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("ResolveName(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	_, err := f.ResolveName(context.Background(), "nobody")
+	var notFound *nameNotFoundError
+	if !errors.As(err, &notFound) || notFound.name != "nobody" {
+		t.Errorf("ResolveName(nobody): %v, want a not found error", err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// principalActivity is when a principal was created and last used, with
+// what it was last used through. lastUsed is zero when it never was.
+type principalActivity struct {
+	created  time.Time
+	lastUsed time.Time
+	via      string
+}
+
+// unusedSince reports whether the principal has not been used since cutoff,
+// counting one never used as unused once it was created before cutoff.
+func (p principalActivity) unusedSince(cutoff time.Time) bool {
+	if p.lastUsed.IsZero() {
+		return p.created.Before(cutoff)
+	}
+	return p.lastUsed.Before(cutoff)
+}
+
+// RoleLastUsed returns when a role was last used to make a request, or the
+// zero time when it has not been within the 400 days IAM tracks.
+func (f *Fetcher) RoleLastUsed(ctx context.Context, name string) (time.Time, error) {
+	activity, err := f.roleActivity(ctx, name)
+	return activity.lastUsed, err
+}
+
+// roleActivity returns when a role was created and last used, and in which
+// region.
+func (f *Fetcher) roleActivity(ctx context.Context, name string) (principalActivity, error) {
+	res, err := f.client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(name)})
+	if err != nil {
+		return principalActivity{}, fmt.Errorf("getting role %s: %w", name, err)
+	}
+	activity := principalActivity{created: aws.ToTime(res.Role.CreateDate)}
+	if used := res.Role.RoleLastUsed; used != nil && used.LastUsedDate != nil {
+		activity.lastUsed = *used.LastUsedDate
+		if used.Region != nil {
+			activity.via = "in " + *used.Region
+		}
+	}
+	return activity, nil
+}
+
+// userActivity returns when a user was created and last used its password
+// or either of its access keys, from its credential report row.
+func userActivity(entry credentialEntry) principalActivity {
+	activity := principalActivity{}
+	activity.created, _ = time.Parse(time.RFC3339, entry.created)
+	use := func(value, via string) {
+		t, err := time.Parse(time.RFC3339, value)
+		if err == nil && t.After(activity.lastUsed) {
+			activity.lastUsed, activity.via = t, via
+		}
+	}
+	use(entry.passwordUsed, "password")
+	for i, key := range entry.keys {
+		via := fmt.Sprintf("access key %d", i+1)
+		if key.service != "" && key.service != "N/A" {
+			via += fmt.Sprintf(" (%s)", key.service)
+		}
+		use(key.lastUsed, via)
+	}
+	return activity
+}
@@ -0,0 +1,701 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+type severity int
+
+const (
+	severityLow severity = iota
+	severityMedium
+	severityHigh
+)
+
+func (s severity) String() string {
+	switch s {
+	case severityMedium:
+		return "medium"
+	case severityHigh:
+		return "high"
+	}
+	return "low"
+}
+
+// finding is a problem a lint check found in a statement.
+type finding struct {
+	check     string
+	severity  severity
+	statement Statement
+	message   string
+}
+
+// lintCheck looks at every statement of a principal at once, since some
+// problems only show in combination.
+type lintCheck struct {
+	name string
+	run  func(statements []Statement) []finding
+}
+
+var lintChecks = []lintCheck{
+	{"shadowed-allow", checkShadowedAllows},
+	{"resource-mismatch", checkResourceMismatches},
+	{"condition-key", checkConditionKeys},
+	{"date-window", checkDateWindows},
+	{"pass-role", checkPassRole},
+	{"assume-role", checkAssumeRole},
+	{"not-action", checkNotActions},
+	{"wildcard-principal", checkWildcardPrincipals},
+	{"deprecated-action", checkDeprecatedActions},
+	{"unknown-action", checkUnknownActions},
+}
+
+// soonExpiring is how far ahead date-window warns about a window closing.
+const soonExpiring = 14 * 24 * time.Hour
+
+func lint(statements []Statement) []finding {
+	findings := []finding{}
+	for _, check := range lintChecks {
+		for _, f := range check.run(statements) {
+			f.check = check.name
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// checkShadowedAllows finds Allow statements whose every action and
+// resource an unconditional Deny also matches. They grant nothing, however
+// broad they look.
+func checkShadowedAllows(statements []Statement) []finding {
+	findings := []finding{}
+	for _, s := range statements {
+		if s.Effect != "Allow" || s.negated() {
+			// what a NotAction or NotResource allows is open ended, so no
+			// deny covers it
+			continue
+		}
+		for _, deny := range statements {
+			if deny.Effect != "Deny" || len(deny.Condition) > 0 {
+				continue
+			}
+			if coversAll(deny.Action.Actions, s.Action.Actions) && coversAllResources(deny.Resource.Resources, s.Resource.Resources) {
+				findings = append(findings, finding{
+					severity:  severityLow,
+					statement: s,
+					message:   "has no effect, every action and resource is denied by " + describeStatement(deny),
+				})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// checkResourceMismatches finds actions that none of the resources of their
+// statement can ever match, according to the resource types in the catalog,
+// such as iam:ListRoles scoped to a role or s3:GetObject scoped to a bucket.
+// Such actions grant nothing. It also finds resources that are not arns,
+// and resources none of the actions can be scoped to, such as a DynamoDB
+// table next to S3 actions. Actions missing from the catalog are skipped.
+func checkResourceMismatches(statements []Statement) []finding {
+	findings := []finding{}
+	for _, s := range statements {
+		for _, resource := range s.Resource.Resources {
+			if malformedResource(resource) {
+				findings = append(findings, finding{
+					severity:  severityMedium,
+					statement: s,
+					message:   "resource " + resource + " is not an arn, which look like arn:partition:service:region:account:resource",
+				})
+			}
+		}
+		if len(s.NotResource.Resources) > 0 {
+			// NotResource lists what it does not apply to
+			continue
+		}
+		mismatched := []Action{}
+		for _, action := range s.Action.Actions {
+			if actionMismatched(action, s.Resource.Resources) {
+				mismatched = append(mismatched, action)
+			}
+		}
+		if len(mismatched) < len(s.Action.Actions) {
+			for _, resource := range unusedResources(s) {
+				findings = append(findings, finding{
+					severity:  severityLow,
+					statement: s,
+					message:   "resource " + resource + " matches no resource type of " + joinActions(s.Action.Actions),
+				})
+			}
+		}
+		if len(mismatched) == 0 {
+			continue
+		}
+		message := "grants nothing, "
+		if len(mismatched) < len(s.Action.Actions) {
+			message = "grants nothing for " + joinActions(mismatched) + ", "
+		}
+		findings = append(findings, finding{
+			severity:  severityMedium,
+			statement: s,
+			message:   message + "its resources never match " + mismatchReason(mismatched),
+		})
+	}
+	return findings
+}
+
+// actionMismatched reports whether no resource can match action, or every
+// action a wildcard expands to.
+func actionMismatched(action Action, resources []string) bool {
+	expanded := ExpandAction(action)
+	if strings.ContainsAny(string(expanded[0]), "*?") {
+		return false
+	}
+	for _, a := range expanded {
+		patterns, ok := resourcePatterns(a)
+		if !ok {
+			return false
+		}
+		for _, resource := range resources {
+			if resourceMatch(resource, "*") {
+				return false
+			}
+			for _, pattern := range patterns {
+				if patternsOverlap(resource, pattern) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// malformedResource reports whether resource can never match an arn, being
+// neither a wildcard nor shaped like one.
+func malformedResource(resource string) bool {
+	if i := strings.IndexAny(resource, "*?"); i >= 0 {
+		literal := resource[:i]
+		return !strings.HasPrefix("arn:", literal) && !strings.HasPrefix(literal, "arn:")
+	}
+	return !strings.HasPrefix(resource, "arn:") || strings.Count(resource, ":") < 5
+}
+
+// unusedResources returns the resources of s that none of its actions can be
+// scoped to, leaving out ones that are not arns. It returns nil when an action
+// is missing from the catalog or a wildcard expands to nothing in it.
+func unusedResources(s Statement) []string {
+	patterns := []string{}
+	for _, action := range s.Action.Actions {
+		for _, a := range ExpandAction(action) {
+			if strings.ContainsAny(string(a), "*?") {
+				return nil
+			}
+			actionPatterns, ok := resourcePatterns(a)
+			if !ok {
+				return nil
+			}
+			patterns = append(patterns, actionPatterns...)
+		}
+	}
+	unused := []string{}
+	for _, resource := range s.Resource.Resources {
+		if resourceMatch(resource, "*") || malformedResource(resource) {
+			continue
+		}
+		used := false
+		for _, pattern := range patterns {
+			if patternsOverlap(resource, pattern) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			unused = append(unused, resource)
+		}
+	}
+	return unused
+}
+
+// mismatchReason says what resources the first mismatched action expects.
+func mismatchReason(actions []Action) string {
+	if strings.ContainsAny(string(actions[0]), "*?") {
+		return fmt.Sprintf("any action %s expands to", actions[0])
+	}
+	patterns, _ := resourcePatterns(actions[0])
+	if len(patterns) == 0 {
+		return fmt.Sprintf("%s, which only works with Resource \"*\"", actions[0])
+	}
+	return fmt.Sprintf("%s, which expects %s", actions[0], strings.Join(patterns, " or "))
+}
+
+// checkConditionKeys finds condition keys that the actions of their
+// statement never see: unknown global keys, keys of another service, and
+// service keys that only some actions support. A condition on a key the
+// request lacks does not match, so such an Allow grants nothing and such a
+// Deny denies nothing, unless the operator ends in IfExists, when the
+// condition is simply ignored.
+func checkConditionKeys(statements []Statement) []finding {
+	findings := []finding{}
+	for _, s := range statements {
+		keys := []string{}
+		seen := map[string]bool{}
+		for _, operatorKeys := range s.Condition {
+			for key := range operatorKeys {
+				if !seen[key] {
+					seen[key] = true
+					keys = append(keys, key)
+				}
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			problem := conditionKeyProblem(key, s.Action.Actions)
+			if problem == "" {
+				continue
+			}
+			f := finding{severity: severityMedium, statement: s, message: "condition key " + key + " " + problem}
+			if s.Effect == "Deny" {
+				f.severity = severityHigh
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// conditionKeyProblem says why key never applies to actions, or returns ""
+// when it may.
+func conditionKeyProblem(key string, actions []Action) string {
+	prefix, _, found := strings.Cut(key, ":")
+	if !found {
+		return "is not a condition key, which look like service:name"
+	}
+	prefix = strings.ToLower(prefix)
+	switch {
+	case prefix == "aws":
+		if !matchConditionKey(globalConditionKeys, key) {
+			return "is not a global condition key"
+		}
+		return ""
+	case federationConditionKey(prefix), matchConditionKey(crossServiceConditionKeys, key):
+		return ""
+	}
+
+	serviceActions := []Action{}
+	for _, action := range actions {
+		actionPrefix, _, _ := strings.Cut(string(action), ":")
+		if strings.ContainsAny(actionPrefix, "*?") {
+			return ""
+		}
+		if strings.EqualFold(actionPrefix, prefix) {
+			serviceActions = append(serviceActions, action)
+		}
+	}
+	if len(serviceActions) == 0 {
+		return "only applies to " + prefix + " actions, and the statement has none"
+	}
+
+	service, ok := catalogService(prefix)
+	if !ok || len(service.ConditionKeys) == 0 {
+		return ""
+	}
+	var definition *CatalogConditionKey
+	for i, k := range service.ConditionKeys {
+		if wildcardMatch(k.Name, key) {
+			definition = &service.ConditionKeys[i]
+			break
+		}
+	}
+	if definition == nil {
+		return "is not a condition key of " + service.Name
+	}
+	if len(definition.Actions) == 0 {
+		return ""
+	}
+	for _, action := range serviceActions {
+		for _, expanded := range ExpandAction(action) {
+			_, name, _ := strings.Cut(string(expanded), ":")
+			if strings.ContainsAny(name, "*?") {
+				return ""
+			}
+			for _, supported := range definition.Actions {
+				if strings.EqualFold(supported, name) {
+					return ""
+				}
+			}
+		}
+	}
+	supported := []Action{}
+	for _, name := range definition.Actions {
+		supported = append(supported, Action(service.Prefix+":"+name))
+	}
+	return "only applies to " + joinActions(supported)
+}
+
+// checkDateWindows finds statements limited to a time window by a condition
+// on aws:CurrentTime or aws:EpochTime that has already closed, has not
+// opened yet or closes soon. Such temporary grants tend to linger long after
+// their purpose ends.
+func checkDateWindows(statements []Statement) []finding {
+	now := time.Now()
+	findings := []finding{}
+	for _, s := range statements {
+		for _, clause := range dateClauses(s.Condition) {
+			f := finding{statement: s}
+			switch {
+			case clause.until && clause.at.Before(now):
+				f.severity = severityMedium
+				f.message = "expired on " + clause.at.UTC().Format(time.RFC3339) + ", so its condition never matches any more"
+			case clause.until && clause.at.Sub(now) < soonExpiring:
+				f.severity = severityLow
+				f.message = "expires on " + clause.at.UTC().Format(time.RFC3339)
+			case !clause.until && clause.at.After(now):
+				f.severity = severityLow
+				f.message = "only applies from " + clause.at.UTC().Format(time.RFC3339)
+			default:
+				continue
+			}
+			f.message = fmt.Sprintf("%s %s: %s", clause.operator, clause.key, f.message)
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// checkPassRole finds Allow statements granting iam:PassRole on every role
+// or without an iam:PassedToService condition. Passing a more powerful role
+// to a service such as EC2 or Lambda is the most common way to escalate
+// privileges, so both are worth limiting.
+func checkPassRole(statements []Statement) []finding {
+	findings := []finding{}
+	for _, s := range statements {
+		if s.Effect != "Allow" {
+			continue
+		}
+		through := grantedThrough(s, "iam:PassRole")
+		if through == "" {
+			continue
+		}
+		everyRole := len(s.NotResource.Resources) > 0
+		for _, resource := range s.Resource.Resources {
+			if resource == "*" || strings.HasSuffix(resource, ":role/*") {
+				everyRole = true
+			}
+		}
+		anyService := !hasConditionKey(s.Condition, "iam:PassedToService")
+
+		grant := "grants iam:PassRole"
+		if through != "iam:PassRole" {
+			grant += " through " + string(through)
+		}
+		f := finding{severity: severityMedium, statement: s}
+		switch {
+		case everyRole && anyService:
+			f.severity = severityHigh
+			f.message = grant + " on every role to any service; scope Resource to the roles it passes and add a StringEquals iam:PassedToService condition naming the service"
+		case everyRole:
+			f.message = grant + " on every role; scope Resource to the roles it passes"
+		case anyService:
+			f.message = grant + " to any service; add a StringEquals iam:PassedToService condition naming the service the roles are for"
+		default:
+			continue
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// checkAssumeRole finds Allow statements granting sts:AssumeRole on every
+// role of an account or of any account. The principal can then pivot to
+// any role whose trust policy lets it in, which includes roles in other
+// accounts that trust its account.
+func checkAssumeRole(statements []Statement) []finding {
+	findings := []finding{}
+	for _, s := range statements {
+		if s.Effect != "Allow" {
+			continue
+		}
+		through := grantedThrough(s, "sts:AssumeRole")
+		if through == "" {
+			continue
+		}
+		grant := "grants sts:AssumeRole"
+		if through != "sts:AssumeRole" {
+			grant += " through " + string(through)
+		}
+		if len(s.NotResource.Resources) > 0 {
+			findings = append(findings, finding{
+				severity:  severityHigh,
+				statement: s,
+				message:   grant + " on all but " + strings.Join(s.NotResource.Resources, ", ") + ", so it can pivot to any other role that trusts it, in any account; list the roles it needs to assume",
+			})
+			continue
+		}
+		for _, resource := range s.Resource.Resources {
+			f := finding{statement: s}
+			parts := strings.SplitN(resource, ":", 6)
+			switch {
+			case resource == "*":
+				f.severity = severityHigh
+				f.message = grant + " on *, so it can pivot to any role that trusts it, in any account"
+			case len(parts) == 6 && strings.ContainsAny(parts[4], "*?"):
+				f.severity = severityHigh
+				f.message = grant + " on " + resource + ", so it can pivot to matching roles that trust it in any account"
+			case len(parts) == 6 && (parts[5] == "*" || parts[5] == "role/*"):
+				f.severity = severityMedium
+				f.message = grant + " on " + resource + ", so it can pivot to any role of account " + parts[4] + " that trusts it"
+			default:
+				continue
+			}
+			f.message += "; list the roles it needs to assume"
+			findings = append(findings, f)
+			break
+		}
+	}
+	return findings
+}
+
+// principalRestrictingKeys are the condition keys that limit who a
+// statement with a wildcard principal applies to.
+var principalRestrictingKeys = map[string]bool{
+	"aws:principalorgid":    true,
+	"aws:principalorgpaths": true,
+	"aws:principalaccount":  true,
+	"aws:principalarn":      true,
+	"aws:sourceaccount":     true,
+	"aws:sourcearn":         true,
+	"aws:sourceorgid":       true,
+	"aws:sourceorgpaths":    true,
+	"sts:externalid":        true,
+}
+
+// checkUnknownActions finds actions that services in the catalog do not
+// have, usually typos such as s3:GetObjcet. IAM accepts them without
+// complaint, but they match nothing: an Allow grants nothing for them and
+// a Deny denies nothing, so a misspelt Deny is high severity.
+func checkUnknownActions(statements []Statement) []finding {
+	findings := []finding{}
+	for _, s := range statements {
+		for _, action := range s.Action.Actions {
+			problem := unknownAction(action)
+			if problem == "" {
+				continue
+			}
+			f := finding{severity: severityMedium, statement: s, message: string(action) + " " + problem}
+			if s.Effect == "Deny" {
+				f.severity = severityHigh
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// checkDeprecatedActions finds actions that the catalog marks deprecated or
+// retired. Retired actions grant nothing, so statements still naming them
+// have usually lost access without anyone noticing.
+func checkDeprecatedActions(statements []Statement) []finding {
+	findings := []finding{}
+	for _, s := range statements {
+		for _, action := range s.Action.Actions {
+			if note := deprecatedAction(action); note != "" {
+				findings = append(findings, finding{
+					severity:  severityLow,
+					statement: s,
+					message:   string(action) + " " + note,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// checkWildcardPrincipals finds Allow statements with the principal "*"
+// that no condition limits to some accounts, organizations or callers, nor
+// a Deny to an organization. In a trust policy they let anyone with an AWS
+// account assume the role.
+func checkWildcardPrincipals(statements []Statement) []finding {
+	findings := []finding{}
+	for _, s := range statements {
+		if s.Effect != "Allow" || !wildcardPrincipal(s.Principal) || orgBounded(s, statements) {
+			continue
+		}
+		restricted := false
+		for _, clause := range s.Condition.clauses() {
+			base := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(clause.operator, "ForAnyValue:"), "ForAllValues:"), "IfExists")
+			if _, negated, ok := conditionOperators(base); ok && !negated && principalRestrictingKeys[strings.ToLower(clause.key)] {
+				restricted = true
+			}
+		}
+		if restricted {
+			continue
+		}
+		findings = append(findings, finding{
+			severity:  severityHigh,
+			statement: s,
+			message:   "applies to any principal in any account; limit it with a condition such as aws:PrincipalOrgID or aws:PrincipalAccount",
+		})
+	}
+	return findings
+}
+
+// wildcardPrincipal reports whether p names every principal.
+func wildcardPrincipal(p StatementPrincipal) bool {
+	for _, values := range p {
+		for _, v := range values {
+			if v == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasConditionKey reports whether any operator of c tests key.
+func hasConditionKey(c Condition, key string) bool {
+	for _, keys := range c {
+		for k := range keys {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dateClause is a bound on the request time: the condition only matches
+// before at when until is set, and after it otherwise.
+type dateClause struct {
+	operator string
+	key      string
+	at       time.Time
+	until    bool
+}
+
+// dateClauses returns the bounds a condition puts on the request time. Of
+// several values the most permissive one counts, since any may match.
+func dateClauses(c Condition) []dateClause {
+	clauses := []dateClause{}
+	for operator, keys := range c {
+		base := strings.TrimSuffix(operator, "IfExists")
+		var until bool
+		switch base {
+		case "DateLessThan", "DateLessThanEquals", "NumericLessThan", "NumericLessThanEquals":
+			until = true
+		case "DateGreaterThan", "DateGreaterThanEquals", "NumericGreaterThan", "NumericGreaterThanEquals":
+		default:
+			continue
+		}
+		for key, values := range keys {
+			lower := strings.ToLower(key)
+			if lower != "aws:currenttime" && lower != "aws:epochtime" {
+				continue
+			}
+			if strings.HasPrefix(base, "Numeric") && lower != "aws:epochtime" {
+				continue
+			}
+			clause := dateClause{operator: operator, key: key, until: until}
+			found := false
+			for _, v := range values {
+				t, ok := parseConditionDate(v)
+				if !ok {
+					continue
+				}
+				if !found || until && t.After(clause.at) || !until && t.Before(clause.at) {
+					clause.at = t
+					found = true
+				}
+			}
+			if found {
+				clauses = append(clauses, clause)
+			}
+		}
+	}
+	sort.Slice(clauses, func(i, j int) bool { return clauses[i].operator+clauses[i].key < clauses[j].operator+clauses[j].key })
+	return clauses
+}
+
+// describeStatement names a statement by its position in its policy.
+func describeStatement(s Statement) string {
+	description := fmt.Sprintf("statement %d of %s", s.Source.Index+1, s.Source.Policy)
+	if s.Source.Group != "" {
+		description += " of group " + s.Source.Group
+	}
+	return description
+}
+
+func presentFindings(w io.Writer, arn string, findings []finding) {
+	bold := color.New(color.Bold).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+	severities := map[severity]func(a ...interface{}) string{
+		severityLow:    color.New(color.FgCyan).SprintFunc(),
+		severityMedium: color.New(color.FgYellow).SprintFunc(),
+		severityHigh:   color.New(color.FgRed).SprintFunc(),
+	}
+
+	fmt.Fprintf(w, "%s\n", bold("==> "+arn+" findings <=="))
+	if len(findings) == 0 {
+		fmt.Fprintln(w, faint("no findings"))
+		return
+	}
+	for _, f := range findings {
+		label := f.severity.String()
+		if glyph := markers.severity(f.severity); glyph != "" {
+			label = glyph + " " + label
+		}
+		fmt.Fprintf(w, "%s %s: %s %s\n", severities[f.severity](label), f.check, describeStatement(f.statement), f.message)
+		var statement strings.Builder
+		f.statement.Present(&statement)
+		for _, line := range strings.Split(strings.TrimSuffix(statement.String(), "\n"), "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+}
+
+// grantedThrough returns the action pattern through which an Allow statement
+// grants action, NotAction when it grants it by leaving it out, or nothing.
+func grantedThrough(s Statement, action Action) Action {
+	if len(s.NotAction.Actions) > 0 {
+		if s.matchesAction(action) {
+			return "NotAction"
+		}
+		return ""
+	}
+	for _, pattern := range s.Action.Actions {
+		if wildcardMatch(string(pattern), string(action)) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// checkNotActions finds Allow statements with NotAction. They grant every
+// action they do not list, including those of services AWS adds later, so
+// they tend to grant far more than meant; on every resource without
+// conditions they are high severity.
+func checkNotActions(statements []Statement) []finding {
+	findings := []finding{}
+	for _, s := range statements {
+		if s.Effect != "Allow" || len(s.NotAction.Actions) == 0 {
+			continue
+		}
+		everyResource := len(s.NotResource.Resources) > 0
+		for _, resource := range s.Resource.Resources {
+			everyResource = everyResource || resource == "*"
+		}
+		f := finding{severity: severityMedium, statement: s}
+		if everyResource && len(s.Condition) == 0 {
+			f.severity = severityHigh
+		}
+		f.message = "allows every action but " + joinActions(s.NotAction.Actions) + ", including those of services added later; list the actions it needs instead"
+		findings = append(findings, f)
+	}
+	return findings
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type logLevel int
+
+const (
+	levelWarn logLevel = iota
+	levelInfo
+	levelDebug
+)
+
+func (l logLevel) String() string {
+	switch l {
+	case levelWarn:
+		return "warn"
+	case levelInfo:
+		return "info"
+	default:
+		return "debug"
+	}
+}
+
+// Logger writes key=value formatted messages to stderr, dropping the ones
+// above the configured level.
+type Logger struct {
+	level logLevel
+	out   *log.Logger
+}
+
+var logger = NewLogger(os.Stderr, levelWarn)
+
+func NewLogger(w io.Writer, level logLevel) *Logger {
+	return &Logger{
+		level: level,
+		out:   log.New(w, "", log.LstdFlags),
+	}
+}
+
+func (l *Logger) Enabled(level logLevel) bool {
+	return level <= l.level
+}
+
+func (l *Logger) log(level logLevel, msg string, kv ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "level=%s msg=%s", level, strconv.Quote(msg))
+	for i := 0; i+1 < len(kv); i += 2 {
+		value := fmt.Sprint(kv[i+1])
+		if strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %v=%s", kv[i], value)
+	}
+	l.out.Print(b.String())
+}
+
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.log(levelWarn, msg, kv...) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.log(levelInfo, msg, kv...) }
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(levelDebug, msg, kv...) }
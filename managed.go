@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/fatih/color"
+	"golang.org/x/sync/errgroup"
+)
+
+// managedPolicyPaths are the paths AWS managed policies live under, tried in
+// order for a bare name. Job function policies such as ViewOnlyAccess are
+// under job-function/, and those of service-linked roles, such as
+// AmazonECSServiceRolePolicy, under aws-service-role/.
+var managedPolicyPaths = []string{"", "job-function/", "service-role/", "aws-service-role/"}
+
+// AWSManagedPolicy fetches an AWS managed policy by arn or name, returning
+// its arn and statements.
+func (f *Fetcher) AWSManagedPolicy(ctx context.Context, partition, name string) (string, []Statement, error) {
+	if strings.HasPrefix(name, "arn:") {
+		statements, err := f.fetchPolicyStatements(ctx, name)
+		return name, statements, err
+	}
+	var notFound *types.NoSuchEntityException
+	for _, path := range managedPolicyPaths {
+		arn := fmt.Sprintf("arn:%s:iam::aws:policy/%s%s", partition, path, name)
+		statements, err := f.fetchPolicyStatements(ctx, arn)
+		if errors.As(err, &notFound) {
+			continue
+		}
+		return arn, statements, err
+	}
+	return "", nil, fmt.Errorf("no AWS managed policy named %s", name)
+}
+
+// actionComparison holds the actions a principal is allowed beyond those of
+// a baseline policy, and the actions of the baseline it is not allowed.
+type actionComparison struct {
+	beyond  []Action
+	missing []Action
+}
+
+// compareActions compares the actions statements allow with those baseline
+// allows, ignoring resources and conditions. An action denied to every
+// resource without conditions is not allowed. Wildcards are expanded
+// through the catalog and listed as they are when every action they expand
+// to differs, so that services missing from it still compare by pattern.
+func compareActions(statements, baseline []Statement) actionComparison {
+	allowed, mine := allowedActions(statements)
+	baseAllowed, base := allowedActions(baseline)
+	return actionComparison{
+		beyond:  uncoveredActions(mine, baseAllowed),
+		missing: uncoveredActions(base, allowed),
+	}
+}
+
+// allowedActions returns a predicate for whether statements allow an action,
+// and the action patterns of their Allow statements.
+func allowedActions(statements []Statement) (func(Action) bool, []Action) {
+	var allows, denies []Action
+	seen := map[string]bool{}
+	for _, s := range statements {
+		switch {
+		case s.Effect == "Allow":
+			for _, action := range s.Action.Actions {
+				if key := strings.ToLower(string(action)); !seen[key] {
+					seen[key] = true
+					allows = append(allows, action)
+				}
+			}
+		case s.Effect == "Deny" && len(s.Condition) == 0 && coversAllResources(s.Resource.Resources, []string{"*"}):
+			denies = append(denies, s.Action.Actions...)
+		}
+	}
+	allowed := func(action Action) bool {
+		return coversAll(allows, []Action{action}) && !coversAll(denies, []Action{action})
+	}
+	return allowed, allows
+}
+
+// uncoveredActions returns the actions of patterns that covered does not
+// allow, each pattern whole when none of its actions are.
+func uncoveredActions(patterns []Action, covered func(Action) bool) []Action {
+	out := []Action{}
+	for _, pattern := range patterns {
+		expanded := ExpandAction(pattern)
+		uncovered := []Action{}
+		for _, action := range expanded {
+			if !covered(action) {
+				uncovered = append(uncovered, action)
+			}
+		}
+		if len(uncovered) == len(expanded) {
+			uncovered = []Action{pattern}
+		}
+		out = append(out, uncovered...)
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(string(out[i])) < strings.ToLower(string(out[j])) })
+	return out
+}
+
+// presentComparison prints the actions of a principal beyond a managed
+// policy prefixed with +, and those it falls short of with -.
+func presentComparison(w io.Writer, arn, policy string, cmp actionComparison) {
+	bold := color.New(color.Bold).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+
+	fmt.Fprintf(w, "%s\n", bold("==> "+arn+" compared with "+policy+" <=="))
+	for _, action := range cmp.beyond {
+		fmt.Fprintf(w, "%s %s\n", green("+"), action)
+	}
+	for _, action := range cmp.missing {
+		fmt.Fprintf(w, "%s %s\n", red("-"), action)
+	}
+	fmt.Fprintln(w, faint(fmt.Sprintf("%d actions beyond %s, %d of its actions not allowed", len(cmp.beyond), policy, len(cmp.missing))))
+}
+
+// suggestionCandidates are the AWS managed policies --suggest-managed
+// considers: the read only and full access policies of common services,
+// from narrowest to broadest. AdministratorAccess is left out, since it
+// covers anything.
+var suggestionCandidates = []string{
+	"AmazonS3ReadOnlyAccess",
+	"AmazonS3FullAccess",
+	"CloudWatchLogsReadOnlyAccess",
+	"CloudWatchLogsFullAccess",
+	"AmazonDynamoDBReadOnlyAccess",
+	"AmazonDynamoDBFullAccess",
+	"AmazonSQSReadOnlyAccess",
+	"AmazonSQSFullAccess",
+	"AmazonSNSReadOnlyAccess",
+	"AmazonSNSFullAccess",
+	"AWSLambda_ReadOnlyAccess",
+	"AWSLambda_FullAccess",
+	"AmazonEC2ReadOnlyAccess",
+	"AmazonEC2FullAccess",
+	"AmazonEC2ContainerRegistryReadOnly",
+	"AmazonEC2ContainerRegistryPowerUser",
+	"SecretsManagerReadWrite",
+	"IAMReadOnlyAccess",
+	"ReadOnlyAccess",
+	"PowerUserAccess",
+}
+
+// managedSuggestion is a set of AWS managed policies that together allow
+// the actions of some statements, and the actions they leave out.
+type managedSuggestion struct {
+	statements int
+	actions    int
+	policies   []string
+	uncovered  []Action
+}
+
+// suggestManaged picks AWS managed policies that together allow the actions
+// of the inline statements among statements, or of all of them when none
+// came from a managed policy. It greedily takes the candidate allowing the
+// most actions still uncovered, the earlier one on ties, until none allows
+// more. Candidates that cannot be fetched are skipped.
+func suggestManaged(ctx context.Context, f *Fetcher, partition string, statements []Statement) managedSuggestion {
+	inline := []Statement{}
+	for _, s := range statements {
+		if s.Effect == "Allow" && s.Source.Arn == "" {
+			inline = append(inline, s)
+		}
+	}
+	_, patterns := allowedActions(inline)
+	actions := []Action{}
+	for _, pattern := range patterns {
+		actions = append(actions, ExpandAction(pattern)...)
+	}
+	suggestion := managedSuggestion{statements: len(inline), actions: len(actions)}
+	if len(actions) == 0 {
+		return suggestion
+	}
+
+	allows := make([]func(Action) bool, len(suggestionCandidates))
+	var g errgroup.Group
+	g.SetLimit(f.concurrencyLimit())
+	for i, name := range suggestionCandidates {
+		i, name := i, name
+		g.Go(func() error {
+			_, candidate, err := f.AWSManagedPolicy(ctx, partition, name)
+			if err != nil {
+				logger.Info("could not fetch managed policy to suggest", "policy", name, "error", err)
+				return nil
+			}
+			allows[i], _ = allowedActions(candidate)
+			return nil
+		})
+	}
+	g.Wait()
+
+	remaining := actions
+	for len(remaining) > 0 {
+		best, bestLeft := -1, remaining
+		for i, allowed := range allows {
+			if allowed == nil {
+				continue
+			}
+			left := uncoveredActions(remaining, allowed)
+			if len(left) < len(bestLeft) {
+				best, bestLeft = i, left
+			}
+		}
+		if best < 0 {
+			break
+		}
+		suggestion.policies = append(suggestion.policies, suggestionCandidates[best])
+		remaining = bestLeft
+	}
+	suggestion.uncovered = remaining
+	return suggestion
+}
+
+// presentSuggestion prints the managed policies that cover the statements
+// of a principal, and the actions none of them do.
+func presentSuggestion(w io.Writer, arn string, suggestion managedSuggestion) {
+	bold := color.New(color.Bold).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+	fmt.Fprintf(w, "%s\n", bold("==> "+arn+" managed policy suggestions <=="))
+	switch {
+	case suggestion.actions == 0:
+		fmt.Fprintln(w, faint("no inline Allow statements"))
+		return
+	case len(suggestion.policies) == 0:
+		fmt.Fprintln(w, faint("no AWS managed policy covers any of the actions"))
+		return
+	}
+	covered := "are a subset of"
+	if len(suggestion.uncovered) > 0 {
+		covered = "are partly covered by"
+	}
+	fmt.Fprintf(w, "%d statements (%d actions) %s %s\n", suggestion.statements, suggestion.actions, covered, strings.Join(suggestion.policies, " + "))
+	if len(suggestion.uncovered) > 0 {
+		fmt.Fprintf(w, "not covered: %s\n", joinActions(suggestion.uncovered))
+	}
+	fmt.Fprintln(w, faint("managed policies grant their actions on every resource, so check the resources the statements are scoped to"))
+}
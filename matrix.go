@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+// matrixLevels are the cells of the access matrix, from least to most
+// access.
+var matrixLevels = []string{"none", "read", "write", "admin"}
+
+// accessLevelMatrix maps the access levels of the catalog to indexes of
+// matrixLevels.
+var accessLevelMatrix = map[string]int{
+	"List":                   1,
+	"Read":                   1,
+	"Tagging":                2,
+	"Write":                  2,
+	"Permissions management": 3,
+}
+
+// serviceLevels returns the highest of matrixLevels statements allow on each
+// service they have actions of, by prefix, and whether they allow every
+// action of every service. Every action of a service counts as admin, and
+// actions denied on every resource without conditions are left out.
+func serviceLevels(statements []Statement) (map[string]int, bool) {
+	allowed, patterns := allowedActions(statements)
+	levels := map[string]int{}
+	everything := false
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			everything = everything || allowed(pattern)
+			continue
+		}
+		prefix, name, _ := strings.Cut(strings.ToLower(string(pattern)), ":")
+		for _, action := range ExpandAction(pattern) {
+			if !allowed(action) {
+				continue
+			}
+			level := 3
+			if name != "*" {
+				accessLevel := guessAccessLevel(action)
+				if a, ok := catalogAction(action); ok {
+					accessLevel = a.AccessLevel
+				}
+				level = accessLevelMatrix[accessLevel]
+			}
+			if level > levels[prefix] {
+				levels[prefix] = level
+			}
+		}
+	}
+	return levels, everything
+}
+
+// matrixRow is a principal of the access matrix, with its level on each of
+// the services of the matrix.
+type matrixRow struct {
+	Account string
+	Kind    string
+	Name    string
+	Arn     string
+	Levels  []string
+}
+
+// accessMatrix is a grid of principals against the services any of them has
+// actions of, sorted by prefix.
+type accessMatrix struct {
+	Services []string
+	Rows     []matrixRow
+	accounts bool
+}
+
+// principalLevels is the level of a principal on each service, and whether
+// it is allowed every action.
+type principalLevels struct {
+	row        matrixRow
+	levels     map[string]int
+	everything bool
+}
+
+func newAccessMatrix(principals []principalLevels, accounts bool) accessMatrix {
+	seen := map[string]bool{}
+	m := accessMatrix{Services: []string{}, Rows: []matrixRow{}, accounts: accounts}
+	for _, p := range principals {
+		for service := range p.levels {
+			if !seen[service] {
+				seen[service] = true
+				m.Services = append(m.Services, service)
+			}
+		}
+	}
+	sort.Strings(m.Services)
+	for _, p := range principals {
+		row := p.row
+		row.Levels = []string{}
+		for _, service := range m.Services {
+			level := p.levels[service]
+			if p.everything {
+				level = 3
+			}
+			row.Levels = append(row.Levels, matrixLevels[level])
+		}
+		m.Rows = append(m.Rows, row)
+	}
+	return m
+}
+
+func (m accessMatrix) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{}
+	if m.accounts {
+		header = append(header, "account")
+	}
+	cw.Write(append(append(header, "kind", "name", "arn"), m.Services...))
+	for _, row := range m.Rows {
+		record := []string{}
+		if m.accounts {
+			record = append(record, row.Account)
+		}
+		cw.Write(append(append(record, row.Kind, row.Name, row.Arn), row.Levels...))
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("writing csv: %w", err)
+	}
+	return nil
+}
+
+var htmlMatrix = template.Must(template.New("matrix").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>iam-show access matrix</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+td.none { color: #aaa; }
+td.read { background: #ddf4ff; }
+td.write { background: #fff8c5; }
+td.admin { background: #ffebe9; color: #cf222e; font-weight: bold; }
+</style>
+</head>
+<body>
+<table>
+<tr>{{if .Accounts}}<th>Account</th>{{end}}<th>Principal</th>{{range .Services}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr>{{if $.Accounts}}<td>{{.Account}}</td>{{end}}<td title="{{.Arn}}">{{.Kind}} {{.Name}}</td>{{range .Levels}}<td class="{{.}}">{{.}}</td>{{end}}</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+func (m accessMatrix) writeHTML(w io.Writer) error {
+	data := struct {
+		Accounts bool
+		Services []string
+		Rows     []matrixRow
+	}{m.accounts, m.Services, m.Rows}
+	if err := htmlMatrix.Execute(w, data); err != nil {
+		return fmt.Errorf("rendering html matrix: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// networkKeys are the condition keys that limit where requests come from,
+// with how values of each read in a sentence.
+var networkKeys = map[string]string{
+	"aws:sourceip":     "from %s",
+	"aws:vpcsourceip":  "from private address %s",
+	"aws:sourcevpc":    "from %s",
+	"aws:sourcevpcarn": "from %s",
+	"aws:sourcevpce":   "through %s",
+}
+
+// conditionPhrase is a network or organization condition of a statement, in
+// words.
+type conditionPhrase struct {
+	negated bool
+	phrase  string
+}
+
+// conditionPhrases puts the clauses of c on any of keys in words.
+func conditionPhrases(c Condition, keys map[string]string) []conditionPhrase {
+	clauses := []conditionPhrase{}
+	for _, clause := range c.clauses() {
+		format, ok := keys[strings.ToLower(clause.key)]
+		if !ok {
+			continue
+		}
+		base := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(clause.operator, "ForAnyValue:"), "ForAllValues:"), "IfExists")
+		if _, negated, ok := conditionOperators(base); ok {
+			clauses = append(clauses, conditionPhrase{negated: negated, phrase: fmt.Sprintf(format, strings.Join(clause.values, " or "))})
+		}
+	}
+	return clauses
+}
+
+// describeNetwork puts the network conditions of a statement in words, such
+// as "only from 10.0.0.0/8 or through vpce-abc", or returns "" when it has
+// none. Separate keys of an Allow must all match; a Deny on requests from
+// outside several networks lets any of them through.
+func describeNetwork(s Statement) string {
+	clauses := conditionPhrases(s.Condition, networkKeys)
+	if len(clauses) == 0 {
+		return ""
+	}
+	phrases := []string{}
+	allNegated := true
+	for _, clause := range clauses {
+		phrases = append(phrases, clause.phrase)
+		allNegated = allNegated && clause.negated
+	}
+	switch {
+	case s.Effect == "Deny" && allNegated:
+		return "unless " + strings.Join(phrases, " or ")
+	case s.Effect == "Deny":
+		return "when " + strings.Join(phrases, " and ")
+	case allNegated:
+		return "except " + strings.Join(phrases, " and ")
+	}
+	return "only " + strings.Join(phrases, " and ")
+}
+
+// networkRestricted reports whether an Allow only applies from some
+// networks, through its own condition or through an unconditional network
+// Deny of everything it grants.
+func networkRestricted(s Statement, statements []Statement) bool {
+	if s.Effect != "Allow" {
+		return false
+	}
+	for _, clause := range conditionPhrases(s.Condition, networkKeys) {
+		if !clause.negated {
+			return true
+		}
+	}
+	for _, deny := range statements {
+		if deny.Effect != "Deny" || len(deny.Condition) == 0 {
+			continue
+		}
+		clauses := conditionPhrases(deny.Condition, networkKeys)
+		onlyNetwork := len(clauses) == len(deny.Condition.clauses())
+		negated := true
+		for _, clause := range clauses {
+			negated = negated && clause.negated
+		}
+		if onlyNetwork && negated && coversAll(deny.Action.Actions, s.Action.Actions) && coversAllResources(deny.Resource.Resources, s.Resource.Resources) {
+			return true
+		}
+	}
+	return false
+}
+
+// presentNetworkSummary prints how many Allow statements only apply from
+// some networks, when any do.
+func presentNetworkSummary(w io.Writer, statements []Statement) {
+	allows, restricted := 0, 0
+	for _, s := range statements {
+		if s.Effect != "Allow" {
+			continue
+		}
+		allows++
+		if networkRestricted(s, statements) {
+			restricted++
+		}
+	}
+	if restricted == 0 {
+		return
+	}
+	faint := color.New(color.Faint).SprintFunc()
+	fmt.Fprintln(w, faint(fmt.Sprintf("%d of %d Allow statements are network restricted", restricted, allows)))
+}
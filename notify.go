@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/spf13/pflag"
+)
+
+type notifyOptions struct {
+	webhook  string
+	snsTopic string
+}
+
+func (o *notifyOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.webhook, "notify-webhook", "", "POST a JSON description of every detected change to this URL")
+	flags.StringVar(&o.snsTopic, "notify-sns", "", "publish a JSON description of every detected change to this SNS topic arn")
+}
+
+// driftEvent describes a change to a principal's statements. Text is a one
+// line summary, which also lets the payload be posted straight to a Slack
+// incoming webhook.
+type driftEvent struct {
+	Text       string          `json:"text"`
+	Principal  string          `json:"principal"`
+	DetectedAt time.Time       `json:"detectedAt"`
+	Added      []jsonStatement `json:"added"`
+	Removed    []jsonStatement `json:"removed"`
+}
+
+func newDriftEvent(principal string, at time.Time, diff StatementDiff) driftEvent {
+	return driftEvent{
+		Text:       fmt.Sprintf("iam-show: permissions of %s changed (+%d -%d statements)", principal, len(diff.Added), len(diff.Removed)),
+		Principal:  principal,
+		DetectedAt: at.UTC(),
+		Added:      toJSONStatements(diff.Added),
+		Removed:    toJSONStatements(diff.Removed),
+	}
+}
+
+// notifier sends drift events to the configured destinations. A nil
+// *notifier is valid and sends nothing.
+type notifier struct {
+	webhook  string
+	snsTopic string
+	sns      *sns.Client
+	http     *http.Client
+}
+
+func (o *notifyOptions) newNotifier(cfg aws.Config) *notifier {
+	if o.webhook == "" && o.snsTopic == "" {
+		return nil
+	}
+	n := &notifier{webhook: o.webhook, snsTopic: o.snsTopic, http: &http.Client{Timeout: 30 * time.Second}}
+	if o.snsTopic != "" {
+		n.sns = sns.NewFromConfig(cfg)
+	}
+	return n
+}
+
+// Notify sends event to every destination, returning the first error after
+// trying them all.
+func (n *notifier) Notify(ctx context.Context, event driftEvent) error {
+	if n == nil {
+		return nil
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding notification: %w", err)
+	}
+
+	var firstErr error
+	if n.webhook != "" {
+		if err := n.postWebhook(ctx, payload); err != nil {
+			firstErr = err
+		}
+	}
+	if n.snsTopic != "" {
+		_, err := n.sns.Publish(ctx, &sns.PublishInput{
+			TopicArn: aws.String(n.snsTopic),
+			Subject:  aws.String(snsSubject(event.Text)),
+			Message:  aws.String(string(payload)),
+		}, func(o *sns.Options) {
+			if region := arnRegion(n.snsTopic); region != "" {
+				o.Region = region
+			}
+		})
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("publishing to %s: %w", n.snsTopic, err)
+		}
+	}
+	return firstErr
+}
+
+// snsSubject shortens text to the fewer than 100 characters SNS allows in a
+// subject.
+func snsSubject(text string) string {
+	if len(text) >= 100 {
+		return text[:96] + "..."
+	}
+	return text
+}
+
+func (n *notifier) postWebhook(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhook, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := n.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting to webhook: %w", err)
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("posting to webhook: %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSNSSubject(t *testing.T) {
+	tests := []struct {
+		length, want int
+	}{
+		{10, 10},
+		{99, 99},
+		{100, 99},
+		{250, 99},
+	}
+	for _, tt := range tests {
+		text := strings.Repeat("a", tt.length)
+		got := snsSubject(text)
+		if len(got) != tt.want {
+			t.Errorf("snsSubject of %d characters has %d, want %d", tt.length, len(got), tt.want)
+		}
+		if tt.length != tt.want && !strings.HasSuffix(got, "...") {
+			t.Errorf("snsSubject of %d characters = %q, want it to end with ...", tt.length, got)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// optimizeReport records what optimizeStatements changed, one line per
+// change.
+type optimizeReport struct {
+	redundantActions   []string
+	duplicateResources []string
+	merged             []string
+	covered            []string
+}
+
+func (r optimizeReport) empty() bool {
+	return len(r.redundantActions)+len(r.duplicateResources)+len(r.merged)+len(r.covered) == 0
+}
+
+// optimizeStatements returns statements equivalent to the given ones but
+// fewer and smaller where possible: actions and resources covered by a
+// wildcard in the same statement are dropped, statements with the same
+// effect, condition and principals that share their actions or their
+// resources are merged, and statements covered by another are dropped. It
+// repeats until nothing changes, since each step can make another possible.
+//
+// Statements with NotAction or NotResource apply to everything but what
+// they list, which the steps do not take into account, so they are refused
+// rather than optimized into a document allowing something else.
+func optimizeStatements(statements []Statement) ([]Statement, optimizeReport, error) {
+	for _, s := range statements {
+		if s.negated() {
+			return nil, optimizeReport{}, fmt.Errorf("%s uses NotAction or NotResource, which optimize does not handle: its result would allow something else", describeStatement(s))
+		}
+	}
+	report := optimizeReport{}
+	out := []Statement{}
+	for _, s := range normalizeStatements(statements) {
+		s.Source = StatementSource{}
+		out = append(out, s)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := range out {
+			if pruneStatement(&out[i], &report) {
+				changed = true
+			}
+		}
+		if merged, ok := mergeStatements(out, &report); ok {
+			out = merged
+			changed = true
+		}
+		if kept, ok := dropCovered(out, &report); ok {
+			out = kept
+			changed = true
+		}
+	}
+	return normalizeStatements(out), report, nil
+}
+
+// pruneStatement removes the actions and resources of s that another of its
+// actions or resources already covers.
+func pruneStatement(s *Statement, report *optimizeReport) bool {
+	actions := []string{}
+	for _, a := range s.Action.Actions {
+		actions = append(actions, string(a))
+	}
+	keptActions, removed := pruneCovered(actions, wildcardMatch, strings.EqualFold)
+	report.redundantActions = append(report.redundantActions, removed...)
+	keptResources, duplicates := pruneCovered(s.Resource.Resources, resourceMatch, func(a, b string) bool { return a == b })
+	report.duplicateResources = append(report.duplicateResources, duplicates...)
+	if len(removed) == 0 && len(duplicates) == 0 {
+		return false
+	}
+
+	s.Action.Actions = []Action{}
+	for _, a := range keptActions {
+		s.Action.Actions = append(s.Action.Actions, Action(a))
+	}
+	s.Resource.Resources = keptResources
+	return true
+}
+
+// pruneCovered keeps the values no other value matches, the first of any
+// equal ones, and describes each value it drops.
+func pruneCovered(values []string, match func(pattern, s string) bool, equal func(a, b string) bool) ([]string, []string) {
+	kept := []string{}
+	removed := []string{}
+	for i, v := range values {
+		coveredBy := ""
+		for j, other := range values {
+			if i == j {
+				continue
+			}
+			if equal(v, other) {
+				if j < i {
+					coveredBy = other
+					break
+				}
+				continue
+			}
+			// of two patterns matching each other, keep the first
+			if match(other, v) && (j < i || !match(v, other)) {
+				coveredBy = other
+				break
+			}
+		}
+		switch {
+		case coveredBy == "":
+			kept = append(kept, v)
+		case equal(v, coveredBy):
+			removed = append(removed, fmt.Sprintf("%s listed twice", v))
+		default:
+			removed = append(removed, fmt.Sprintf("%s covered by %s", v, coveredBy))
+		}
+	}
+	return kept, removed
+}
+
+// mergeStatements merges the first pair of statements with the same effect,
+// condition and principals and either the same actions or the same resources.
+func mergeStatements(statements []Statement, report *optimizeReport) ([]Statement, bool) {
+	for i := range statements {
+		for j := i + 1; j < len(statements); j++ {
+			a, b := statements[i], statements[j]
+			if a.Effect != b.Effect || a.Condition.key() != b.Condition.key() || principalsKey(a) != principalsKey(b) {
+				continue
+			}
+			merged := a
+			switch {
+			case actionSetKey(a) == actionSetKey(b):
+				merged.Resource.Resources = append(append([]string{}, a.Resource.Resources...), b.Resource.Resources...)
+				report.merged = append(report.merged, fmt.Sprintf("%s on %s with %s", joinActions(a.Action.Actions), strings.Join(a.Resource.Resources, ", "), strings.Join(b.Resource.Resources, ", ")))
+			case resourceSetKey(a) == resourceSetKey(b):
+				merged.Action.Actions = append(append([]Action{}, a.Action.Actions...), b.Action.Actions...)
+				report.merged = append(report.merged, fmt.Sprintf("%s with %s on %s", joinActions(a.Action.Actions), joinActions(b.Action.Actions), strings.Join(a.Resource.Resources, ", ")))
+			default:
+				continue
+			}
+			out := append([]Statement{}, statements[:j]...)
+			out = append(out, statements[j+1:]...)
+			out[i] = normalizeStatements([]Statement{merged})[0]
+			return out, true
+		}
+	}
+	return statements, false
+}
+
+// dropCovered drops the statements whose every action and resource another
+// statement with the same effect and principals also matches, when that statement has the
+// same condition or none.
+func dropCovered(statements []Statement, report *optimizeReport) ([]Statement, bool) {
+	for i, s := range statements {
+		for j, other := range statements {
+			if i == j || s.Effect != other.Effect || principalsKey(s) != principalsKey(other) {
+				continue
+			}
+			if len(other.Condition) > 0 && s.Condition.key() != other.Condition.key() {
+				continue
+			}
+			if coversAll(other.Action.Actions, s.Action.Actions) && coversAllResources(other.Resource.Resources, s.Resource.Resources) {
+				report.covered = append(report.covered, fmt.Sprintf("%s on %s covered by %s on %s",
+					joinActions(s.Action.Actions), strings.Join(s.Resource.Resources, ", "), joinActions(other.Action.Actions), strings.Join(other.Resource.Resources, ", ")))
+				out := append([]Statement{}, statements[:i]...)
+				return append(out, statements[i+1:]...), true
+			}
+		}
+	}
+	return statements, false
+}
+
+func coversAll(patterns, actions []Action) bool {
+	for _, a := range actions {
+		matched := false
+		for _, p := range patterns {
+			if wildcardMatch(string(p), string(a)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func coversAllResources(patterns, resources []string) bool {
+	for _, r := range resources {
+		matched := false
+		for _, p := range patterns {
+			if resourceMatch(p, r) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// principalsKey identifies who a statement of a resource policy applies to,
+// so that statements granting different principals are never combined.
+func principalsKey(s Statement) string {
+	return strings.Join(s.Principal.names(), ",") + "\n!" + strings.Join(s.NotPrincipal.names(), ",")
+}
+
+// actionSetKey and resourceSetKey identify the actions or resources of a
+// statement regardless of order and, for actions, case.
+func actionSetKey(s Statement) string {
+	actions := []string{}
+	for _, a := range s.Action.Actions {
+		actions = append(actions, strings.ToLower(string(a)))
+	}
+	sort.Strings(actions)
+	return strings.Join(actions, ",")
+}
+
+func resourceSetKey(s Statement) string {
+	resources := append([]string{}, s.Resource.Resources...)
+	sort.Strings(resources)
+	return strings.Join(resources, ",")
+}
+
+// policySize is the size IAM would count for a document holding statements.
+func policySize(statements []Statement) int {
+	data, _ := json.Marshal(RawPolicy{Version: policyVersion, Statement: DynamicStatement{Statements: statements}})
+	return documentSize(string(data))
+}
+
+func presentOptimizeReport(w io.Writer, before, after []Statement, report optimizeReport) {
+	bold := color.New(color.Bold).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+
+	fmt.Fprintf(w, "%s\n", bold("==> optimizations <=="))
+	if report.empty() {
+		fmt.Fprintln(w, faint("nothing to optimize"))
+	}
+	sections := []struct {
+		title string
+		lines []string
+	}{
+		{"redundant actions", report.redundantActions},
+		{"duplicate resources", report.duplicateResources},
+		{"merged statements", report.merged},
+		{"covered statements", report.covered},
+	}
+	for _, section := range sections {
+		if len(section.lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s (%d)\n", section.title, len(section.lines))
+		for _, line := range section.lines {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	fmt.Fprintf(w, "statements %d -> %d, size %d -> %d characters\n",
+		len(before), len(after), policySize(before), policySize(after))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOptimizeStatements(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     string
+		changed  bool
+	}{
+		{
+			name:     "redundant action",
+			document: `{"Statement":[{"Effect":"Allow","Action":["s3:GetObject","s3:*"],"Resource":"*"}]}`,
+			want:     `[{"Effect":"Allow","Action":"s3:*","Resource":"*"}]`,
+			changed:  true,
+		},
+		{
+			name: "same actions",
+			document: `{"Statement":[
+				{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::a/*"},
+				{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			want:    `[{"Effect":"Allow","Action":"s3:GetObject","Resource":["arn:aws:s3:::a/*","arn:aws:s3:::b/*"]}]`,
+			changed: true,
+		},
+		{
+			name: "same resources",
+			document: `{"Statement":[
+				{"Effect":"Allow","Action":"s3:PutObject","Resource":"arn:aws:s3:::a/*"},
+				{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::a/*"}]}`,
+			want:    `[{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":"arn:aws:s3:::a/*"}]`,
+			changed: true,
+		},
+		{
+			name: "covered",
+			document: `{"Statement":[
+				{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::a/b"},
+				{"Effect":"Allow","Action":"s3:Get*","Resource":"arn:aws:s3:::a/*"}]}`,
+			want:    `[{"Effect":"Allow","Action":"s3:Get*","Resource":"arn:aws:s3:::a/*"}]`,
+			changed: true,
+		},
+		{
+			name: "different conditions",
+			document: `{"Statement":[
+				{"Effect":"Allow","Action":"s3:GetObject","Resource":"*","Condition":{"Bool":{"aws:MultiFactorAuthPresent":"true"}}},
+				{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]}`,
+			want: `[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*","Condition":{"Bool":{"aws:MultiFactorAuthPresent":"true"}}},` +
+				`{"Effect":"Allow","Action":"s3:PutObject","Resource":"*"}]`,
+		},
+		{
+			name: "different principals",
+			document: `{"Statement":[
+				{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:role/a"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/a/*"},
+				{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::222222222222:root"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			want: `[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::222222222222:root"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"},` +
+				`{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:role/a"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/a/*"}]`,
+		},
+		{
+			name: "same principal",
+			document: `{"Statement":[
+				{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:role/a"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/a/*"},
+				{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:role/a"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]}`,
+			want:    `[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:role/a"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}]`,
+			changed: true,
+		},
+		{
+			name: "allow and deny",
+			document: `{"Statement":[
+				{"Effect":"Allow","Action":"s3:*","Resource":"*"},
+				{"Effect":"Deny","Action":"s3:DeleteObject","Resource":"*"}]}`,
+			want: `[{"Effect":"Allow","Action":"s3:*","Resource":"*"},{"Effect":"Deny","Action":"s3:DeleteObject","Resource":"*"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			optimized, report, err := optimizeStatements(mustParse(t, tt.document))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(optimized)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("optimized to %s, want %s", got, tt.want)
+			}
+			if report.empty() == tt.changed {
+				t.Errorf("report empty = %v, want %v", report.empty(), !tt.changed)
+			}
+		})
+	}
+}
+
+func TestOptimizeStatementsRefusesNegated(t *testing.T) {
+	for _, document := range []string{
+		`{"Statement":[{"Effect":"Allow","NotAction":"iam:*","Resource":"*"}]}`,
+		`{"Statement":[{"Effect":"Deny","Action":"s3:*","NotResource":"arn:aws:s3:::logs/*"}]}`,
+	} {
+		if _, _, err := optimizeStatements(mustParse(t, document)); err == nil {
+			t.Errorf("optimizeStatements(%s) did not fail", document)
+		}
+	}
+}
+
+func TestCoversAll(t *testing.T) {
+	tests := []struct {
+		patterns, actions []Action
+		want              bool
+	}{
+		{[]Action{"s3:*"}, []Action{"s3:GetObject", "s3:PutObject"}, true},
+		{[]Action{"s3:Get*"}, []Action{"s3:GetObject", "s3:PutObject"}, false},
+		{[]Action{"s3:Get*", "s3:Put*"}, []Action{"S3:getobject", "s3:PutObject"}, true},
+		{[]Action{"s3:GetObject"}, []Action{"s3:*"}, false},
+		{nil, []Action{"s3:GetObject"}, false},
+	}
+	for _, tt := range tests {
+		if got := coversAll(tt.patterns, tt.actions); got != tt.want {
+			t.Errorf("coversAll(%v, %v) = %v, want %v", tt.patterns, tt.actions, got, tt.want)
+		}
+	}
+}
+
+func TestCoversAllResources(t *testing.T) {
+	tests := []struct {
+		patterns, resources []string
+		want                bool
+	}{
+		{[]string{"*"}, []string{"arn:aws:s3:::a"}, true},
+		{[]string{"arn:aws:s3:::a/*"}, []string{"arn:aws:s3:::a/b", "arn:aws:s3:::a/c"}, true},
+		{[]string{"arn:aws:s3:::a/*"}, []string{"arn:aws:s3:::a"}, false},
+		{[]string{"arn:aws:s3:::a/*"}, []string{"*"}, false},
+	}
+	for _, tt := range tests {
+		if got := coversAllResources(tt.patterns, tt.resources); got != tt.want {
+			t.Errorf("coversAllResources(%v, %v) = %v, want %v", tt.patterns, tt.resources, got, tt.want)
+		}
+	}
+}
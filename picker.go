@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/fatih/color"
+)
+
+const maxPickerMatches = 20
+
+type Candidate struct {
+	Kind string
+	Name string
+	Arn  string
+}
+
+// ListPrincipals lists every role and user, or only those whose path starts
+// with pathPrefix when it is set.
+func (f *Fetcher) ListPrincipals(ctx context.Context, pathPrefix string) ([]Candidate, error) {
+	roles, err := f.listRoleCandidates(ctx, pathPrefix)
+	if err != nil {
+		return nil, err
+	}
+	users, err := f.listUserCandidates(ctx, pathPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return append(roles, users...), nil
+}
+
+func (f *Fetcher) listRoleCandidates(ctx context.Context, pathPrefix string) ([]Candidate, error) {
+	candidates := []Candidate{}
+	var prefix *string
+	if pathPrefix != "" {
+		prefix = aws.String(pathPrefix)
+	}
+	roles := iam.NewListRolesPaginator(f.client, &iam.ListRolesInput{PathPrefix: prefix})
+	for roles.HasMorePages() {
+		page, err := roles.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing roles: %w", err)
+		}
+		for _, role := range page.Roles {
+			candidates = append(candidates, Candidate{Kind: "role", Name: *role.RoleName, Arn: *role.Arn})
+		}
+	}
+	return candidates, nil
+}
+
+func (f *Fetcher) listUserCandidates(ctx context.Context, pathPrefix string) ([]Candidate, error) {
+	candidates := []Candidate{}
+	var prefix *string
+	if pathPrefix != "" {
+		prefix = aws.String(pathPrefix)
+	}
+	users := iam.NewListUsersPaginator(f.client, &iam.ListUsersInput{PathPrefix: prefix})
+	for users.HasMorePages() {
+		page, err := users.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing users: %w", err)
+		}
+		for _, user := range page.Users {
+			candidates = append(candidates, Candidate{Kind: "user", Name: *user.UserName, Arn: *user.Arn})
+		}
+	}
+	return candidates, nil
+}
+
+// fuzzyScore reports whether every rune of query appears in s in order, and
+// scores the match so that contiguous runs and matches at word boundaries
+// rank higher.
+func fuzzyScore(query, s string) (int, bool) {
+	query = strings.ToLower(query)
+	target := []rune(strings.ToLower(s))
+
+	score := 0
+	pos := 0
+	prev := -2
+	for _, q := range query {
+		found := false
+		for ; pos < len(target); pos++ {
+			if target[pos] != q {
+				continue
+			}
+			score++
+			if pos == prev+1 {
+				score += 3
+			}
+			if pos == 0 || !unicode.IsLetter(target[pos-1]) && !unicode.IsDigit(target[pos-1]) {
+				score += 2
+			}
+			prev = pos
+			pos++
+			found = true
+			break
+		}
+		if !found {
+			return 0, false
+		}
+	}
+
+	return score*100 - len(target), true
+}
+
+func filterCandidates(query string, candidates []Candidate) []Candidate {
+	type scored struct {
+		candidate Candidate
+		score     int
+	}
+
+	matches := []scored{}
+	for _, candidate := range candidates {
+		if score, ok := fuzzyScore(query, candidate.Name); ok {
+			matches = append(matches, scored{candidate, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].candidate.Name < matches[j].candidate.Name
+	})
+
+	out := []Candidate{}
+	for _, match := range matches {
+		out = append(out, match.candidate)
+	}
+	return out
+}
+
+// Pick runs an interactive search over candidates, reading queries and
+// selections from r, and returns the chosen candidate. With orNone, an
+// empty first search picks no candidate.
+func Pick(r io.Reader, w io.Writer, candidates []Candidate, orNone bool) (Candidate, error) {
+	if len(candidates) == 0 {
+		return Candidate{}, fmt.Errorf("no roles or users to pick from")
+	}
+
+	faint := color.New(color.Faint).SprintFunc()
+	scanner := bufio.NewScanner(r)
+	matches := []Candidate{}
+
+	if orNone {
+		fmt.Fprint(w, "search, or press enter for the caller identity> ")
+	} else {
+		fmt.Fprint(w, "search> ")
+	}
+	for first := true; scanner.Scan(); first = false {
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" && first && orNone {
+			return Candidate{}, nil
+		}
+
+		if n, err := strconv.Atoi(input); err == nil && len(matches) > 0 {
+			if n >= 1 && n <= len(matches) && n <= maxPickerMatches {
+				return matches[n-1], nil
+			}
+			fmt.Fprintf(w, "no match numbered %d\n", n)
+			fmt.Fprint(w, "select a number or refine the search> ")
+			continue
+		}
+
+		matches = filterCandidates(input, candidates)
+		switch len(matches) {
+		case 0:
+			fmt.Fprintln(w, "no matches")
+			fmt.Fprint(w, "search> ")
+			continue
+		case 1:
+			return matches[0], nil
+		}
+
+		for i, match := range matches {
+			if i == maxPickerMatches {
+				fmt.Fprintln(w, faint(fmt.Sprintf("... %d more", len(matches)-maxPickerMatches)))
+				break
+			}
+			fmt.Fprintf(w, "%3d) %s %s\n", i+1, match.Name, faint(match.Kind))
+		}
+		fmt.Fprint(w, "select a number or refine the search> ")
+	}
+	if err := scanner.Err(); err != nil {
+		return Candidate{}, fmt.Errorf("reading selection: %w", err)
+	}
+
+	return Candidate{}, fmt.Errorf("no principal selected")
+}
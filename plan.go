@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// plannedCall is an API operation the fetcher would make, described without
+// making it.
+type plannedCall struct {
+	Operation string
+	Detail    string
+}
+
+// planPrincipalPolicies plans the calls for a role or user, where kind is
+// "Role" or "User" as used in the IAM operation names.
+func planPrincipalPolicies(kind, name string) []plannedCall {
+	return []plannedCall{
+		{"iam:ListAttached" + kind + "Policies", fmt.Sprintf("%sName=%s", kind, name)},
+		{"iam:List" + kind + "Policies", fmt.Sprintf("%sName=%s", kind, name)},
+		{"iam:GetPolicy", "for each attached policy"},
+		{"iam:GetPolicyVersion", "for each attached policy not in the cache"},
+		{"iam:Get" + kind + "Policy", "for each inline policy"},
+	}
+}
+
+// Plan lists the API calls needed to show target, resolving its type from
+// the arn alone.
+func (f *Fetcher) Plan(target string) []plannedCall {
+	if !strings.HasPrefix(target, "arn:") {
+		return []plannedCall{
+			{"iam:GetRole", "RoleName=" + target},
+			{"iam:GetUser", "UserName=" + target + ", if no role matched"},
+			{"sts:GetCallerIdentity", "if no user matched, to build the policy arn"},
+			{"iam:GetPolicy", "PolicyArn=arn:<partition>:iam::<account>:policy/" + target + ", if no user matched"},
+			{"...", "then the calls for the matching role, user or policy"},
+		}
+	}
+
+	switch f.arnType(target) {
+	case RoleArn, AssumedRoleArn:
+		roleName, err := principalName(target)
+		if err != nil {
+			return nil
+		}
+		return planPrincipalPolicies("Role", roleName)
+	case UserArn:
+		userName, err := principalName(target)
+		if err != nil {
+			return nil
+		}
+		return append(planPrincipalPolicies("User", userName),
+			plannedCall{"iam:ListGroupsForUser", "UserName=" + userName},
+			plannedCall{"iam:ListAttachedGroupPolicies", "for each group"},
+			plannedCall{"iam:ListGroupPolicies", "for each group"},
+			plannedCall{"iam:GetGroupPolicy", "for each inline group policy"},
+		)
+	case PolicyArn:
+		return []plannedCall{
+			{"iam:GetPolicy", "PolicyArn=" + target},
+			{"iam:GetPolicyVersion", "PolicyArn=" + target + ", unless cached"},
+		}
+	case CodeBuildArn:
+		_, projectName, _ := strings.Cut(target, ":project/")
+		return append([]plannedCall{
+			{"codebuild:BatchGetProjects", "Names=" + projectName + ", Region=" + arnRegion(target)},
+		}, planPrincipalPolicies("Role", "<service role>")...)
+	case CodePipelineArn:
+		parsed, _ := awsarn.Parse(target)
+		return append([]plannedCall{
+			{"codepipeline:GetPipeline", "Name=" + parsed.Resource + ", Region=" + arnRegion(target)},
+		}, planPrincipalPolicies("Role", "<service role>")...)
+	default:
+		return nil
+	}
+}
+
+func presentPlan(w io.Writer, target, kind string, calls []plannedCall) {
+	fmt.Fprintf(w, "%s (%s)\n", target, kind)
+	for _, call := range calls {
+		fmt.Fprintf(w, "  %-32s %s\n", call.Operation, call.Detail)
+	}
+}
+
+func (f *Fetcher) describeTarget(target string) string {
+	if !strings.HasPrefix(target, "arn:") {
+		return "name to resolve"
+	}
+	return string(f.arnType(target))
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type Action string
+type Resource string
+
+type RawPolicy struct {
+	Version   string           `json:"Version"`
+	Statement DynamicStatement `json:"Statement"`
+}
+
+type Statement struct {
+	Sid    string        `json:"Sid,omitempty"`
+	Action DynamicAction `json:"Action"`
+	// NotAction, NotResource and NotPrincipal make the statement apply to
+	// everything but what they list, in place of Action, Resource and
+	// Principal.
+	NotAction   DynamicAction   `json:"NotAction"`
+	Resource    DynamicResource `json:"Resource"`
+	NotResource DynamicResource `json:"NotResource"`
+	Effect      string          `json:"Effect"`
+	Condition   Condition       `json:"Condition,omitempty"`
+	// Principal is only set in trust and resource policies.
+	Principal    StatementPrincipal `json:"Principal,omitempty"`
+	NotPrincipal StatementPrincipal `json:"NotPrincipal,omitempty"`
+
+	Source StatementSource `json:"-"`
+}
+
+// MarshalJSON writes the statement as a policy document does, leaving out
+// whichever of Action and NotAction, and of Resource and NotResource, are
+// empty.
+func (s Statement) MarshalJSON() ([]byte, error) {
+	type document struct {
+		Sid          string             `json:"Sid,omitempty"`
+		Effect       string             `json:"Effect"`
+		Principal    StatementPrincipal `json:"Principal,omitempty"`
+		NotPrincipal StatementPrincipal `json:"NotPrincipal,omitempty"`
+		Action       *DynamicAction     `json:"Action,omitempty"`
+		NotAction    *DynamicAction     `json:"NotAction,omitempty"`
+		Resource     *DynamicResource   `json:"Resource,omitempty"`
+		NotResource  *DynamicResource   `json:"NotResource,omitempty"`
+		Condition    Condition          `json:"Condition,omitempty"`
+	}
+	d := document{Sid: s.Sid, Effect: s.Effect, Principal: s.Principal, NotPrincipal: s.NotPrincipal, Condition: s.Condition}
+	if len(s.Action.Actions) > 0 {
+		d.Action = &s.Action
+	}
+	if len(s.NotAction.Actions) > 0 {
+		d.NotAction = &s.NotAction
+	}
+	if len(s.Resource.Resources) > 0 {
+		d.Resource = &s.Resource
+	}
+	if len(s.NotResource.Resources) > 0 {
+		d.NotResource = &s.NotResource
+	}
+	return json.Marshal(d)
+}
+
+// negated reports whether the statement uses NotAction or NotResource.
+func (s Statement) negated() bool {
+	return len(s.NotAction.Actions) > 0 || len(s.NotResource.Resources) > 0
+}
+
+// matchesAction reports whether the statement applies to action: one of its
+// actions matches it, or with NotAction, none of those do.
+func (s Statement) matchesAction(action Action) bool {
+	if len(s.NotAction.Actions) > 0 {
+		return !anyActionMatches(s.NotAction.Actions, action)
+	}
+	return anyActionMatches(s.Action.Actions, action)
+}
+
+func anyActionMatches(patterns []Action, action Action) bool {
+	for _, pattern := range patterns {
+		if wildcardMatch(string(pattern), string(action)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesResource is matchesAction for a resource arn. The resource "*"
+// stands for any resource, so it matches every statement but one leaving
+// out every resource.
+func (s Statement) matchesResource(resource string) bool {
+	if len(s.NotResource.Resources) > 0 {
+		for _, pattern := range s.NotResource.Resources {
+			if pattern == "*" || resource != "*" && resourceMatch(pattern, resource) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, pattern := range s.Resource.Resources {
+		if resource == "*" || resourceMatch(pattern, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// StatementPrincipal maps principal types such as AWS or Service to who the
+// statement applies to. The "*" principal, meaning anyone, is kept as the
+// AWS principal "*", which IAM treats the same.
+type StatementPrincipal map[string]ConditionValues
+
+func (p *StatementPrincipal) UnmarshalJSON(data []byte) error {
+	var anyone string
+	if err := json.Unmarshal(data, &anyone); err == nil {
+		if anyone != "*" {
+			return fmt.Errorf("invalid principal %q", anyone)
+		}
+		*p = StatementPrincipal{"AWS": {"*"}}
+		return nil
+	}
+	principals := map[string]ConditionValues{}
+	if err := json.Unmarshal(data, &principals); err != nil {
+		return fmt.Errorf("unmarshalling principal: %w", err)
+	}
+	*p = principals
+	return nil
+}
+
+// names lists the principals as type and value, such as
+// "Service ec2.amazonaws.com", sorted.
+func (p StatementPrincipal) names() []string {
+	names := []string{}
+	for kind, values := range p {
+		for _, v := range values {
+			names = append(names, kind+" "+v)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Condition maps condition operators such as StringEquals to the keys they
+// test and the values each key is compared with.
+type Condition map[string]map[string]ConditionValues
+
+// key is a canonical form of the condition, for telling whether two
+// statements have the same one.
+func (c Condition) key() string {
+	if len(c) == 0 {
+		return ""
+	}
+	canonical := map[string]map[string][]string{}
+	for operator, keys := range c {
+		canonical[operator] = map[string][]string{}
+		for k, values := range keys {
+			sorted := append([]string{}, values...)
+			sort.Strings(sorted)
+			// condition keys are case insensitive, operators are not
+			canonical[operator][strings.ToLower(k)] = sorted
+		}
+	}
+	data, _ := json.Marshal(canonical)
+	return string(data)
+}
+
+// ConditionValues holds the values of a condition key. Policies may give a
+// single value or a list, and booleans or numbers as well as strings.
+type ConditionValues []string
+
+func (v *ConditionValues) UnmarshalJSON(data []byte) error {
+	var raw []interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		var single interface{}
+		if err := json.Unmarshal(data, &single); err != nil {
+			return fmt.Errorf("unmarshalling condition values: %w", err)
+		}
+		raw = []interface{}{single}
+	}
+	values := ConditionValues{}
+	for _, r := range raw {
+		switch r := r.(type) {
+		case string:
+			values = append(values, r)
+		case nil:
+			values = append(values, "null")
+		default:
+			values = append(values, fmt.Sprint(r))
+		}
+	}
+	*v = values
+	return nil
+}
+
+func (v ConditionValues) MarshalJSON() ([]byte, error) {
+	if len(v) == 1 {
+		return json.Marshal(v[0])
+	}
+	return json.Marshal([]string(v))
+}
+
+// StatementSource records which policy document a statement came from.
+// Arn and Version are empty for inline policies, and Group is set when a
+// user has the policy through a group. Principal is the role or user it was
+// fetched for and Calls the API calls that led to it, in order.
+type StatementSource struct {
+	Policy    string
+	Arn       string
+	Version   string
+	Index     int
+	Group     string
+	Size      int
+	Principal string
+	Calls     []string
+}
+
+func withSource(statements []Statement, source StatementSource) []Statement {
+	for i := range statements {
+		statements[i].Source = source
+		statements[i].Source.Index = i
+	}
+	return statements
+}
+
+// withGroup returns a copy of statements attributed to group. Managed
+// policy statements are shared between principals, so they are not changed
+// in place.
+func withGroup(statements []Statement, group string) []Statement {
+	out := make([]Statement, len(statements))
+	for i, statement := range statements {
+		statement.Source.Group = group
+		out[i] = statement
+	}
+	return out
+}
+
+// withProvenance returns a copy of statements with calls put before the
+// calls that fetched them, and attributed to principal unless they already
+// are, for the same reason as withGroup.
+func withProvenance(statements []Statement, principal string, calls []string) []Statement {
+	if statements == nil {
+		return nil
+	}
+	out := make([]Statement, len(statements))
+	for i, statement := range statements {
+		if statement.Source.Principal == "" {
+			statement.Source.Principal = principal
+		}
+		statement.Source.Calls = append(append([]string{}, calls...), statement.Source.Calls...)
+		out[i] = statement
+	}
+	return out
+}
+
+type DynamicStatement struct {
+	Statements []Statement
+}
+
+func (d *DynamicStatement) UnmarshalJSON(data []byte) error {
+	statements := []Statement{}
+	if err := json.Unmarshal(data, &statements); err != nil {
+		var s Statement
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("unmarshalling statements: %w", err)
+		}
+
+		d.Statements = append(d.Statements, s)
+	} else {
+		d.Statements = statements
+	}
+
+	return nil
+}
+
+// MarshalJSON always writes a list, which IAM accepts even for a single
+// statement.
+func (d DynamicStatement) MarshalJSON() ([]byte, error) {
+	if d.Statements == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(d.Statements)
+}
+
+type DynamicAction struct {
+	Actions []Action
+}
+
+func (d *DynamicAction) UnmarshalJSON(data []byte) error {
+	actions := []Action{}
+	if err := json.Unmarshal(data, &actions); err != nil {
+		var s Action
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("unmarshalling actions: %w", err)
+		}
+
+		d.Actions = append(d.Actions, s)
+	} else {
+		d.Actions = actions
+	}
+
+	return nil
+}
+
+func (d DynamicAction) MarshalJSON() ([]byte, error) {
+	if len(d.Actions) == 1 {
+		return json.Marshal(d.Actions[0])
+	}
+	return json.Marshal(d.Actions)
+}
+
+type DynamicResource struct {
+	Resources []string
+}
+
+func (d *DynamicResource) UnmarshalJSON(data []byte) error {
+	resources := []string{}
+	if err := json.Unmarshal(data, &resources); err != nil {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("unmarshalling resources: %w", err)
+		}
+
+		d.Resources = append(d.Resources, s)
+	} else {
+		d.Resources = resources
+	}
+
+	return nil
+}
+
+func (d DynamicResource) MarshalJSON() ([]byte, error) {
+	if len(d.Resources) == 1 {
+		return json.Marshal(d.Resources[0])
+	}
+	return json.Marshal(d.Resources)
+}
+
+// documentSize is the length of a url encoded policy document as IAM
+// counts it against its quotas, which ignore whitespace.
+func documentSize(document string) int {
+	if decoded, err := url.PathUnescape(document); err == nil {
+		document = decoded
+	}
+	size := 0
+	for _, r := range document {
+		if !unicode.IsSpace(r) {
+			size++
+		}
+	}
+	return size
+}
+
+// decodeDocument parses a url encoded policy document as returned by the
+// IAM API.
+func decodeDocument(document string) ([]Statement, error) {
+	document, err := url.PathUnescape(document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+	return parseDocument([]byte(document))
+}
+
+func parseDocument(document []byte) ([]Statement, error) {
+	var policy RawPolicy
+	if err := json.Unmarshal(document, &policy); err != nil {
+		return nil, fmt.Errorf("decoding document: %w", err)
+	}
+
+	return policy.Statement.Statements, nil
+}
+
+// readPolicyFile parses a plain JSON policy document from path, or from
+// stdin when path is "-".
+func readPolicyFile(path string) ([]Statement, error) {
+	var document []byte
+	var err error
+	if path == "-" {
+		document, err = io.ReadAll(os.Stdin)
+	} else {
+		document, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file: %w", err)
+	}
+	statements, err := parseDocument(document)
+	if err != nil {
+		return nil, err
+	}
+	return withSource(statements, StatementSource{Policy: path}), nil
+}
+
+// wildcardMatch reports whether s matches pattern, where * matches any run of
+// characters and ? matches a single one. Matching is case insensitive, as it
+// is for IAM actions.
+func wildcardMatch(pattern, s string) bool {
+	return globMatch([]rune(strings.ToLower(pattern)), []rune(strings.ToLower(s)))
+}
+
+// resourceMatch is wildcardMatch for resource arns, which are case
+// sensitive.
+func resourceMatch(pattern, s string) bool {
+	return globMatch([]rune(pattern), []rune(s))
+}
+
+// patternsOverlap reports whether some string matches both wildcard
+// patterns, comparing case sensitively as for resource arns.
+func patternsOverlap(a, b string) bool {
+	p, q := []rune(a), []rune(b)
+	seen := map[[2]int]bool{}
+	var overlap func(i, j int) bool
+	overlap = func(i, j int) bool {
+		if i == len(p) && j == len(q) {
+			return true
+		}
+		if seen[[2]int{i, j}] {
+			return false
+		}
+		seen[[2]int{i, j}] = true
+		switch {
+		case i < len(p) && p[i] == '*':
+			return overlap(i+1, j) || (j < len(q) && overlap(i, j+1))
+		case j < len(q) && q[j] == '*':
+			return overlap(i, j+1) || (i < len(p) && overlap(i+1, j))
+		case i < len(p) && j < len(q):
+			return (p[i] == q[j] || p[i] == '?' || q[j] == '?') && overlap(i+1, j+1)
+		}
+		return false
+	}
+	return overlap(0, 0)
+}
+
+func globMatch(p, t []rune) bool {
+	pi, ti := 0, 0
+	star, mark := -1, 0
+	for ti < len(t) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == t[ti]):
+			pi++
+			ti++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ti
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			ti = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
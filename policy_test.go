@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// mustParse parses a policy document, failing the test if it is invalid.
+func mustParse(t *testing.T, document string) []Statement {
+	t.Helper()
+	statements, err := parseDocument([]byte(document))
+	if err != nil {
+		t.Fatalf("parsing %s: %v", document, err)
+	}
+	return statements
+}
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "s3:GetObject", true},
+		{"s3:*", "s3:GetObject", true},
+		{"s3:Get*", "s3:GetObject", true},
+		{"s3:get*", "S3:GetObject", true},
+		{"s3:Get*", "s3:PutObject", false},
+		{"s3:Get?bject", "s3:GetObject", true},
+		{"s3:Get?", "s3:GetObject", false},
+		{"ec2:*Instances", "ec2:DescribeInstances", true},
+		{"s3:GetObject", "s3:GetObjectAcl", false},
+	}
+	for _, tt := range tests {
+		if got := wildcardMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("wildcardMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestResourceMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "arn:aws:s3:::logs", true},
+		{"arn:aws:s3:::logs/*", "arn:aws:s3:::logs/2024/01.gz", true},
+		{"arn:aws:s3:::logs/*", "arn:aws:s3:::logs", false},
+		{"arn:aws:s3:::Logs/*", "arn:aws:s3:::logs/a", false},
+		{"arn:aws:iam::*:role/app-?", "arn:aws:iam::111111111111:role/app-1", true},
+	}
+	for _, tt := range tests {
+		if got := resourceMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("resourceMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestPatternsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"arn:aws:s3:::logs/*", "arn:aws:s3:::*", true},
+		{"arn:aws:s3:::logs/*", "arn:aws:s3:::data/*", false},
+		{"arn:aws:s3:::*/a", "arn:aws:s3:::b/*", true},
+		{"arn:aws:s3:::a?", "arn:aws:s3:::ab", true},
+		{"arn:aws:s3:::a", "arn:aws:s3:::b", false},
+	}
+	for _, tt := range tests {
+		if got := patternsOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("patternsOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestStatementMatches(t *testing.T) {
+	statements := mustParse(t, `{"Statement":[
+		{"Effect":"Allow","Action":["s3:Get*"],"Resource":"arn:aws:s3:::logs/*"},
+		{"Effect":"Allow","NotAction":["iam:*"],"Resource":"*"},
+		{"Effect":"Deny","Action":"s3:*","NotResource":["arn:aws:s3:::logs","arn:aws:s3:::logs/*"]}
+	]}`)
+	tests := []struct {
+		statement int
+		action    Action
+		resource  string
+		want      bool
+	}{
+		{0, "s3:GetObject", "arn:aws:s3:::logs/a", true},
+		{0, "s3:PutObject", "arn:aws:s3:::logs/a", false},
+		{0, "s3:GetObject", "arn:aws:s3:::data/a", false},
+		{0, "s3:GetObject", "*", true},
+		{1, "s3:PutObject", "arn:aws:s3:::data/a", true},
+		{1, "iam:CreateUser", "*", false},
+		{2, "s3:GetObject", "arn:aws:s3:::data/a", true},
+		{2, "s3:GetObject", "arn:aws:s3:::logs/a", false},
+		{2, "s3:GetObject", "*", true},
+	}
+	for _, tt := range tests {
+		s := statements[tt.statement]
+		if got := s.matchesAction(tt.action) && s.matchesResource(tt.resource); got != tt.want {
+			t.Errorf("statement %d on %s %s = %v, want %v", tt.statement, tt.action, tt.resource, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     []Statement
+	}{
+		{
+			name:     "single statement and strings",
+			document: `{"Statement":{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}}`,
+			want: []Statement{{
+				Effect:   "Allow",
+				Action:   DynamicAction{Actions: []Action{"s3:GetObject"}},
+				Resource: DynamicResource{Resources: []string{"*"}},
+			}},
+		},
+		{
+			name:     "lists",
+			document: `{"Statement":[{"Effect":"Deny","NotAction":["iam:*","sts:*"],"NotResource":["arn:aws:s3:::a","arn:aws:s3:::b"]}]}`,
+			want: []Statement{{
+				Effect:      "Deny",
+				NotAction:   DynamicAction{Actions: []Action{"iam:*", "sts:*"}},
+				NotResource: DynamicResource{Resources: []string{"arn:aws:s3:::a", "arn:aws:s3:::b"}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeDocument(url.PathEscape(tt.document))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeDocument = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := decodeDocument("%zz"); err == nil {
+		t.Error("decodeDocument accepted an invalid url encoding")
+	}
+}
+
+func TestStatementMarshalJSON(t *testing.T) {
+	tests := []struct {
+		document string
+		want     string
+	}{
+		{
+			`{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}`,
+			`{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}`,
+		},
+		{
+			`{"Sid":"Power","Effect":"Allow","NotAction":["iam:*","sts:*"],"Resource":"*"}`,
+			`{"Sid":"Power","Effect":"Allow","NotAction":["iam:*","sts:*"],"Resource":"*"}`,
+		},
+		{
+			`{"Effect":"Deny","Action":"s3:*","NotResource":"arn:aws:s3:::logs"}`,
+			`{"Effect":"Deny","Action":"s3:*","NotResource":"arn:aws:s3:::logs"}`,
+		},
+	}
+	for _, tt := range tests {
+		statements := mustParse(t, `{"Statement":`+tt.document+`}`)
+		got, err := json.Marshal(statements[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("marshalling %s = %s, want %s", tt.document, got, tt.want)
+		}
+	}
+}
+
+func TestDocumentSize(t *testing.T) {
+	document := `{"Statement": [ {"Effect": "Allow"} ]}`
+	if got, want := documentSize(url.PathEscape(document)), len(`{"Statement":[{"Effect":"Allow"}]}`); got != want {
+		t.Errorf("documentSize = %d, want %d", got, want)
+	}
+}
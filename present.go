@@ -0,0 +1,567 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/fatih/color"
+)
+
+// Presenter renders statements. PrintHeader starts the section for a
+// principal and is only called when output covers more than one, unless the
+// presenter wants headers; Finish is called once after everything has been
+// printed.
+type Presenter interface {
+	PrintHeader(principal string)
+	PrintStatement(statement Statement)
+	Finish() error
+}
+
+// headedPresenter is a Presenter whose output records whose statements it
+// holds, so that it needs PrintHeader even for a single principal.
+type headedPresenter interface {
+	wantsHeaders() bool
+}
+
+// wantsHeaders reports whether p needs PrintHeader for every principal.
+func wantsHeaders(p Presenter) bool {
+	headed, ok := p.(headedPresenter)
+	return ok && headed.wantsHeaders()
+}
+
+// outputFormats lists the values --output accepts.
+var outputFormats = []string{"text", "json", "terraform", "cloudformation", "policy-json", "cdk-ts", "cdk-go", "markdown", "html", "csv", "flat", "rego-data"}
+
+func newPresenter(format string, w io.Writer) (Presenter, error) {
+	switch format {
+	case "text":
+		return newTextPresenter(w), nil
+	case "terraform":
+		return newTerraformPresenter(w), nil
+	case "cloudformation":
+		return newCloudFormationPresenter(w), nil
+	case "policy-json":
+		return newPolicyJSONPresenter(w), nil
+	case "cdk-ts":
+		return newCDKPresenter(w, false), nil
+	case "cdk-go":
+		return newCDKPresenter(w, true), nil
+	case "markdown":
+		return newMarkdownPresenter(w), nil
+	case "html":
+		return newHTMLPresenter(w), nil
+	case "csv":
+		return newCSVPresenter(w), nil
+	case "flat":
+		return newFlatPresenter(w), nil
+	case "json", "rego-data":
+		return newRegoDataPresenter(w), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, expected one of %s", format, strings.Join(outputFormats, ", "))
+}
+
+// statementOrders lists the values --sort accepts.
+var statementOrders = []string{"policy", "action", "service", "effect", "risk"}
+
+// sortingPresenter hands statements to a presenter with their actions and
+// resources sorted. Unless the order is by policy, it holds the statements
+// of each section back until the section ends and hands them over sorted by
+// their first action, its service, their effect, Deny first, or their risk,
+// highest first. Statements that compare equal stay in policy order.
+type sortingPresenter struct {
+	Presenter
+	by      string
+	pending []Statement
+}
+
+func newSortingPresenter(p Presenter, by string) (*sortingPresenter, error) {
+	for _, order := range statementOrders {
+		if by == order {
+			return &sortingPresenter{Presenter: p, by: by}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown sort order %q, expected one of %s", by, strings.Join(statementOrders, ", "))
+}
+
+func (p *sortingPresenter) wantsHeaders() bool {
+	return wantsHeaders(p.Presenter)
+}
+
+func (p *sortingPresenter) PrintHeader(principal string) {
+	p.flush()
+	p.Presenter.PrintHeader(principal)
+}
+
+func (p *sortingPresenter) PrintStatement(statement Statement) {
+	statement = sortedStatement(statement)
+	if p.by == "policy" {
+		p.Presenter.PrintStatement(statement)
+		return
+	}
+	p.pending = append(p.pending, statement)
+}
+
+func (p *sortingPresenter) Finish() error {
+	p.flush()
+	return p.Presenter.Finish()
+}
+
+func (p *sortingPresenter) flush() {
+	key := func(s Statement) string {
+		first := ""
+		if len(s.Action.Actions) > 0 {
+			first = strings.ToLower(string(s.Action.Actions[0]))
+		}
+		switch p.by {
+		case "service":
+			service, _, _ := strings.Cut(first, ":")
+			return service
+		case "effect":
+			if s.Effect == "Deny" {
+				return "0"
+			}
+			return "1"
+		case "risk":
+			return fmt.Sprintf("%03d", 100-statementRisk(s).score)
+		}
+		return first
+	}
+	sort.SliceStable(p.pending, func(i, j int) bool { return key(p.pending[i]) < key(p.pending[j]) })
+	for _, statement := range p.pending {
+		p.Presenter.PrintStatement(statement)
+	}
+	p.pending = nil
+}
+
+// textPresenter is the default colored, one line per resource output.
+// Network conditions are put in words below their statement. With describe,
+// each statement is followed by what its actions do, and with a context by
+// whether its conditions hold. quiet leaves out the network and organization
+// lines, provenance adds where each statement came from and risk the risk
+// score of each statement and the highest of each principal.
+type textPresenter struct {
+	w          io.Writer
+	sections   int
+	group      string
+	quiet      bool
+	provenance bool
+	risk       bool
+	// width wraps long statements when it is not 0
+	width      int
+	describe   bool
+	context    requestContext
+	statements []Statement
+}
+
+func newTextPresenter(w io.Writer) *textPresenter {
+	return &textPresenter{w: w}
+}
+
+func (p *textPresenter) PrintHeader(principal string) {
+	bold := color.New(color.Bold).SprintFunc()
+	if p.sections > 0 {
+		p.summarize()
+		fmt.Fprintln(p.w)
+	}
+	p.statements = nil
+	fmt.Fprintf(p.w, "%s\n", bold("==> "+withAccountName(principal)+" <=="))
+	p.sections++
+	p.group = ""
+}
+
+// PrintStatement prints a line naming the group before the first statement
+// a user has through it.
+func (p *textPresenter) PrintStatement(statement Statement) {
+	if statement.Source.Group != p.group {
+		p.group = statement.Source.Group
+		if p.group != "" {
+			faint := color.New(color.Faint).SprintFunc()
+			fmt.Fprintf(p.w, "%s\n", faint("via group "+p.group+":"))
+		}
+	}
+	statement.present(p.w, p.width)
+	p.statements = append(p.statements, statement)
+	if network := describeNetwork(statement); network != "" && !p.quiet {
+		faint := color.New(color.Faint).SprintFunc()
+		fmt.Fprintf(p.w, "    %s\n", faint(network))
+	}
+	if org := describeOrgBoundary(statement); org != "" && !p.quiet {
+		faint := color.New(color.Faint).SprintFunc()
+		fmt.Fprintf(p.w, "    %s\n", faint(org))
+	}
+	if p.provenance {
+		faint := color.New(color.Faint).SprintFunc()
+		fmt.Fprintf(p.w, "    %s\n", faint(describeProvenance(statement.Source)))
+		if len(statement.Source.Calls) > 0 {
+			fmt.Fprintf(p.w, "    %s\n", faint("calls "+strings.Join(statement.Source.Calls, ", ")))
+		}
+	}
+	if p.risk {
+		presentRisk(p.w, statement)
+	}
+	if p.describe {
+		presentDescriptions(p.w, statement.Action.Actions)
+	}
+	if p.context != nil && len(statement.Condition) > 0 {
+		presentClauses(p.w, statement.Condition.evaluate(p.context))
+	}
+}
+
+// describeProvenance gives the chain from a principal to a statement, such
+// as "role/x → group g → arn:aws:iam::aws:policy/P version v3 → statement 2".
+func describeProvenance(source StatementSource) string {
+	chain := []string{}
+	if source.Principal != "" {
+		chain = append(chain, source.Principal)
+	}
+	if source.Group != "" {
+		chain = append(chain, "group "+source.Group)
+	}
+	switch {
+	case source.Arn != "" && source.Version != "":
+		chain = append(chain, source.Arn+" version "+source.Version)
+	case source.Arn != "":
+		chain = append(chain, source.Arn)
+	case source.Principal != "":
+		chain = append(chain, "inline policy "+source.Policy)
+	default:
+		chain = append(chain, source.Policy)
+	}
+	chain = append(chain, fmt.Sprintf("statement %d", source.Index+1))
+	return strings.Join(chain, " → ")
+}
+
+// presentClauses prints whether each clause of a condition passes, and why
+// when that is not obvious.
+func presentClauses(w io.Writer, clauses []conditionClause) {
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+	for _, clause := range clauses {
+		verdict := green("pass")
+		if !clause.passed {
+			verdict = red("fail")
+		}
+		line := fmt.Sprintf("    %s %s %s %s", verdict, clause.operator, clause.key, strings.Join(clause.values, ", "))
+		if clause.reason != "" {
+			line += " " + faint("("+clause.reason+")")
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// presentDescriptions prints the catalog description of each action, or how
+// many actions a wildcard matches.
+func presentDescriptions(w io.Writer, actions []Action) {
+	faint := color.New(color.Faint).SprintFunc()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, action := range actions {
+		description := "not in the catalog"
+		if expanded := ExpandAction(action); len(expanded) > 1 || expanded[0] != action {
+			description = fmt.Sprintf("matches %d actions", len(expanded))
+		} else if a, ok := catalogAction(action); ok && a.Description != "" {
+			description = a.Description
+		}
+		fmt.Fprintf(tw, "    %s\t%s\n", action, faint(description))
+	}
+	tw.Flush()
+}
+
+func (p *textPresenter) Finish() error {
+	p.summarize()
+	return nil
+}
+
+func (p *textPresenter) summarize() {
+	if !p.quiet {
+		presentNetworkSummary(p.w, p.statements)
+	}
+	if p.risk && len(p.statements) > 0 {
+		presentRiskSummary(p.w, p.statements)
+	}
+}
+
+// countPresenter prints how many statements, distinct actions and distinct
+// resources each principal has, for scripts that only need to know whether
+// there are any.
+type countPresenter struct {
+	collector
+	w io.Writer
+}
+
+func newCountPresenter(w io.Writer) *countPresenter {
+	return &countPresenter{w: w}
+}
+
+func (p *countPresenter) Finish() error {
+	sections := p.sections
+	if len(sections) == 0 {
+		sections = []principalStatements{{}}
+	}
+	for _, section := range sections {
+		actions, resources := map[string]bool{}, map[string]bool{}
+		for _, s := range section.statements {
+			for _, action := range s.Action.Actions {
+				actions[strings.ToLower(string(action))] = true
+			}
+			for _, resource := range s.Resource.Resources {
+				resources[resource] = true
+			}
+		}
+		if section.principal != "" {
+			fmt.Fprintf(p.w, "%s: ", section.principal)
+		}
+		fmt.Fprintf(p.w, "%d statements, %d actions, %d resources\n", len(section.statements), len(actions), len(resources))
+	}
+	return nil
+}
+
+// principalStatements are the statements printed for one principal by a
+// presenter that renders everything in Finish. principal is empty when the
+// output only covers one.
+type principalStatements struct {
+	principal  string
+	statements []Statement
+}
+
+// collector gathers statements per principal for presenters that need all
+// of them before rendering.
+type collector struct {
+	sections []principalStatements
+}
+
+func (c *collector) PrintHeader(principal string) {
+	c.sections = append(c.sections, principalStatements{principal: principal})
+}
+
+func (c *collector) PrintStatement(statement Statement) {
+	if len(c.sections) == 0 {
+		c.sections = append(c.sections, principalStatements{})
+	}
+	last := &c.sections[len(c.sections)-1]
+	last.statements = append(last.statements, statement)
+}
+
+// camelCase joins the ASCII letters and digits of s into a camel case
+// identifier, starting a new word at every other character.
+func camelCase(s string, upperFirst bool) string {
+	var b strings.Builder
+	upper := upperFirst
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) || r > unicode.MaxASCII {
+			upper = b.Len() > 0 || upperFirst
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+		} else if b.Len() == 0 {
+			r = unicode.ToLower(r)
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func joinActions(actions []Action) string {
+	yellow := color.New(color.FgYellow).SprintFunc()
+	s := []string{}
+	for _, action := range actions {
+		s = append(s, yellow(string(action)))
+	}
+	return strings.Join(s, ", ")
+}
+
+func (s Statement) Present(w io.Writer) {
+	s.present(w, 0)
+}
+
+// present prints the statement like Present, wrapping lines wider than width
+// between actions and before "to" and "by", with continuation lines indented
+// past the effect. Actions and arns are never broken. A width of 0 never
+// wraps.
+func (s Statement) present(w io.Writer, width int) {
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	blue := color.New(color.FgBlue).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	var effect string
+	switch s.Effect {
+	case "Allow":
+		effect = green(s.Effect)
+	case "Deny":
+		effect = red(s.Effect)
+	default:
+		effect = s.Effect
+	}
+
+	words := []displayWord{{effect, len(s.Effect)}}
+	if marker := markers.effect(s.Effect); marker != "" {
+		words[0].text = marker + " " + effect
+		words[0].width += utf8.RuneCountInString(marker) + 1
+	}
+	actions := s.Action.Actions
+	if len(s.NotAction.Actions) > 0 {
+		actions = s.NotAction.Actions
+		words = append(words, displayWord{"all but", len("all but")})
+	}
+	for i, action := range actions {
+		word := displayWord{yellow(string(action)), len(action)}
+		if i < len(actions)-1 {
+			word.text += ","
+			word.width++
+		}
+		words = append(words, word)
+	}
+
+	// trust policies have principals and no resources. A statement is
+	// printed once per resource and principal, but once for all of those it
+	// leaves out, which only mean something together.
+	targets := [][]displayWord{nil}
+	switch {
+	case len(s.NotResource.Resources) > 0:
+		target := []displayWord{{"to all but", len("to all but")}}
+		for i, resource := range s.NotResource.Resources {
+			resource = withAccountName(resource)
+			word := displayWord{blue(resource), len(resource)}
+			if i < len(s.NotResource.Resources)-1 {
+				word.text += ","
+				word.width++
+			}
+			target = append(target, word)
+		}
+		targets = [][]displayWord{target}
+	case len(s.Resource.Resources) > 0:
+		targets = nil
+		for _, resource := range s.Resource.Resources {
+			resource = withAccountName(resource)
+			targets = append(targets, []displayWord{{"to " + blue(resource), len("to " + resource)}})
+		}
+	}
+	principals := [][]displayWord{nil}
+	if names := s.NotPrincipal.names(); len(names) > 0 {
+		principal := []displayWord{{"by all but", len("by all but")}}
+		for i, name := range names {
+			name = withAccountName(name)
+			word := displayWord{name, len(name)}
+			if i < len(names)-1 {
+				word.text += ","
+				word.width++
+			}
+			principal = append(principal, word)
+		}
+		principals = [][]displayWord{principal}
+	} else if names := s.Principal.names(); len(names) > 0 {
+		principals = nil
+		for _, name := range names {
+			name = withAccountName(name)
+			principals = append(principals, []displayWord{{"by " + name, len("by " + name)}})
+		}
+	}
+	indent := strings.Repeat(" ", words[0].width+1)
+	for _, target := range targets {
+		for _, principal := range principals {
+			line := append(append(append([]displayWord{}, words...), target...), principal...)
+			presentWords(w, line, width, indent)
+		}
+	}
+}
+
+// accountNames are the names --account-names shows after account ids, by
+// account id. It is nil unless the flag is given.
+var accountNames map[string]string
+
+// withAccountName follows s with the name of its account in parentheses
+// when it ends with an arn or account id whose name is known, as in
+// "AWS arn:aws:iam::111111111111:root (prod)".
+func withAccountName(s string) string {
+	account := s[strings.LastIndex(s, " ")+1:]
+	if parsed, err := awsarn.Parse(account); err == nil {
+		account = parsed.AccountID
+	}
+	if name, ok := accountNames[account]; ok && name != "" {
+		return s + " (" + name + ")"
+	}
+	return s
+}
+
+// displayMarkers are symbols put before effects and finding severities, for
+// scanning output at a glance without colors.
+type displayMarkers struct {
+	allow, deny string
+}
+
+// markers are the symbols of --markers, empty unless it is given.
+var markers displayMarkers
+
+// defaultMarkers is what --markers uses without a value.
+const defaultMarkers = "✓,✗"
+
+// parseMarkers parses the allow and deny symbols of --markers, separated by
+// a comma.
+func parseMarkers(spec string) (displayMarkers, error) {
+	allow, deny, found := strings.Cut(spec, ",")
+	if !found || allow == "" || deny == "" {
+		return displayMarkers{}, fmt.Errorf("invalid markers %q, expected allow and deny symbols such as %s", spec, defaultMarkers)
+	}
+	return displayMarkers{allow: allow, deny: deny}, nil
+}
+
+func (m displayMarkers) effect(effect string) string {
+	switch effect {
+	case "Allow":
+		return m.allow
+	case "Deny":
+		return m.deny
+	}
+	return ""
+}
+
+// severity returns the glyph of a finding severity, when markers are on.
+func (m displayMarkers) severity(s severity) string {
+	if m.allow == "" {
+		return ""
+	}
+	switch s {
+	case severityMedium:
+		return "▲"
+	case severityHigh:
+		return "✖"
+	}
+	return "·"
+}
+
+// displayWord is text with the width it takes on screen, without its color
+// codes.
+type displayWord struct {
+	text  string
+	width int
+}
+
+// presentWords prints words separated by spaces, starting a new line
+// beginning with indent whenever the next word would go past width.
+func presentWords(w io.Writer, words []displayWord, width int, indent string) {
+	var b strings.Builder
+	column := 0
+	for i, word := range words {
+		switch {
+		case i == 0:
+		case width > 0 && column+1+word.width > width:
+			b.WriteString("\n" + indent)
+			column = len(indent)
+		default:
+			b.WriteString(" ")
+			column++
+		}
+		b.WriteString(word.text)
+		column += word.width
+	}
+	fmt.Fprintln(w, b.String())
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// cdkPresenter prints iam.PolicyStatement constructor calls for the CDK in
+// TypeScript or Go.
+type cdkPresenter struct {
+	collector
+	w      io.Writer
+	golang bool
+}
+
+func newCDKPresenter(w io.Writer, golang bool) *cdkPresenter {
+	return &cdkPresenter{w: w, golang: golang}
+}
+
+// cdkVariable names the list of statements for a principal.
+func cdkVariable(principal string) string {
+	name := camelCase(shortPrincipal(principal), false)
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return "statements"
+	}
+	return name + "Statements"
+}
+
+func tsList(values []string) string {
+	quoted := []string{}
+	for _, v := range values {
+		data, _ := json.Marshal(v)
+		quoted = append(quoted, string(data))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func goStrings(values []string) string {
+	quoted := []string{}
+	for _, v := range values {
+		quoted = append(quoted, strconv.Quote(v))
+	}
+	return "jsii.Strings(" + strings.Join(quoted, ", ") + ")"
+}
+
+// cdkProperties lists the properties of a statement as name and value
+// pairs, leaving out the empty lists, so that a NotAction statement has no
+// actions.
+func cdkProperties(statement Statement, sid, effect string, names [4]string, list func([]string) string) [][2]string {
+	properties := [][2]string{}
+	if statement.Sid != "" {
+		properties = append(properties, [2]string{"sid", sid})
+	}
+	properties = append(properties, [2]string{"effect", effect})
+	for i, values := range [][]string{
+		actionStrings(statement.Action.Actions),
+		actionStrings(statement.NotAction.Actions),
+		statement.Resource.Resources,
+		statement.NotResource.Resources,
+	} {
+		if len(values) > 0 {
+			properties = append(properties, [2]string{names[i], list(values)})
+		}
+	}
+	return properties
+}
+
+func (p *cdkPresenter) Finish() error {
+	for i, section := range p.sections {
+		if i > 0 {
+			fmt.Fprintln(p.w)
+		}
+		if section.principal != "" {
+			fmt.Fprintf(p.w, "// %s\n", section.principal)
+		}
+		if p.golang {
+			p.printGo(section)
+		} else {
+			p.printTypeScript(section)
+		}
+	}
+	return nil
+}
+
+func (p *cdkPresenter) printTypeScript(section principalStatements) {
+	fmt.Fprintf(p.w, "const %s = [\n", cdkVariable(section.principal))
+	for _, statement := range section.statements {
+		effect := "iam.Effect.ALLOW"
+		if statement.Effect == "Deny" {
+			effect = "iam.Effect.DENY"
+		}
+		sid, _ := json.Marshal(statement.Sid)
+		fmt.Fprintln(p.w, "  new iam.PolicyStatement({")
+		for _, property := range cdkProperties(statement, string(sid), effect,
+			[4]string{"actions", "notActions", "resources", "notResources"}, tsList) {
+			fmt.Fprintf(p.w, "    %s: %s,\n", property[0], property[1])
+		}
+		if len(statement.Condition) > 0 {
+			conditions, _ := json.Marshal(statement.Condition)
+			fmt.Fprintf(p.w, "    conditions: %s,\n", conditions)
+		}
+		fmt.Fprintln(p.w, "  }),")
+	}
+	fmt.Fprintln(p.w, "];")
+}
+
+func (p *cdkPresenter) printGo(section principalStatements) {
+	fmt.Fprintf(p.w, "%s := []awsiam.PolicyStatement{\n", cdkVariable(section.principal))
+	for _, statement := range section.statements {
+		effect := "awsiam.Effect_ALLOW"
+		if statement.Effect == "Deny" {
+			effect = "awsiam.Effect_DENY"
+		}
+		fmt.Fprintln(p.w, "\tawsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{")
+		properties := cdkProperties(statement, "jsii.String("+strconv.Quote(statement.Sid)+")", effect,
+			[4]string{"Actions", "NotActions", "Resources", "NotResources"}, goStrings)
+		width := 0
+		for _, property := range properties {
+			if len(property[0]) > width {
+				width = len(property[0])
+			}
+		}
+		for _, property := range properties {
+			name := strings.ToUpper(property[0][:1]) + property[0][1:] + ":"
+			fmt.Fprintf(p.w, "\t\t%-*s %s,\n", width+1, name, property[1])
+		}
+		if len(statement.Condition) > 0 {
+			fmt.Fprintln(p.w, "\t\tConditions: &map[string]interface{}{")
+			operator := ""
+			for _, clause := range statement.Condition.clauses() {
+				if clause.operator != operator {
+					if operator != "" {
+						fmt.Fprintln(p.w, "\t\t\t},")
+					}
+					operator = clause.operator
+					fmt.Fprintf(p.w, "\t\t\t%s: map[string]interface{}{\n", strconv.Quote(operator))
+				}
+				values := []string{}
+				for _, v := range clause.values {
+					values = append(values, strconv.Quote(v))
+				}
+				fmt.Fprintf(p.w, "\t\t\t\t%s: []string{%s},\n", strconv.Quote(clause.key), strings.Join(values, ", "))
+			}
+			fmt.Fprintln(p.w, "\t\t\t},")
+			fmt.Fprintln(p.w, "\t\t},")
+		}
+		fmt.Fprintln(p.w, "\t}),")
+	}
+	fmt.Fprintln(p.w, "}")
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+const policyVersion = "2012-10-17"
+
+// mergedDocument combines statements into one policy document, normalized
+// and without duplicates.
+func mergedDocument(statements []Statement) RawPolicy {
+	merged := []Statement{}
+	seen := map[string]bool{}
+	for _, statement := range normalizeStatements(statements) {
+		key := statementKey(statement)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		statement.Source = StatementSource{}
+		merged = append(merged, statement)
+	}
+	return RawPolicy{Version: policyVersion, Statement: DynamicStatement{Statements: merged}}
+}
+
+// policyJSONPresenter prints a single policy document holding every
+// statement shown.
+type policyJSONPresenter struct {
+	collector
+	w io.Writer
+}
+
+func newPolicyJSONPresenter(w io.Writer) *policyJSONPresenter {
+	return &policyJSONPresenter{w: w}
+}
+
+func (p *policyJSONPresenter) Finish() error {
+	all := []Statement{}
+	for _, section := range p.sections {
+		all = append(all, section.statements...)
+	}
+	data, err := json.MarshalIndent(mergedDocument(all), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding policy document: %w", err)
+	}
+	fmt.Fprintf(p.w, "%s\n", data)
+	return nil
+}
+
+// outputSchemas holds the JSON Schema of each version of the document
+// --output json and rego-data print, as output-v<version>.json.
+//
+//go:embed schema/*.json
+var outputSchemas embed.FS
+
+// outputVersions are the versions of the document --output-version accepts.
+// Version 2 nests the policy a statement came from under source and always
+// lists the values of condition keys.
+var outputVersions = []int{1, 2}
+
+// outputSchema returns the JSON Schema of a version of the document.
+func outputSchema(version int) ([]byte, error) {
+	for _, v := range outputVersions {
+		if v == version {
+			return outputSchemas.ReadFile(fmt.Sprintf("schema/output-v%d.json", version))
+		}
+	}
+	return nil, fmt.Errorf("unknown output version %d, expected 1 or 2", version)
+}
+
+// regoDataPresenter prints a JSON data document listing each principal with
+// its statements in the shape of the JSON API, for --output json and for
+// OPA, so that Rego rules can iterate data.principals[_].statements[_].
+type regoDataPresenter struct {
+	collector
+	w       io.Writer
+	version int
+}
+
+func newRegoDataPresenter(w io.Writer) *regoDataPresenter {
+	return &regoDataPresenter{w: w, version: 1}
+}
+
+// wantsHeaders is true since every principal of the document carries its
+// arn and account.
+func (p *regoDataPresenter) wantsHeaders() bool {
+	return true
+}
+
+type regoDocument struct {
+	Version    int             `json:"version"`
+	Principals []regoPrincipal `json:"principals"`
+}
+
+type regoPrincipal struct {
+	Principal string `json:"principal,omitempty"`
+	Account   string `json:"account,omitempty"`
+	// Statements are jsonStatements in version 1, and
+	// jsonStatementV2s from version 2
+	Statements interface{} `json:"statements"`
+}
+
+// jsonStatementV2 is a statement of version 2 of the document.
+type jsonStatementV2 struct {
+	Sid          string                         `json:"sid,omitempty"`
+	Effect       string                         `json:"effect"`
+	Actions      []Action                       `json:"actions"`
+	NotActions   []Action                       `json:"notActions,omitempty"`
+	Resources    []string                       `json:"resources"`
+	NotResources []string                       `json:"notResources,omitempty"`
+	Condition    map[string]map[string][]string `json:"condition,omitempty"`
+	Source       jsonSource                     `json:"source"`
+}
+
+type jsonSource struct {
+	Policy  string `json:"policy,omitempty"`
+	Arn     string `json:"arn,omitempty"`
+	Version string `json:"version,omitempty"`
+	Group   string `json:"group,omitempty"`
+}
+
+func toJSONStatementsV2(statements []Statement) []jsonStatementV2 {
+	out := []jsonStatementV2{}
+	for _, s := range toJSONStatements(statements) {
+		statement := jsonStatementV2{
+			Sid:          s.Sid,
+			Effect:       s.Effect,
+			Actions:      s.Actions,
+			NotActions:   s.NotActions,
+			Resources:    s.Resources,
+			NotResources: s.NotResources,
+			Source:       jsonSource{Policy: s.Policy, Arn: s.PolicyArn, Version: s.PolicyVersion, Group: s.Group},
+		}
+		if len(s.Condition) > 0 {
+			statement.Condition = map[string]map[string][]string{}
+			for operator, keys := range s.Condition {
+				statement.Condition[operator] = map[string][]string{}
+				for key, values := range keys {
+					statement.Condition[operator][key] = append([]string{}, values...)
+				}
+			}
+		}
+		out = append(out, statement)
+	}
+	return out
+}
+
+func (p *regoDataPresenter) Finish() error {
+	principals := []regoPrincipal{}
+	for _, section := range p.sections {
+		principal := regoPrincipal{Principal: section.principal, Statements: toJSONStatements(section.statements)}
+		if p.version >= 2 {
+			principal.Statements = toJSONStatementsV2(section.statements)
+		}
+		if parsed, err := awsarn.Parse(section.principal); err == nil {
+			principal.Account = parsed.AccountID
+		}
+		principals = append(principals, principal)
+	}
+	data, err := json.MarshalIndent(regoDocument{Version: p.version, Principals: principals}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding rego data: %w", err)
+	}
+	fmt.Fprintf(p.w, "%s\n", data)
+	return nil
+}
+
+// cloudFormationPresenter prints a template snippet with an
+// AWS::IAM::ManagedPolicy resource per principal.
+type cloudFormationPresenter struct {
+	collector
+	w io.Writer
+}
+
+func newCloudFormationPresenter(w io.Writer) *cloudFormationPresenter {
+	return &cloudFormationPresenter{w: w}
+}
+
+// logicalID turns a principal arn into a CloudFormation logical id, which
+// may only contain letters and digits.
+func logicalID(principal string) string {
+	return camelCase(shortPrincipal(principal), true) + "Policy"
+}
+
+// yamlString quotes s for YAML. Double quoted YAML strings accept JSON
+// escapes, so JSON encoding is enough.
+func yamlString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// writeYAMLList writes the values of a statement key, or nothing when there
+// are none, so that a NotAction statement has no Action key.
+func writeYAMLList(w io.Writer, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "            %s:\n", key)
+	for _, v := range values {
+		fmt.Fprintf(w, "              - %s\n", yamlString(v))
+	}
+}
+
+func (p *cloudFormationPresenter) Finish() error {
+	fmt.Fprintln(p.w, "Resources:")
+	for _, section := range p.sections {
+		document := mergedDocument(section.statements)
+		fmt.Fprintf(p.w, "  %s:\n", logicalID(section.principal))
+		fmt.Fprintln(p.w, "    Type: AWS::IAM::ManagedPolicy")
+		fmt.Fprintln(p.w, "    Properties:")
+		if section.principal != "" {
+			fmt.Fprintf(p.w, "      Description: %s\n", yamlString("Statements of "+section.principal))
+		}
+		fmt.Fprintln(p.w, "      PolicyDocument:")
+		fmt.Fprintf(p.w, "        Version: %s\n", yamlString(document.Version))
+		fmt.Fprintln(p.w, "        Statement:")
+		for _, statement := range document.Statement.Statements {
+			if statement.Sid != "" {
+				fmt.Fprintf(p.w, "          - Sid: %s\n", yamlString(statement.Sid))
+				fmt.Fprintf(p.w, "            Effect: %s\n", statement.Effect)
+			} else {
+				fmt.Fprintf(p.w, "          - Effect: %s\n", statement.Effect)
+			}
+			writeYAMLList(p.w, "Action", actionStrings(statement.Action.Actions))
+			writeYAMLList(p.w, "NotAction", actionStrings(statement.NotAction.Actions))
+			writeYAMLList(p.w, "Resource", statement.Resource.Resources)
+			writeYAMLList(p.w, "NotResource", statement.NotResource.Resources)
+			if len(statement.Condition) > 0 {
+				fmt.Fprintln(p.w, "            Condition:")
+				operator := ""
+				for _, clause := range statement.Condition.clauses() {
+					if clause.operator != operator {
+						operator = clause.operator
+						fmt.Fprintf(p.w, "              %s:\n", yamlString(operator))
+					}
+					fmt.Fprintf(p.w, "                %s:\n", yamlString(clause.key))
+					for _, value := range clause.values {
+						fmt.Fprintf(p.w, "                  - %s\n", yamlString(value))
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
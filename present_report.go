@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// reportColumns lists the values --columns accepts, in their default order.
+var reportColumns = []string{"effect", "action", "resource", "source", "condition"}
+
+var reportColumnTitles = map[string]string{
+	"effect":    "Effect",
+	"action":    "Actions",
+	"resource":  "Resources",
+	"source":    "Policy",
+	"condition": "Condition",
+}
+
+// parseColumns checks the columns picked with --columns, defaulting to all
+// of them.
+func parseColumns(columns []string) ([]string, error) {
+	if len(columns) == 0 {
+		return reportColumns, nil
+	}
+	for _, column := range columns {
+		if _, ok := reportColumnTitles[column]; !ok {
+			return nil, fmt.Errorf("unknown column %q, expected one of %s", column, strings.Join(reportColumns, ", "))
+		}
+	}
+	return columns, nil
+}
+
+func columnTitles(columns []string) []string {
+	titles := []string{}
+	for _, column := range columns {
+		titles = append(titles, reportColumnTitles[column])
+	}
+	return titles
+}
+
+// reportRow is a statement prepared for the csv, markdown and html reports.
+type reportRow struct {
+	Effect    string
+	Actions   []reportAction
+	Resources []string
+	Policy    string
+	Condition string
+}
+
+type reportAction struct {
+	Name string
+	URL  string
+}
+
+// reportRows prepares statements for the reports. The actions and resources
+// a NotAction or NotResource leaves out are listed with "not " before them.
+func reportRows(statements []Statement) []reportRow {
+	rows := []reportRow{}
+	for _, s := range statements {
+		row := reportRow{Effect: s.Effect, Resources: s.Resource.Resources, Policy: s.Source.Policy}
+		for _, resource := range s.NotResource.Resources {
+			row.Resources = append(row.Resources, "not "+resource)
+		}
+		if s.Source.Group != "" {
+			row.Policy += " (group " + s.Source.Group + ")"
+		}
+		if len(s.Condition) > 0 {
+			data, _ := json.Marshal(s.Condition)
+			row.Condition = string(data)
+		}
+		for _, action := range s.Action.Actions {
+			row.Actions = append(row.Actions, reportAction{Name: string(action), URL: actionDocURL(action)})
+		}
+		for _, action := range s.NotAction.Actions {
+			row.Actions = append(row.Actions, reportAction{Name: "not " + string(action), URL: actionDocURL(action)})
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// markdownPresenter prints a table of statements per principal, linking
+// each action to its documentation.
+type markdownPresenter struct {
+	collector
+	w       io.Writer
+	columns []string
+}
+
+func newMarkdownPresenter(w io.Writer) *markdownPresenter {
+	return &markdownPresenter{w: w, columns: reportColumns}
+}
+
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\n", " ")
+
+func markdownCode(s string) string {
+	return "`" + markdownEscaper.Replace(s) + "`"
+}
+
+func (p *markdownPresenter) Finish() error {
+	for i, section := range p.sections {
+		if i > 0 {
+			fmt.Fprintln(p.w)
+		}
+		if section.principal != "" {
+			fmt.Fprintf(p.w, "## %s\n\n", markdownEscaper.Replace(section.principal))
+		}
+		fmt.Fprintf(p.w, "| %s |\n", strings.Join(columnTitles(p.columns), " | "))
+		fmt.Fprintf(p.w, "|%s\n", strings.Repeat(" --- |", len(p.columns)))
+		for _, row := range reportRows(section.statements) {
+			cells := []string{}
+			for _, column := range p.columns {
+				cells = append(cells, markdownCell(row, column))
+			}
+			fmt.Fprintf(p.w, "| %s |\n", strings.Join(cells, " | "))
+		}
+	}
+	return nil
+}
+
+func markdownCell(row reportRow, column string) string {
+	switch column {
+	case "effect":
+		return row.Effect
+	case "action":
+		actions := []string{}
+		for _, a := range row.Actions {
+			actions = append(actions, fmt.Sprintf("[%s](%s)", markdownEscaper.Replace(a.Name), a.URL))
+		}
+		return strings.Join(actions, "<br>")
+	case "resource":
+		resources := []string{}
+		for _, r := range row.Resources {
+			resources = append(resources, markdownCode(r))
+		}
+		return strings.Join(resources, "<br>")
+	case "source":
+		return markdownEscaper.Replace(row.Policy)
+	case "condition":
+		if row.Condition != "" {
+			return markdownCode(row.Condition)
+		}
+	}
+	return ""
+}
+
+// csvPresenter prints a header row and then a row per statement, with the
+// actions and resources of a statement separated by spaces. When output
+// covers several principals, a principal column comes first.
+type csvPresenter struct {
+	collector
+	w       io.Writer
+	columns []string
+}
+
+func newCSVPresenter(w io.Writer) *csvPresenter {
+	return &csvPresenter{w: w, columns: reportColumns}
+}
+
+func (p *csvPresenter) Finish() error {
+	w := csv.NewWriter(p.w)
+	several := len(p.sections) > 1 || len(p.sections) == 1 && p.sections[0].principal != ""
+	header := append([]string{}, p.columns...)
+	if several {
+		header = append([]string{"principal"}, header...)
+	}
+	w.Write(header)
+	for _, section := range p.sections {
+		for _, row := range reportRows(section.statements) {
+			record := []string{}
+			if several {
+				record = append(record, section.principal)
+			}
+			for _, column := range p.columns {
+				record = append(record, csvCell(row, column))
+			}
+			w.Write(record)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("writing csv: %w", err)
+	}
+	return nil
+}
+
+func csvCell(row reportRow, column string) string {
+	switch column {
+	case "effect":
+		return row.Effect
+	case "action":
+		actions := []string{}
+		for _, a := range row.Actions {
+			actions = append(actions, a.Name)
+		}
+		return strings.Join(actions, " ")
+	case "resource":
+		return strings.Join(row.Resources, " ")
+	case "source":
+		return row.Policy
+	case "condition":
+		return row.Condition
+	}
+	return ""
+}
+
+// flatPresenter prints a line per effect, action and resource of each
+// principal, separated by tabs and without colors, for grep and awk. Lines
+// a principal has more than once are printed once, and when output covers
+// several principals, each line starts with the principal. The actions or
+// resources a NotAction or NotResource leaves out only mean something
+// together, so they share a line, as in "not iam:*,not sts:*".
+type flatPresenter struct {
+	w         io.Writer
+	principal string
+	seen      map[string]bool
+}
+
+func newFlatPresenter(w io.Writer) *flatPresenter {
+	return &flatPresenter{w: w, seen: map[string]bool{}}
+}
+
+func (p *flatPresenter) PrintHeader(principal string) {
+	p.principal = principal
+	p.seen = map[string]bool{}
+}
+
+func (p *flatPresenter) PrintStatement(statement Statement) {
+	prefix := ""
+	if p.principal != "" {
+		prefix = p.principal + "\t"
+	}
+	actions, notActions := []string{}, []string{}
+	for _, action := range statement.Action.Actions {
+		actions = append(actions, string(action))
+	}
+	for _, action := range statement.NotAction.Actions {
+		notActions = append(notActions, string(action))
+	}
+	for _, action := range flatPatterns(actions, notActions) {
+		for _, resource := range flatPatterns(statement.Resource.Resources, statement.NotResource.Resources) {
+			line := fmt.Sprintf("%s%s\t%s\t%s", prefix, statement.Effect, action, resource)
+			if p.seen[line] {
+				continue
+			}
+			p.seen[line] = true
+			fmt.Fprintln(p.w, line)
+		}
+	}
+}
+
+func flatPatterns(patterns, not []string) []string {
+	if len(not) == 0 {
+		return patterns
+	}
+	joined := []string{}
+	for _, pattern := range not {
+		joined = append(joined, "not "+pattern)
+	}
+	return []string{strings.Join(joined, ",")}
+}
+
+func (p *flatPresenter) Finish() error {
+	return nil
+}
+
+// htmlPresenter prints a standalone html page with a table of statements
+// per principal, linking each action to its documentation.
+type htmlPresenter struct {
+	collector
+	w       io.Writer
+	columns []string
+}
+
+func newHTMLPresenter(w io.Writer) *htmlPresenter {
+	return &htmlPresenter{w: w, columns: reportColumns}
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>iam-show</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+.Allow { color: #1a7f37; }
+.Deny { color: #cf222e; }
+</style>
+</head>
+<body>
+{{- range $section := .}}
+{{- if .Principal}}
+<h2>{{.Principal}}</h2>
+{{- end}}
+<table>
+<tr>{{range .Titles}}<th>{{.}}</th>{{end}}</tr>
+{{- range $row := .Rows}}
+<tr>
+{{- range $section.Columns}}
+{{- if eq . "effect"}}
+<td class="{{$row.Effect}}">{{$row.Effect}}</td>
+{{- else if eq . "action"}}
+<td>{{range $i, $a := $row.Actions}}{{if $i}}<br>{{end}}<a href="{{$a.URL}}">{{$a.Name}}</a>{{end}}</td>
+{{- else if eq . "resource"}}
+<td>{{range $i, $r := $row.Resources}}{{if $i}}<br>{{end}}<code>{{$r}}</code>{{end}}</td>
+{{- else if eq . "source"}}
+<td>{{$row.Policy}}</td>
+{{- else if eq . "condition"}}
+<td>{{if $row.Condition}}<code>{{$row.Condition}}</code>{{end}}</td>
+{{- end}}
+{{- end}}
+</tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+func (p *htmlPresenter) Finish() error {
+	type reportSection struct {
+		Principal string
+		Columns   []string
+		Titles    []string
+		Rows      []reportRow
+	}
+	sections := []reportSection{}
+	for _, section := range p.sections {
+		sections = append(sections, reportSection{
+			Principal: section.principal,
+			Columns:   p.columns,
+			Titles:    columnTitles(p.columns),
+			Rows:      reportRows(section.statements),
+		})
+	}
+	if err := htmlReport.Execute(p.w, sections); err != nil {
+		return fmt.Errorf("rendering html report: %w", err)
+	}
+	return nil
+}
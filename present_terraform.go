@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// terraformPresenter renders an aws_iam_policy_document data source per
+// principal.
+type terraformPresenter struct {
+	collector
+	w io.Writer
+}
+
+func newTerraformPresenter(w io.Writer) *terraformPresenter {
+	return &terraformPresenter{w: w}
+}
+
+var nonIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// terraformName turns a principal arn into a Terraform block label.
+func terraformName(principal string) string {
+	if principal == "" {
+		return "this"
+	}
+	name := strings.Trim(nonIdentifierChars.ReplaceAllString(shortPrincipal(principal), "_"), "_")
+	if name == "" {
+		return "this"
+	}
+	if c := name[0]; c >= '0' && c <= '9' || c == '-' {
+		name = "_" + name
+	}
+	return name
+}
+
+// hclString quotes s as an HCL string, escaping template sequences so that
+// IAM policy variables such as ${aws:username} stay literal.
+func hclString(s string) string {
+	quoted := strconv.Quote(s)
+	quoted = strings.ReplaceAll(quoted, "${", "$${")
+	return strings.ReplaceAll(quoted, "%{", "%%{")
+}
+
+func hclList(values []string) string {
+	quoted := []string{}
+	for _, v := range values {
+		quoted = append(quoted, hclString(v))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// writeHCLAttributes writes name = value lines with the equals signs lined
+// up, as terraform fmt does.
+func writeHCLAttributes(w io.Writer, indent string, attributes [][2]string) {
+	width := 0
+	for _, a := range attributes {
+		if len(a[0]) > width {
+			width = len(a[0])
+		}
+	}
+	for _, a := range attributes {
+		fmt.Fprintf(w, "%s%-*s = %s\n", indent, width, a[0], a[1])
+	}
+}
+
+func actionStrings(actions []Action) []string {
+	out := []string{}
+	for _, action := range actions {
+		out = append(out, string(action))
+	}
+	return out
+}
+
+func (p *terraformPresenter) Finish() error {
+	for i, section := range p.sections {
+		if i > 0 {
+			fmt.Fprintln(p.w)
+		}
+		if section.principal != "" {
+			fmt.Fprintf(p.w, "# %s\n", section.principal)
+		}
+		fmt.Fprintf(p.w, "data \"aws_iam_policy_document\" %q {\n", terraformName(section.principal))
+		for j, statement := range section.statements {
+			if j > 0 {
+				fmt.Fprintln(p.w)
+			}
+			if statement.Source.Group != "" {
+				fmt.Fprintf(p.w, "  # from %s of group %s\n", statement.Source.Policy, statement.Source.Group)
+			} else if statement.Source.Policy != "" {
+				fmt.Fprintf(p.w, "  # from %s\n", statement.Source.Policy)
+			}
+			fmt.Fprintf(p.w, "  statement {\n")
+			attributes := [][2]string{}
+			if statement.Sid != "" {
+				attributes = append(attributes, [2]string{"sid", hclString(statement.Sid)})
+			}
+			attributes = append(attributes, [2]string{"effect", hclString(statement.Effect)})
+			if len(statement.NotAction.Actions) > 0 {
+				attributes = append(attributes, [2]string{"not_actions", hclList(actionStrings(statement.NotAction.Actions))})
+			} else {
+				attributes = append(attributes, [2]string{"actions", hclList(actionStrings(statement.Action.Actions))})
+			}
+			if len(statement.NotResource.Resources) > 0 {
+				attributes = append(attributes, [2]string{"not_resources", hclList(statement.NotResource.Resources)})
+			} else {
+				attributes = append(attributes, [2]string{"resources", hclList(statement.Resource.Resources)})
+			}
+			writeHCLAttributes(p.w, "    ", attributes)
+			for _, clause := range statement.Condition.clauses() {
+				fmt.Fprintf(p.w, "\n    condition {\n")
+				writeHCLAttributes(p.w, "      ", [][2]string{
+					{"test", hclString(clause.operator)},
+					{"variable", hclString(clause.key)},
+					{"values", hclList(clause.values)},
+				})
+				fmt.Fprintf(p.w, "    }\n")
+			}
+			fmt.Fprintf(p.w, "  }\n")
+		}
+		fmt.Fprintf(p.w, "}\n")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Progress draws a spinner with fetch counts on a terminal. A nil *Progress
+// is valid and draws nothing, which is what NewProgress returns when w is
+// not a terminal.
+type Progress struct {
+	w *os.File
+
+	mu             sync.Mutex
+	policies       int
+	policiesDone   int
+	principals     int
+	principalsDone int
+	frame          int
+	drawn          bool
+	stop           chan struct{}
+	stopped        chan struct{}
+}
+
+func NewProgress(w *os.File) *Progress {
+	if !isatty.IsTerminal(w.Fd()) && !isatty.IsCygwinTerminal(w.Fd()) {
+		return nil
+	}
+	p := &Progress{
+		w:       w,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *Progress) run() {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			p.mu.Lock()
+			p.clear()
+			p.mu.Unlock()
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.draw()
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *Progress) draw() {
+	if p.policies == 0 && p.principals == 0 {
+		return
+	}
+	p.frame = (p.frame + 1) % len(spinnerFrames)
+	line := fmt.Sprintf("%s fetched %d/%d policies", spinnerFrames[p.frame], p.policiesDone, p.policies)
+	if p.principals > 1 {
+		line += fmt.Sprintf(", %d/%d principals", p.principalsDone, p.principals)
+	}
+	fmt.Fprintf(p.w, "\r\033[K%s", line)
+	p.drawn = true
+}
+
+func (p *Progress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.w, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+func (p *Progress) AddPolicies(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.policies += n
+	p.mu.Unlock()
+}
+
+func (p *Progress) PolicyDone() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.policiesDone++
+	p.mu.Unlock()
+}
+
+func (p *Progress) AddPrincipals(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.principals += n
+	p.mu.Unlock()
+}
+
+func (p *Progress) PrincipalDone() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.principalsDone++
+	p.mu.Unlock()
+}
+
+// Print clears the spinner while fn writes output, so that the spinner line
+// does not end up mixed into it.
+func (p *Progress) Print(fn func()) {
+	if p == nil {
+		fn()
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	fn()
+}
+
+func (p *Progress) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+}
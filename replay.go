@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// recordedExchange is a single AWS API request and its response, as stored
+// on disk by the recorder.
+type recordedExchange struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Operation  string      `json:"operation"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// readRequestBody consumes the request body and puts an identical copy back
+// so that the request can still be sent.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading request body: %w", err)
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// exchangeKey identifies a request independently of its signature and
+// timestamps, so that a replayed run finds the response recorded for the
+// same call.
+func exchangeKey(req *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n", req.Method, req.URL.Host, req.URL.Path, req.Header.Get("X-Amz-Target"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// operationName returns a human readable name for the request, used in error
+// messages and to make recordings easier to browse.
+func operationName(req *http.Request, body []byte) string {
+	if target := req.Header.Get("X-Amz-Target"); target != "" {
+		return target
+	}
+	if values, err := url.ParseQuery(string(body)); err == nil && values.Get("Action") != "" {
+		return req.URL.Host + " " + values.Get("Action")
+	}
+	return req.Method + " " + req.URL.String()
+}
+
+// secretPatterns match the secrets of the credentials that STS responses,
+// in XML, and IAM Identity Center responses, in JSON, carry, so that a
+// recording of --assume-role or --accounts holds no usable session.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(<SecretAccessKey>)[^<]*(</SecretAccessKey>)`),
+	regexp.MustCompile(`(<SessionToken>)[^<]*(</SessionToken>)`),
+	regexp.MustCompile(`("(?:secretAccessKey|sessionToken|accessToken|refreshToken)"\s*:\s*")[^"]*(")`),
+}
+
+// redactSecrets replaces the secrets of credentials in a response body.
+func redactSecrets(body []byte) []byte {
+	for _, pattern := range secretPatterns {
+		body = pattern.ReplaceAll(body, []byte("${1}REDACTED${2}"))
+	}
+	return body
+}
+
+// recordingClient writes every response to dir, readable by its owner only,
+// with the secrets of credentials redacted.
+type recordingClient struct {
+	next aws.HTTPClient
+	dir  string
+}
+
+func newRecordingClient(next aws.HTTPClient, dir string) (*recordingClient, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating record directory: %w", err)
+	}
+	return &recordingClient{next: next, dir: dir}, nil
+}
+
+func (c *recordingClient) Do(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+
+	exchange := recordedExchange{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		Operation:  operationName(req, reqBody),
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       string(redactSecrets(resBody)),
+	}
+	data, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding recorded response: %w", err)
+	}
+	path := filepath.Join(c.dir, exchangeKey(req, reqBody)+".json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("writing recorded response: %w", err)
+	}
+
+	return res, nil
+}
+
+type replayClient struct {
+	dir string
+}
+
+func (c *replayClient) Do(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(c.dir, exchangeKey(req, reqBody)+".json")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no recorded response for %s in %s", operationName(req, reqBody), c.dir)
+	} else if err != nil {
+		return nil, fmt.Errorf("reading recorded response: %w", err)
+	}
+
+	var exchange recordedExchange
+	if err := json.Unmarshal(data, &exchange); err != nil {
+		return nil, fmt.Errorf("decoding recorded response %s: %w", path, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.StatusCode, http.StatusText(exchange.StatusCode)),
+		StatusCode:    exchange.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        exchange.Header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(exchange.Body))),
+		ContentLength: int64(len(exchange.Body)),
+		Request:       req,
+	}, nil
+}
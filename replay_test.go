@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// httpClientFunc serves requests with a function, standing in for AWS.
+type httpClientFunc func(req *http.Request) (*http.Response, error)
+
+func (f httpClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// xmlResponse serves body with status 200 to every request.
+func xmlResponse(body string) httpClientFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/xml"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}
+}
+
+const callerIdentityResponse = `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::111111111111:user/alice</Arn>
+    <UserId>AIDAEXAMPLE</UserId>
+    <Account>111111111111</Account>
+  </GetCallerIdentityResult>
+  <ResponseMetadata><RequestId>1</RequestId></ResponseMetadata>
+</GetCallerIdentityResponse>`
+
+// newTestSTS returns an STS client sending its requests to client.
+func newTestSTS(client aws.HTTPClient) *sts.Client {
+	return sts.New(sts.Options{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", ""),
+		HTTPClient:  client,
+		Retryer:     aws.NopRetryer{},
+	})
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "recording")
+	recorder, err := newRecordingClient(xmlResponse(callerIdentityResponse), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := newTestSTS(recorder).GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a later run signs the same call differently, which must not matter
+	replayed, err := newTestSTS(&replayClient{dir: dir}).GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(replayed.Arn) != aws.ToString(recorded.Arn) || aws.ToString(replayed.Account) != "111111111111" {
+		t.Errorf("replayed %s in %s, want %s", aws.ToString(replayed.Arn), aws.ToString(replayed.Account), aws.ToString(recorded.Arn))
+	}
+
+	_, err = newTestSTS(&replayClient{dir: t.TempDir()}).GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if err == nil || !strings.Contains(err.Error(), "no recorded response for sts.us-east-1.amazonaws.com GetCallerIdentity") {
+		t.Errorf("replaying an unrecorded call: %v", err)
+	}
+}
+
+func TestRecordingRedactsCredentials(t *testing.T) {
+	const response = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY</SecretAccessKey>
+      <SessionToken>FwoGZXIvYXdzEXAMPLETOKEN</SessionToken>
+      <Expiration>2030-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`
+	dir := filepath.Join(t.TempDir(), "recording")
+	recorder, err := newRecordingClient(xmlResponse(response), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://sts.amazonaws.com/", strings.NewReader("Action=AssumeRole&Version=2011-06-15"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := recorder.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != response {
+		t.Errorf("the caller got %s, want the response unchanged", body)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o700 {
+		t.Errorf("recording directory mode %v, want 0700", info.Mode().Perm())
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("recorded %v (%v), want one file", files, err)
+	}
+	info, err = os.Stat(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("recording mode %v, want 0600", info.Mode().Perm())
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", "FwoGZXIvYXdzEXAMPLETOKEN"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("recording holds %s", secret)
+		}
+	}
+	if !strings.Contains(string(data), "ASIAEXAMPLE") {
+		t.Error("recording lost the access key id")
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{
+			`<SecretAccessKey>abc</SecretAccessKey><SessionToken>def</SessionToken>`,
+			`<SecretAccessKey>REDACTED</SecretAccessKey><SessionToken>REDACTED</SessionToken>`,
+		},
+		{
+			`{"roleCredentials":{"accessKeyId":"ASIA","secretAccessKey":"abc","sessionToken": "def"}}`,
+			`{"roleCredentials":{"accessKeyId":"ASIA","secretAccessKey":"REDACTED","sessionToken": "REDACTED"}}`,
+		},
+		{
+			`{"accessToken":"abc","refreshToken":"def","expiresIn":28800}`,
+			`{"accessToken":"REDACTED","refreshToken":"REDACTED","expiresIn":28800}`,
+		},
+		{
+			`<RoleName>app</RoleName>`,
+			`<RoleName>app</RoleName>`,
+		},
+	}
+	for _, tt := range tests {
+		if got := string(redactSecrets([]byte(tt.body))); got != tt.want {
+			t.Errorf("redactSecrets(%s) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/fatih/color"
+)
+
+// resourceService is a service whose resources --resolve-resources lists.
+// segments is how many parts of the resource, split on /, name one of them,
+// such as table/orders, and nested whether patterns of the parts under a
+// resource, such as the objects of a bucket, count as reaching it. Regional
+// services are only listed in the region of the config.
+type resourceService struct {
+	noun     string
+	segments int
+	nested   bool
+	global   bool
+	list     func(ctx context.Context, cfg aws.Config, account string) ([]string, error)
+}
+
+var resolvableServices = map[string]resourceService{
+	"s3":       {noun: "bucket", segments: 1, nested: true, global: true, list: listBuckets},
+	"dynamodb": {noun: "table", segments: 2, nested: true, list: listTables},
+	"sqs":      {noun: "queue", segments: 1, list: listQueues},
+	"sns":      {noun: "topic", segments: 1, list: listTopics},
+}
+
+func listBuckets(ctx context.Context, cfg aws.Config, account string) ([]string, error) {
+	res, err := s3.NewFromConfig(cfg).ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("listing s3 buckets: %w", err)
+	}
+	arns := []string{}
+	for _, bucket := range res.Buckets {
+		arns = append(arns, fmt.Sprintf("arn:%s:s3:::%s", regionPartition(cfg.Region), aws.ToString(bucket.Name)))
+	}
+	return arns, nil
+}
+
+func listTables(ctx context.Context, cfg aws.Config, account string) ([]string, error) {
+	arns := []string{}
+	paginator := dynamodb.NewListTablesPaginator(dynamodb.NewFromConfig(cfg), &dynamodb.ListTablesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing dynamodb tables: %w", err)
+		}
+		for _, name := range page.TableNames {
+			arns = append(arns, fmt.Sprintf("arn:%s:dynamodb:%s:%s:table/%s", regionPartition(cfg.Region), cfg.Region, account, name))
+		}
+	}
+	return arns, nil
+}
+
+// listQueues turns the urls ListQueues returns, such as
+// https://sqs.eu-west-1.amazonaws.com/123456789012/orders, into arns.
+func listQueues(ctx context.Context, cfg aws.Config, account string) ([]string, error) {
+	arns := []string{}
+	// ListQueues only pages when MaxResults is set
+	paginator := sqs.NewListQueuesPaginator(sqs.NewFromConfig(cfg), &sqs.ListQueuesInput{MaxResults: aws.Int32(1000)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing sqs queues: %w", err)
+		}
+		for _, queueURL := range page.QueueUrls {
+			u, err := url.Parse(queueURL)
+			if err != nil {
+				return nil, fmt.Errorf("parsing sqs queue url %s: %w", queueURL, err)
+			}
+			owner, name, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+			arns = append(arns, fmt.Sprintf("arn:%s:sqs:%s:%s:%s", regionPartition(cfg.Region), cfg.Region, owner, name))
+		}
+	}
+	return arns, nil
+}
+
+func listTopics(ctx context.Context, cfg aws.Config, account string) ([]string, error) {
+	arns := []string{}
+	paginator := sns.NewListTopicsPaginator(sns.NewFromConfig(cfg), &sns.ListTopicsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing sns topics: %w", err)
+		}
+		for _, topic := range page.Topics {
+			arns = append(arns, aws.ToString(topic.TopicArn))
+		}
+	}
+	return arns, nil
+}
+
+// resolvedPattern is a wildcard resource of Allow statements and the
+// resources of service it matches.
+type resolvedPattern struct {
+	pattern string
+	service string
+	matches []string
+	err     error
+}
+
+// resourceResolver lists the resources of each service once a run.
+type resourceResolver struct {
+	a       *app
+	account string
+	listed  map[string][]string
+	errs    map[string]error
+}
+
+func newResourceResolver(a *app) *resourceResolver {
+	return &resourceResolver{a: a, listed: map[string][]string{}, errs: map[string]error{}}
+}
+
+func (r *resourceResolver) resources(service string) ([]string, error) {
+	if arns, ok := r.listed[service]; ok {
+		return arns, r.errs[service]
+	}
+	arns, err := r.list(service)
+	r.listed[service], r.errs[service] = arns, err
+	return arns, err
+}
+
+func (r *resourceResolver) list(service string) ([]string, error) {
+	if r.account == "" {
+		arn, err := r.a.fetcher.CallerArn(r.a.ctx)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := awsarn.Parse(arn)
+		if err != nil {
+			return nil, fmt.Errorf("parsing caller arn %s: %w", arn, err)
+		}
+		r.account = parsed.AccountID
+	}
+	return resolvableServices[service].list(r.a.ctx, r.a.cfg, r.account)
+}
+
+// resolve matches the wildcard resources of the Allow statements of a
+// principal against the resources the caller can list. The * resource is
+// matched against the services of the actions of its statement.
+func (r *resourceResolver) resolve(statements []Statement) []resolvedPattern {
+	type patternKey struct{ pattern, service string }
+	seen := map[patternKey]bool{}
+	resolved := []resolvedPattern{}
+	for _, s := range statements {
+		if s.Effect != "Allow" {
+			continue
+		}
+		for _, pattern := range s.Resource.Resources {
+			for _, service := range patternServices(pattern, s.Action.Actions) {
+				key := patternKey{pattern, service}
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				arns, err := r.resources(service)
+				p := resolvedPattern{pattern: pattern, service: service, matches: []string{}, err: err}
+				for _, arn := range arns {
+					if resolvesTo(pattern, arn, resolvableServices[service].nested) {
+						p.matches = append(p.matches, arn)
+					}
+				}
+				sort.Strings(p.matches)
+				resolved = append(resolved, p)
+			}
+		}
+	}
+	sort.SliceStable(resolved, func(i, j int) bool { return resolved[i].pattern < resolved[j].pattern })
+	return resolved
+}
+
+// resolvesTo reports whether a resource pattern matches arn, or with nested
+// something under it, comparing each field of the arn on its own so that a
+// wildcard region does not run into the resource.
+func resolvesTo(pattern, arn string, nested bool) bool {
+	if pattern == "*" {
+		return true
+	}
+	p, a := strings.SplitN(pattern, ":", 6), strings.SplitN(arn, ":", 6)
+	if len(p) < 6 || len(a) < 6 {
+		return false
+	}
+	for i := 1; i < 5; i++ {
+		if !resourceMatch(p[i], a[i]) {
+			return false
+		}
+	}
+	return resourceMatch(p[5], a[5]) || nested && patternsOverlap(p[5], a[5]+"/*")
+}
+
+// patternServices returns the services a resource pattern could name more
+// than one resource of: the service of an arn with a wildcard in the part
+// naming its resource, or for *, the services of actions.
+func patternServices(pattern string, actions []Action) []string {
+	if pattern == "*" {
+		services := []string{}
+		for service := range resolvableServices {
+			for _, action := range actions {
+				prefix, _, _ := strings.Cut(strings.ToLower(string(action)), ":")
+				if prefix == service || prefix == "*" {
+					services = append(services, service)
+					break
+				}
+			}
+		}
+		sort.Strings(services)
+		return services
+	}
+	fields := strings.SplitN(pattern, ":", 6)
+	if len(fields) < 6 || fields[0] != "arn" {
+		return nil
+	}
+	service, ok := resolvableServices[fields[2]]
+	if !ok {
+		return nil
+	}
+	names := strings.SplitN(fields[5], "/", service.segments+1)
+	if len(names) > service.segments {
+		names = names[:service.segments]
+	}
+	if !strings.ContainsAny(strings.Join(append([]string{fields[3], fields[4]}, names...), ":"), "*?") {
+		return nil
+	}
+	return []string{fields[2]}
+}
+
+// presentResolved prints the resources each wildcard resource of a principal
+// matches, and returns warnings for the services that could not be listed.
+func presentResolved(w io.Writer, arn, region string, resolved []resolvedPattern) []string {
+	bold := color.New(color.Bold).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+	fmt.Fprintf(w, "%s\n", bold("==> "+arn+" resources <=="))
+	if len(resolved) == 0 {
+		fmt.Fprintln(w, faint("no wildcard resources of s3, dynamodb, sqs or sns"))
+		return nil
+	}
+	warnings := []string{}
+	failed := map[string]bool{}
+	for _, p := range resolved {
+		service := resolvableServices[p.service]
+		if p.err != nil {
+			if !failed[p.service] {
+				failed[p.service] = true
+				warnings = append(warnings, fmt.Sprintf("%s: --resolve-resources: %v", arn, p.err))
+			}
+			continue
+		}
+		where := ""
+		if !service.global {
+			where = " in " + region
+		}
+		noun := service.noun
+		if len(p.matches) != 1 {
+			noun += "s"
+		}
+		count := fmt.Sprintf("%d %s%s", len(p.matches), noun, where)
+		if p.pattern == "*" {
+			count += " (" + p.service + ")"
+		}
+		fmt.Fprintf(w, "%s: %s\n", p.pattern, count)
+		if len(p.matches) == 0 {
+			fmt.Fprintf(w, "    %s\n", faint("none the caller can list match"))
+		}
+		for _, match := range p.matches {
+			fmt.Fprintf(w, "    %s\n", match)
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsarn "github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// resourcePolicy is the policy attached to a bucket, queue or topic, and the
+// arn of the account that owns it when the resource arn says. kind is empty
+// for resources without a policy iam-show can fetch.
+type resourcePolicy struct {
+	kind     string
+	document string
+	owner    string
+}
+
+// fetchResourcePolicy returns the policy of the bucket of an s3 bucket or
+// object arn, or of an sqs queue or sns topic arn. Buckets without a policy
+// and other services return an empty resourcePolicy.
+func fetchResourcePolicy(ctx context.Context, cfg aws.Config, arn string) (resourcePolicy, error) {
+	parsed, err := awsarn.Parse(arn)
+	if err != nil {
+		return resourcePolicy{}, nil
+	}
+	owner := ""
+	if parsed.AccountID != "" {
+		owner = fmt.Sprintf("arn:%s:iam::%s:root", parsed.Partition, parsed.AccountID)
+	}
+	// queues and topics are only found from their own region
+	regional := cfg.Copy()
+	if parsed.Region != "" {
+		regional.Region = parsed.Region
+	}
+
+	switch parsed.Service {
+	case "s3":
+		bucket, _, _ := strings.Cut(parsed.Resource, "/")
+		res, err := s3.NewFromConfig(cfg).GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchBucketPolicy" {
+			return resourcePolicy{}, nil
+		}
+		if err != nil {
+			return resourcePolicy{}, fmt.Errorf("getting policy of bucket %s: %w", bucket, err)
+		}
+		return resourcePolicy{kind: "bucket policy", document: aws.ToString(res.Policy), owner: owner}, nil
+	case "sqs":
+		client := sqs.NewFromConfig(regional)
+		queue, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(parsed.Resource), QueueOwnerAWSAccountId: aws.String(parsed.AccountID)})
+		if err != nil {
+			return resourcePolicy{}, fmt.Errorf("getting url of queue %s: %w", parsed.Resource, err)
+		}
+		res, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       queue.QueueUrl,
+			AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNamePolicy},
+		})
+		if err != nil {
+			return resourcePolicy{}, fmt.Errorf("getting policy of queue %s: %w", parsed.Resource, err)
+		}
+		if res.Attributes["Policy"] == "" {
+			return resourcePolicy{}, nil
+		}
+		return resourcePolicy{kind: "queue policy", document: res.Attributes["Policy"], owner: owner}, nil
+	case "sns":
+		res, err := sns.NewFromConfig(regional).GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: aws.String(arn)})
+		if err != nil {
+			return resourcePolicy{}, fmt.Errorf("getting policy of topic %s: %w", parsed.Resource, err)
+		}
+		if res.Attributes["Policy"] == "" {
+			return resourcePolicy{}, nil
+		}
+		return resourcePolicy{kind: "topic policy", document: res.Attributes["Policy"], owner: owner}, nil
+	}
+	return resourcePolicy{}, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// accessLevelRisks weighs the access levels of the catalog.
+var accessLevelRisks = map[string]int{
+	"List":                   10,
+	"Read":                   20,
+	"Tagging":                20,
+	"Write":                  40,
+	"Permissions management": 60,
+}
+
+// highRisk is the score from which a statement counts as high risk.
+const highRisk = 70
+
+// pivotActions let a principal act as another role, so on every role they
+// weigh as much as permissions management.
+var pivotActions = []Action{"iam:PassRole", "sts:AssumeRole"}
+
+// risk is how much harm a statement could do, from 0 to 100, with what
+// makes up the score.
+type risk struct {
+	score   int
+	reasons []string
+}
+
+// statementRisk scores an Allow statement by the most powerful access level
+// of its actions, how far its action wildcards reach, how wide its resources
+// are and whether it has conditions. A Deny scores 0. NotAction counts as
+// every action, since it grants whatever it does not list.
+func statementRisk(s Statement) risk {
+	if s.Effect != "Allow" {
+		return risk{}
+	}
+	level, levelName := 0, ""
+	breadth, breadthReason := 0, ""
+	widen := func(score int, reason string) {
+		if score > breadth {
+			breadth, breadthReason = score, reason
+		}
+	}
+	for _, action := range s.Action.Actions {
+		prefix, name, _ := strings.Cut(string(action), ":")
+		switch {
+		case action == "*":
+			widen(25, "every action")
+		case name == "*":
+			widen(15, "every action of "+prefix)
+		case strings.ContainsAny(string(action), "*?"):
+			widen(5, "wildcard actions")
+		}
+		for _, expanded := range ExpandAction(action) {
+			accessLevel := guessAccessLevel(expanded)
+			if a, ok := catalogAction(expanded); ok {
+				accessLevel = a.AccessLevel
+			} else if action == "*" {
+				accessLevel = "Permissions management"
+			}
+			if accessLevelRisks[accessLevel] > level {
+				level, levelName = accessLevelRisks[accessLevel], strings.ToLower(accessLevel)
+			}
+		}
+	}
+	if len(s.NotAction.Actions) > 0 {
+		level, levelName = accessLevelRisks["Permissions management"], "permissions management"
+		widen(25, "every action but "+strings.Join(actionStrings(s.NotAction.Actions), ", "))
+	}
+	anyResource := len(s.NotResource.Resources) > 0
+	for _, resource := range s.Resource.Resources {
+		anyResource = anyResource || resource == "*" || strings.HasSuffix(resource, ":role/*")
+	}
+	for _, action := range pivotActions {
+		if anyResource && s.matchesAction(action) && accessLevelRisks["Permissions management"] > level {
+			level, levelName = accessLevelRisks["Permissions management"], string(action)+" on every role"
+		}
+	}
+
+	r := risk{score: level + breadth}
+	if levelName != "" {
+		r.reasons = append(r.reasons, levelName)
+	}
+	if breadthReason != "" {
+		r.reasons = append(r.reasons, breadthReason)
+	}
+	resources := 0
+	if len(s.NotResource.Resources) > 0 {
+		resources = 15
+	}
+	for _, resource := range s.Resource.Resources {
+		switch {
+		case resource == "*":
+			resources = 15
+		case strings.ContainsAny(resource, "*?") && resources < 5:
+			resources = 5
+		}
+	}
+	switch resources {
+	case 15:
+		r.reasons = append(r.reasons, "any resource")
+	case 5:
+		r.reasons = append(r.reasons, "wildcard resources")
+	}
+	r.score += resources
+	if len(s.Condition) == 0 {
+		r.score += 10
+		r.reasons = append(r.reasons, "no conditions")
+	}
+	if r.score > 100 {
+		r.score = 100
+	}
+	return r
+}
+
+// guessAccessLevel guesses the access level of an action missing from the
+// catalog from how its name starts, counting anything unusual as Write.
+func guessAccessLevel(action Action) string {
+	_, name, _ := strings.Cut(string(action), ":")
+	switch {
+	case strings.HasPrefix(name, "List"):
+		return "List"
+	case strings.HasPrefix(name, "Get"), strings.HasPrefix(name, "Describe"):
+		return "Read"
+	}
+	return "Write"
+}
+
+// principalRisk is the highest risk of statements and how many of them are
+// high risk.
+func principalRisk(statements []Statement) (highest risk, high int) {
+	for _, s := range statements {
+		r := statementRisk(s)
+		if r.score > highest.score {
+			highest = r
+		}
+		if r.score >= highRisk {
+			high++
+		}
+	}
+	return highest, high
+}
+
+// riskColor colors a score by whether it is high, medium or low.
+func riskColor(score int) func(a ...interface{}) string {
+	switch {
+	case score >= highRisk:
+		return color.New(color.FgRed).SprintFunc()
+	case score >= 40:
+		return color.New(color.FgYellow).SprintFunc()
+	}
+	return color.New(color.FgCyan).SprintFunc()
+}
+
+// presentRisk prints the score of an Allow statement and its reasons.
+func presentRisk(w io.Writer, s Statement) {
+	if s.Effect != "Allow" {
+		return
+	}
+	r := statementRisk(s)
+	faint := color.New(color.Faint).SprintFunc()
+	fmt.Fprintf(w, "    %s %s\n", riskColor(r.score)(fmt.Sprintf("risk %d", r.score)), faint(strings.Join(r.reasons, ", ")))
+}
+
+// presentRiskSummary prints the highest risk of the statements of a
+// principal and how many are high risk.
+func presentRiskSummary(w io.Writer, statements []Statement) {
+	highest, high := principalRisk(statements)
+	faint := color.New(color.Faint).SprintFunc()
+	fmt.Fprintf(w, "%s %s\n", riskColor(highest.score)(fmt.Sprintf("highest risk %d,", highest.score)), faint(fmt.Sprintf("%d of %d statements score %d or more", high, len(statements), highRisk)))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStatementRisk(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement string
+		min, max  int
+	}{
+		{"administrator", `{"Effect":"Allow","Action":"*","Resource":"*"}`, 100, 100},
+		{"not action", `{"Effect":"Allow","NotAction":["iam:*","organizations:*"],"Resource":"*"}`, 100, 100},
+		{"pass role on every role", `{"Effect":"Allow","Action":"iam:PassRole","Resource":"*"}`, highRisk, 100},
+		{"assume role on every role", `{"Effect":"Allow","Action":"sts:AssumeRole","Resource":"arn:aws:iam::111111111111:role/*"}`, highRisk, 100},
+		{"pass role on one role", `{"Effect":"Allow","Action":"iam:PassRole","Resource":"arn:aws:iam::111111111111:role/app"}`, 0, highRisk - 1},
+		{"read with a condition", `{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::logs/*","Condition":{"Bool":{"aws:SecureTransport":"true"}}}`, 1, 40},
+		{"deny", `{"Effect":"Deny","Action":"*","Resource":"*"}`, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := statementRisk(mustParse(t, `{"Statement":`+tt.statement+`}`)[0])
+			if r.score < tt.min || r.score > tt.max {
+				t.Errorf("score %d (%v), want between %d and %d", r.score, r.reasons, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestStatementRiskReasons(t *testing.T) {
+	r := statementRisk(mustParse(t, `{"Statement":{"Effect":"Allow","Action":"iam:PassRole","Resource":"*"}}`)[0])
+	want := []string{"iam:PassRole on every role", "any resource", "no conditions"}
+	if len(r.reasons) != len(want) {
+		t.Fatalf("reasons %v, want %v", r.reasons, want)
+	}
+	for i := range want {
+		if r.reasons[i] != want[i] {
+			t.Errorf("reasons %v, want %v", r.reasons, want)
+		}
+	}
+}
+
+func TestPrincipalRisk(t *testing.T) {
+	statements, err := readPolicyFile("testdata/poweruser.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	highest, high := principalRisk(statements)
+	if highest.score != 100 || high != 1 {
+		t.Errorf("highest %d with %d high risk statements, want 100 with 1", highest.score, high)
+	}
+}
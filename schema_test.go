@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// validateSchema checks value, as decoded by encoding/json, against the
+// subset of JSON Schema the output schemas use, returning every violation.
+func validateSchema(root, schema map[string]interface{}, value interface{}, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		def := root
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			def, _ = def[part].(map[string]interface{})
+		}
+		if def == nil {
+			return []string{fmt.Sprintf("%s: unknown $ref %s", path, ref)}
+		}
+		return validateSchema(root, def, value, path)
+	}
+
+	problems := []string{}
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, path+": "+fmt.Sprintf(format, args...))
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, value) {
+		fail("%v is not %v", value, c)
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			found = found || reflect.DeepEqual(e, value)
+		}
+		if !found {
+			fail("%v is not one of %v", value, enum)
+		}
+	}
+	if want, ok := schema["type"].(string); ok && schemaType(value) != want {
+		fail("%s is not %s", schemaType(value), want)
+		return problems
+	}
+
+	switch v := value.(type) {
+	case string:
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(v) {
+			fail("%q does not match %s", v, pattern)
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validateSchema(root, items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, key := range required {
+				if _, ok := v[key.(string)]; !ok {
+					fail("missing %s", key)
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for _, key := range sortedKeys(v) {
+			if property, ok := properties[key].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(root, property, v[key], path+"."+key)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					fail("unexpected property %s", key)
+				}
+			case map[string]interface{}:
+				problems = append(problems, validateSchema(root, additional, v[key], path+"."+key)...)
+			}
+		}
+	}
+	return problems
+}
+
+// schemaType is the JSON Schema type name of a decoded value.
+func schemaType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func TestOutputMatchesSchema(t *testing.T) {
+	statements, err := readPolicyFile("testdata/poweruser.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grouped := withSource(statements, StatementSource{Policy: "poweruser", Arn: "arn:aws:iam::111111111111:policy/poweruser", Version: "v2", Group: "devs"})
+
+	for _, version := range outputVersions {
+		t.Run(fmt.Sprintf("version %d", version), func(t *testing.T) {
+			var buf bytes.Buffer
+			presenter, err := newPresenter("json", &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := presenter.(*regoDataPresenter)
+			p.version = version
+			p.PrintHeader("arn:aws:iam::111111111111:role/admin")
+			for _, s := range statements {
+				p.PrintStatement(s)
+			}
+			p.PrintHeader("arn:aws:iam::111111111111:user/alice")
+			for _, s := range grouped {
+				p.PrintStatement(s)
+			}
+			if err := p.Finish(); err != nil {
+				t.Fatal(err)
+			}
+
+			checkSchema(t, version, buf.Bytes())
+		})
+	}
+}
+
+// checkSchema fails the test for every way output breaks the schema of
+// version.
+func checkSchema(t *testing.T, version int, output []byte) {
+	t.Helper()
+	data, err := outputSchema(version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("decoding schema: %v", err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(output, &value); err != nil {
+		t.Fatalf("decoding output: %v\n%s", err, output)
+	}
+	for _, problem := range validateSchema(schema, schema, value, "$") {
+		t.Error(problem)
+	}
+}
+
+// TestShowMatchesSchema checks the document show prints for a single
+// principal, whose statements are printed as they are fetched.
+func TestShowMatchesSchema(t *testing.T) {
+	for _, version := range outputVersions {
+		t.Run(fmt.Sprintf("version %d", version), func(t *testing.T) {
+			output := showJSON(t, &showOptions{output: "json", sort: "policy", jsonVersion: version, quiet: true}, "alice")
+			checkSchema(t, version, output)
+
+			var document struct {
+				Principals []map[string]interface{} `json:"principals"`
+			}
+			if err := json.Unmarshal(output, &document); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"principal", "account"} {
+				if len(document.Principals) != 1 || document.Principals[0][key] == nil {
+					t.Errorf("%s, which the schema only leaves out for --policy-file, is missing from %s", key, output)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	var schema map[string]interface{}
+	data, err := outputSchema(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	var output interface{}
+	if err := json.Unmarshal([]byte(`{"version":1,"principals":[{"account":"42","statements":[{"effect":"Maybe","actions":null,"extra":1}]}]}`), &output); err != nil {
+		t.Fatal(err)
+	}
+	if problems := validateSchema(schema, schema, output, "$"); len(problems) != 7 {
+		t.Errorf("found %d problems, want 7:\n%s", len(problems), strings.Join(problems, "\n"))
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// statementService answers statement and simulation queries for the long
+// running server modes, starting a fresh app for every query.
+type statementService struct {
+	global    *globalOptions
+	cfg       aws.Config
+	responses *responseCache
+}
+
+func newStatementService(global *globalOptions, cfg aws.Config, ttl time.Duration) *statementService {
+	return &statementService{global: global, cfg: cfg, responses: newResponseCache(ttl)}
+}
+
+// statements resolves and fetches target, reusing a recent response for the
+// same target. The caller identity is used when target is empty.
+func (s *statementService) statements(ctx context.Context, target string) (*cachedResponse, int, error) {
+	if res, ok := s.responses.get(target); ok {
+		return res, http.StatusOK, nil
+	}
+
+	a, err := s.global.appFromConfig(ctx, s.cfg)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer a.cancel()
+
+	arn := target
+	if arn == "" {
+		arn, err = a.fetcher.CallerArn(a.ctx)
+		if err != nil {
+			return nil, http.StatusBadGateway, a.describe(err)
+		}
+	}
+	arn, err = a.fetcher.ResolveName(a.ctx, arn)
+	if err != nil {
+		return nil, http.StatusNotFound, a.describe(err)
+	}
+
+	res := &cachedResponse{arn: arn}
+	res.statements, err = a.fetcher.FetchStatements(a.ctx, arn)
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		for _, err := range partial.Errors {
+			res.warnings = append(res.warnings, a.describe(err).Error())
+		}
+	} else if err != nil {
+		return nil, http.StatusBadGateway, a.describe(err)
+	}
+
+	s.responses.put(target, res)
+	return res, http.StatusOK, nil
+}
+
+// jsonStatement is the wire format of a statement, flattened and annotated
+// with the policy it came from.
+type jsonStatement struct {
+	Sid           string    `json:"sid,omitempty"`
+	Effect        string    `json:"effect"`
+	Actions       []Action  `json:"actions"`
+	NotActions    []Action  `json:"notActions,omitempty"`
+	Resources     []string  `json:"resources"`
+	NotResources  []string  `json:"notResources,omitempty"`
+	Policy        string    `json:"policy,omitempty"`
+	PolicyArn     string    `json:"policyArn,omitempty"`
+	PolicyVersion string    `json:"policyVersion,omitempty"`
+	Group         string    `json:"group,omitempty"`
+	Condition     Condition `json:"condition,omitempty"`
+}
+
+func toJSONStatements(statements []Statement) []jsonStatement {
+	out := []jsonStatement{}
+	for _, statement := range statements {
+		// lists are never null, as the output schema promises
+		actions, resources := statement.Action.Actions, statement.Resource.Resources
+		if actions == nil {
+			actions = []Action{}
+		}
+		if resources == nil {
+			resources = []string{}
+		}
+		out = append(out, jsonStatement{
+			Sid:           statement.Sid,
+			Effect:        statement.Effect,
+			Actions:       actions,
+			NotActions:    statement.NotAction.Actions,
+			Resources:     resources,
+			NotResources:  statement.NotResource.Resources,
+			Policy:        statement.Source.Policy,
+			PolicyArn:     statement.Source.Arn,
+			PolicyVersion: statement.Source.Version,
+			Group:         statement.Source.Group,
+			Condition:     statement.Condition,
+		})
+	}
+	return out
+}
+
+func fromJSONStatements(statements []jsonStatement) []Statement {
+	out := []Statement{}
+	for _, s := range statements {
+		out = append(out, Statement{
+			Sid:         s.Sid,
+			Effect:      s.Effect,
+			Action:      DynamicAction{Actions: s.Actions},
+			NotAction:   DynamicAction{Actions: s.NotActions},
+			Resource:    DynamicResource{Resources: s.Resources},
+			NotResource: DynamicResource{Resources: s.NotResources},
+			Condition:   s.Condition,
+			Source:      StatementSource{Policy: s.Policy, Arn: s.PolicyArn, Version: s.PolicyVersion, Group: s.Group},
+		})
+	}
+	return out
+}
+
+type statementsResponse struct {
+	Principal  string          `json:"principal"`
+	Statements []jsonStatement `json:"statements"`
+	Warnings   []string        `json:"warnings,omitempty"`
+}
+
+type simulateRequest struct {
+	Principal string                     `json:"principal"`
+	Actions   []Action                   `json:"actions"`
+	Resources []string                   `json:"resources"`
+	Context   map[string]ConditionValues `json:"context,omitempty"`
+	// SessionPolicy limits the principal as a role session would be.
+	SessionPolicy *RawPolicy `json:"sessionPolicy,omitempty"`
+}
+
+type simulateResult struct {
+	Action   Action          `json:"action"`
+	Resource string          `json:"resource"`
+	Decision Decision        `json:"decision"`
+	Matched  []jsonStatement `json:"matchedStatements"`
+}
+
+type simulateResponse struct {
+	Principal string           `json:"principal"`
+	Results   []simulateResult `json:"results"`
+	Warnings  []string         `json:"warnings,omitempty"`
+}
+
+// simulate evaluates every requested action against every requested
+// resource, defaulting to the "*" resource. Conditions are evaluated when
+// the request has a context, and only what its session policy also allows
+// is allowed when it has one.
+func simulate(res *cachedResponse, req simulateRequest) simulateResponse {
+	statements := res.statements
+	if req.SessionPolicy != nil {
+		session := withSource(req.SessionPolicy.Statement.Statements, StatementSource{Policy: "session policy"})
+		statements = intersectStatements(statements, session)
+	}
+	resources := req.Resources
+	if len(resources) == 0 {
+		resources = []string{"*"}
+	}
+	var ctx requestContext
+	if req.Context != nil {
+		ctx = requestContext{}
+		for key, values := range req.Context {
+			ctx[strings.ToLower(key)] = values
+		}
+		ctx = ctx.withRequestTime(time.Now())
+	}
+
+	out := simulateResponse{Principal: res.arn, Results: []simulateResult{}, Warnings: res.warnings}
+	for _, action := range req.Actions {
+		for _, resource := range resources {
+			eval := Evaluate(statements, action, resource, ctx)
+			out.Results = append(out.Results, simulateResult{
+				Action:   eval.Action,
+				Resource: eval.Resource,
+				Decision: eval.Decision,
+				Matched:  toJSONStatements(eval.Matched),
+			})
+		}
+	}
+	return out
+}
+
+type cachedResponse struct {
+	arn        string
+	statements []Statement
+	warnings   []string
+	expires    time.Time
+}
+
+// responseCache keeps fetched statements in memory for a short while so that
+// dashboards polling the server do not turn every request into IAM calls.
+type responseCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{ttl: ttl, entries: map[string]*cachedResponse{}}
+}
+
+func (c *responseCache) get(target string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res, ok := c.entries[target]
+	if !ok || time.Now().After(res.expires) {
+		delete(c.entries, target)
+		return nil, false
+	}
+	return res, true
+}
+
+func (c *responseCache) put(target string, res *cachedResponse) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res.expires = time.Now().Add(c.ttl)
+	c.entries[target] = res
+}
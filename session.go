@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// readSessionPolicy reads the session policy at path, attributing its
+// statements to "session policy" rather than to the file.
+func readSessionPolicy(path string) ([]Statement, error) {
+	statements, err := readPolicyFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("session policy: %w", err)
+	}
+	return withSource(statements, StatementSource{Policy: "session policy"}), nil
+}
+
+// intersectStatements returns what a session keeps of the statements of its
+// role when it was assumed with a session policy: a request must be allowed
+// by both, and a Deny in either still wins. Each Allow of the role is cut
+// down to the actions and resources some Allow of the session policy also
+// grants, with the conditions of both. Patterns that only partly overlap are
+// expanded through the catalog for actions, and dropped for resources, since
+// no single pattern matches just what both do.
+func intersectStatements(role, session []Statement) []Statement {
+	out := []Statement{}
+	for _, r := range role {
+		if r.Effect != "Allow" {
+			out = append(out, r)
+			continue
+		}
+		for _, s := range session {
+			if s.Effect != "Allow" {
+				continue
+			}
+			actions := intersectActions(r.Action.Actions, s.Action.Actions)
+			resources := intersectResources(r.Resource.Resources, s.Resource.Resources)
+			if len(actions) == 0 || len(resources) == 0 {
+				continue
+			}
+			statement := r
+			statement.Action = DynamicAction{Actions: actions}
+			statement.Resource = DynamicResource{Resources: resources}
+			statement.Condition = mergeConditions(r.Condition, s.Condition)
+			out = append(out, statement)
+		}
+	}
+	for _, s := range session {
+		if s.Effect != "Allow" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func intersectActions(a, b []Action) []Action {
+	seen := map[string]bool{}
+	out := []Action{}
+	add := func(action Action) {
+		if key := strings.ToLower(string(action)); !seen[key] {
+			seen[key] = true
+			out = append(out, action)
+		}
+	}
+	for _, x := range a {
+		for _, y := range b {
+			switch {
+			case wildcardMatch(string(y), string(x)):
+				add(x)
+			case wildcardMatch(string(x), string(y)):
+				add(y)
+			case patternsOverlap(strings.ToLower(string(x)), strings.ToLower(string(y))):
+				for _, expanded := range ExpandAction(x) {
+					if !strings.ContainsAny(string(expanded), "*?") && wildcardMatch(string(y), string(expanded)) {
+						add(expanded)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+func intersectResources(a, b []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, x := range a {
+		for _, y := range b {
+			narrower := ""
+			switch {
+			case resourceMatch(y, x):
+				narrower = x
+			case resourceMatch(x, y):
+				narrower = y
+			}
+			if narrower != "" && !seen[narrower] {
+				seen[narrower] = true
+				out = append(out, narrower)
+			}
+		}
+	}
+	return out
+}
+
+// mergeConditions returns a condition that holds when both a and b do. When
+// both test the same key with the same operator, only the values both allow
+// are kept, or for negated operators the values either rules out, which is
+// exact for the equality operators.
+func mergeConditions(a, b Condition) Condition {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	merged := Condition{}
+	for _, c := range []Condition{a, b} {
+		for operator, keys := range c {
+			if merged[operator] == nil {
+				merged[operator] = map[string]ConditionValues{}
+			}
+			for key, values := range keys {
+				existing, ok := merged[operator][key]
+				if !ok {
+					merged[operator][key] = values
+					continue
+				}
+				_, negated, _ := conditionOperators(strings.TrimSuffix(operator, "IfExists"))
+				merged[operator][key] = mergeValues(existing, values, negated)
+			}
+		}
+	}
+	return merged
+}
+
+func mergeValues(a, b ConditionValues, union bool) ConditionValues {
+	inB := map[string]bool{}
+	for _, v := range b {
+		inB[v] = true
+	}
+	out := ConditionValues{}
+	for _, v := range a {
+		if union || inB[v] {
+			out = append(out, v)
+		}
+		delete(inB, v)
+	}
+	if union {
+		for _, v := range b {
+			if inB[v] {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+// applySessionPolicy intersects the statements of the roles in results with
+// session, and returns warnings for the results it does not apply to.
+func applySessionPolicy(fetcher *Fetcher, results []principalResult, session []Statement) []string {
+	warnings := []string{}
+	for i, result := range results {
+		if !result.shown() {
+			continue
+		}
+		if t := fetcher.arnType(result.arn); t != RoleArn && t != AssumedRoleArn {
+			warnings = append(warnings, fmt.Sprintf("%s: session policies only apply to roles, showing its statements as they are", result.arn))
+			continue
+		}
+		results[i].statements = intersectStatements(result.statements, session)
+	}
+	return warnings
+}
@@ -0,0 +1,48 @@
+package main
+
+type Decision string
+
+const (
+	DecisionAllowed      Decision = "allowed"
+	DecisionExplicitDeny          = "explicitDeny"
+	DecisionImplicitDeny          = "implicitDeny"
+)
+
+// Evaluation is the outcome of evaluating one action on one resource.
+type Evaluation struct {
+	Action   Action
+	Resource string
+	Decision Decision
+	Matched  []Statement
+}
+
+// Evaluate decides whether statements allow action on resource using the
+// identity policy rules: any matching Deny wins, otherwise any matching
+// Allow allows, otherwise the request is implicitly denied. Conditions are
+// only evaluated when ctx is not nil, and statements whose conditions fail
+// then do not match. A resource of "*" matches every statement resource.
+func Evaluate(statements []Statement, action Action, resource string, ctx requestContext) Evaluation {
+	eval := Evaluation{Action: action, Resource: resource, Decision: DecisionImplicitDeny}
+	for _, statement := range statements {
+		if !statementMatches(statement, action, resource) {
+			continue
+		}
+		if ctx != nil && !statement.Condition.holds(ctx) {
+			continue
+		}
+		eval.Matched = append(eval.Matched, statement)
+		switch statement.Effect {
+		case "Deny":
+			eval.Decision = DecisionExplicitDeny
+		case "Allow":
+			if eval.Decision == DecisionImplicitDeny {
+				eval.Decision = DecisionAllowed
+			}
+		}
+	}
+	return eval
+}
+
+func statementMatches(statement Statement, action Action, resource string) bool {
+	return statement.matchesAction(action) && statement.matchesResource(resource)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/fatih/color"
+)
+
+// IAM quotas on policy sizes, in characters not counting whitespace. Inline
+// quotas apply to the total of every inline policy of a principal.
+const (
+	managedPolicyQuota = 6144
+	roleInlineQuota    = 10240
+	userInlineQuota    = 2048
+	groupInlineQuota   = 5120
+)
+
+// nearQuota is the share of a quota above which a policy is reported as
+// close to it.
+const nearQuota = 0.9
+
+type policyUsage struct {
+	name  string
+	kind  string
+	size  int
+	quota int
+}
+
+// policyUsages lists the size of every customer managed policy, and the
+// total size of the inline policies of the principal and of each group,
+// each against its quota. AWS managed policies are not subject to quotas.
+func policyUsages(principalType ArnType, statements []Statement) []policyUsage {
+	type policyKey struct{ group, policy, arn string }
+	seen := map[policyKey]bool{}
+	usages := []policyUsage{}
+	inline := map[string]int{}
+	groups := []string{}
+
+	for _, s := range statements {
+		key := policyKey{s.Source.Group, s.Source.Policy, s.Source.Arn}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		switch {
+		case s.Source.Arn != "":
+			if !isAWSManagedPolicy(s.Source.Arn) {
+				usages = append(usages, policyUsage{name: s.Source.Policy, kind: "managed", size: s.Source.Size, quota: managedPolicyQuota})
+			}
+		default:
+			if _, ok := inline[s.Source.Group]; !ok && s.Source.Group != "" {
+				groups = append(groups, s.Source.Group)
+			}
+			inline[s.Source.Group] += s.Source.Size
+		}
+	}
+
+	if size, ok := inline[""]; ok {
+		quota := roleInlineQuota
+		if principalType == UserArn {
+			quota = userInlineQuota
+		}
+		usages = append(usages, policyUsage{name: "inline policies", kind: string(principalType), size: size, quota: quota})
+	}
+	for _, group := range groups {
+		usages = append(usages, policyUsage{name: "inline policies of " + group, kind: "group", size: inline[group], quota: groupInlineQuota})
+	}
+	return usages
+}
+
+func presentPolicyUsages(w io.Writer, arn string, usages []policyUsage) {
+	bold := color.New(color.Bold).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+
+	fmt.Fprintf(w, "%s\n", bold("==> "+arn+" policy sizes <=="))
+	if len(usages) == 0 {
+		fmt.Fprintln(w, "no policies with a size quota")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "POLICY\tTYPE\tSIZE\tQUOTA\tUSED")
+	for _, u := range usages {
+		ratio := float64(u.size) / float64(u.quota)
+		used := fmt.Sprintf("%.0f%%", ratio*100)
+		switch {
+		case ratio > 1:
+			used = red(used + " over quota")
+		case ratio >= nearQuota:
+			used = yellow(used + " near quota")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", u.name, u.kind, u.size, u.quota, used)
+	}
+	tw.Flush()
+}
+
+// IAM quotas on counts. Roles, users and groups can have 10 managed policies
+// attached by default, which can be raised to 20.
+const (
+	attachedPolicyQuota = 10
+	groupsPerUserQuota  = 10
+	policyVersionQuota  = 5
+)
+
+// nearCountQuota is the share of a count quota from which it is reported as
+// close to it, lower than for sizes since counts grow a step at a time.
+const nearCountQuota = 0.8
+
+type policyLimit struct {
+	name  string
+	count int
+	quota int
+}
+
+// newerVersion is a version of a customer managed policy created after its
+// default version that allows something else, such as an edit saved without
+// being made the default, or what is left after rolling back to an older
+// version.
+type newerVersion struct {
+	policy         string
+	version        string
+	created        time.Time
+	defaultVersion string
+	diff           StatementDiff
+}
+
+// policyLimits counts the managed policies attached to the principal and to
+// each of its groups, the groups of a user, and the versions of every
+// customer managed policy, each against its quota, and returns the versions
+// newer than the default that differ from it. Failing to list or fetch
+// versions returns the error along with everything else.
+func (f *Fetcher) policyLimits(ctx context.Context, principalType ArnType, statements []Statement) ([]policyLimit, []newerVersion, error) {
+	attached := map[string]map[string]bool{}
+	groups := []string{}
+	customer := []StatementSource{}
+	seen := map[string]bool{}
+	for _, s := range statements {
+		if _, ok := attached[s.Source.Group]; !ok {
+			attached[s.Source.Group] = map[string]bool{}
+			if s.Source.Group != "" {
+				groups = append(groups, s.Source.Group)
+			}
+		}
+		if s.Source.Arn == "" {
+			continue
+		}
+		attached[s.Source.Group][s.Source.Arn] = true
+		if !isAWSManagedPolicy(s.Source.Arn) && !seen[s.Source.Arn] {
+			seen[s.Source.Arn] = true
+			customer = append(customer, s.Source)
+		}
+	}
+
+	limits := []policyLimit{}
+	if principalType != PolicyArn {
+		limits = append(limits, policyLimit{name: "managed policies attached to the " + string(principalType), count: len(attached[""]), quota: attachedPolicyQuota})
+	}
+	for _, group := range groups {
+		limits = append(limits, policyLimit{name: "managed policies attached to group " + group, count: len(attached[group]), quota: attachedPolicyQuota})
+	}
+	if principalType == UserArn {
+		limits = append(limits, policyLimit{name: "groups", count: len(groups), quota: groupsPerUserQuota})
+	}
+	var err error
+	newer := []newerVersion{}
+	for _, policy := range customer {
+		res, listErr := f.client.ListPolicyVersions(ctx, &iam.ListPolicyVersionsInput{PolicyArn: aws.String(policy.Arn)})
+		if listErr != nil {
+			if err == nil {
+				err = fmt.Errorf("listing versions of policy %s: %w", policy.Arn, listErr)
+			}
+			continue
+		}
+		limits = append(limits, policyLimit{name: "versions of policy " + policy.Policy, count: len(res.Versions), quota: policyVersionQuota})
+		versions, versionErr := f.newerVersions(ctx, policy, res.Versions, statements)
+		if versionErr != nil && err == nil {
+			err = versionErr
+		}
+		newer = append(newer, versions...)
+	}
+	return limits, newer, err
+}
+
+// newerVersions compares the versions of policy created after its default
+// version with the statements the principal has from the default.
+func (f *Fetcher) newerVersions(ctx context.Context, policy StatementSource, versions []types.PolicyVersion, statements []Statement) ([]newerVersion, error) {
+	var defaultCreated time.Time
+	for _, v := range versions {
+		if v.IsDefaultVersion {
+			defaultCreated = aws.ToTime(v.CreateDate)
+		}
+	}
+	current := []Statement{}
+	for _, s := range statements {
+		if s.Source.Arn == policy.Arn && s.Source.Group == policy.Group {
+			current = append(current, s)
+		}
+	}
+	newer := []newerVersion{}
+	for _, v := range versions {
+		created := aws.ToTime(v.CreateDate)
+		if v.IsDefaultVersion || !created.After(defaultCreated) {
+			continue
+		}
+		versionStatements, err := f.policyVersionStatements(ctx, policy.Arn, aws.ToString(v.VersionId))
+		if err != nil {
+			return newer, err
+		}
+		if diff := DiffStatements(current, versionStatements); !diff.Empty() {
+			newer = append(newer, newerVersion{policy: policy.Policy, version: aws.ToString(v.VersionId), created: created, defaultVersion: policy.Version, diff: diff})
+		}
+	}
+	sort.Slice(newer, func(i, j int) bool { return newer[i].created.Before(newer[j].created) })
+	return newer, nil
+}
+
+// policyVersionStatements fetches the statements of a version of a managed
+// policy, through the cache the default versions go through, since versions
+// never change.
+func (f *Fetcher) policyVersionStatements(ctx context.Context, arn, version string) ([]Statement, error) {
+	cacheKey := "policy-version:" + arn + ":" + version
+	if document, ok := f.cache.Get(cacheKey); ok {
+		if statements, err := decodeDocument(string(document)); err == nil {
+			return statements, nil
+		}
+	}
+	res, err := f.client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{PolicyArn: aws.String(arn), VersionId: aws.String(version)})
+	if err != nil {
+		return nil, fmt.Errorf("getting version %s of policy %s: %w", version, arn, err)
+	}
+	if res.PolicyVersion == nil || res.PolicyVersion.Document == nil {
+		return nil, fmt.Errorf("version %s of policy %s has no document", version, arn)
+	}
+	statements, err := decodeDocument(*res.PolicyVersion.Document)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse version %s of policy %s: %w", version, arn, err)
+	}
+	if err := f.cache.Put(cacheKey, []byte(*res.PolicyVersion.Document)); err != nil {
+		logger.Warn("could not cache policy document", "arn", arn, "error", err)
+	}
+	return statements, nil
+}
+
+// presentPolicyLimits prints limits as a table, followed by a line for each
+// policy version newer than the default that differs from it.
+func presentPolicyLimits(w io.Writer, arn string, limits []policyLimit, newer []newerVersion, now time.Time) {
+	bold := color.New(color.Bold).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+
+	fmt.Fprintf(w, "%s\n", bold("==> "+arn+" policy limits <=="))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LIMIT\tCOUNT\tQUOTA\tUSED")
+	for _, l := range limits {
+		ratio := float64(l.count) / float64(l.quota)
+		used := fmt.Sprintf("%.0f%%", ratio*100)
+		switch {
+		case l.count >= l.quota:
+			used = red(used + " at quota")
+		case ratio >= nearCountQuota:
+			used = yellow(used + " near quota")
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", l.name, l.count, l.quota, used)
+	}
+	tw.Flush()
+	for _, v := range newer {
+		fmt.Fprintln(w, yellow(fmt.Sprintf("policy %s version %s, created %s, is newer than the default %s and differs from it by %d added and %d removed statements",
+			v.policy, v.version, daysAgo(v.created, now), v.defaultVersion, len(v.diff.Added), len(v.diff.Removed))))
+	}
+}
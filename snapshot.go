@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const snapshotTimeFormat = "20060102T150405Z"
+
+// snapshot is the statements of a principal at a point in time.
+type snapshot struct {
+	Principal  string          `json:"principal"`
+	TakenAt    time.Time       `json:"takenAt"`
+	Statements []jsonStatement `json:"statements"`
+}
+
+func (s snapshot) statements() []Statement {
+	return fromJSONStatements(s.Statements)
+}
+
+// snapshotStore keeps snapshots as one JSON file each, in a directory per
+// principal.
+type snapshotStore struct {
+	dir string
+}
+
+func defaultSnapshotDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("finding config directory: %w", err)
+	}
+	return filepath.Join(dir, "iam-show", "snapshots"), nil
+}
+
+func (s *snapshotStore) principalDir(principal string) string {
+	return filepath.Join(s.dir, url.QueryEscape(principal))
+}
+
+func (s *snapshotStore) Save(principal string, takenAt time.Time, statements []Statement) error {
+	dir := s.principalDir(principal)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating snapshot directory: %w", err)
+	}
+	data, err := json.MarshalIndent(snapshot{
+		Principal:  principal,
+		TakenAt:    takenAt.UTC(),
+		Statements: toJSONStatements(normalizeStatements(statements)),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	path := filepath.Join(dir, takenAt.UTC().Format(snapshotTimeFormat)+".json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	return nil
+}
+
+// List returns the snapshots of principal, oldest first.
+func (s *snapshotStore) List(principal string) ([]snapshot, error) {
+	dir := s.principalDir(principal)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading snapshots: %w", err)
+	}
+
+	snapshots := []snapshot{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot: %w", err)
+		}
+		var snap snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("decoding snapshot %s: %w", entry.Name(), err)
+		}
+		snapshots = append(snapshots, snap)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].TakenAt.Before(snapshots[j].TakenAt) })
+	return snapshots, nil
+}
+
+// At returns the latest snapshot of principal taken at or before t, or the
+// earliest one when they were all taken later.
+func (s *snapshotStore) At(principal string, t time.Time) (snapshot, error) {
+	snapshots, err := s.List(principal)
+	if err != nil {
+		return snapshot{}, err
+	}
+	if len(snapshots) == 0 {
+		return snapshot{}, fmt.Errorf("no snapshots of %s in %s", principal, s.dir)
+	}
+	found := snapshots[0]
+	for _, snap := range snapshots {
+		if snap.TakenAt.After(t) {
+			break
+		}
+		found = snap
+	}
+	return found, nil
+}
+
+// parseSince accepts a date such as 2024-01-01 or a full RFC 3339 time.
+func parseSince(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected a date like 2024-01-01 or an RFC 3339 time", value)
+	}
+	return t, nil
+}
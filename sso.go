@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	ssotypes "github.com/aws/aws-sdk-go-v2/service/sso/types"
+)
+
+// ssoSessionError is the error of a profile whose IAM Identity Center
+// session has expired, was never started or was signed out of.
+type ssoSessionError struct {
+	profile string
+	err     error
+}
+
+func (e *ssoSessionError) Error() string {
+	return fmt.Sprintf("the IAM Identity Center session of profile %s has expired or is not logged in: run `aws sso login --profile %s`, or rerun with --sso-login",
+		e.profile, e.profile)
+}
+
+func (e *ssoSessionError) Unwrap() error {
+	return e.err
+}
+
+// ssoSessionExpired reports whether err comes from credentials of an IAM
+// Identity Center profile without a valid session: the cached token is
+// missing or expired, or the portal no longer accepts it.
+func ssoSessionExpired(err error) bool {
+	var invalidToken *ssocreds.InvalidTokenError
+	var unauthorized *ssotypes.UnauthorizedException
+	return errors.As(err, &invalidToken) || errors.As(err, &unauthorized)
+}
+
+// describeSSO replaces the errors of an expired IAM Identity Center session
+// with one saying how to log in again.
+func describeSSO(err error) error {
+	var sessionErr *ssoSessionError
+	if err == nil || errors.As(err, &sessionErr) || !ssoSessionExpired(err) {
+		return err
+	}
+	return &ssoSessionError{profile: awsProfile(), err: err}
+}
+
+// awsProfile is the profile the SDK loads, from AWS_PROFILE or
+// AWS_DEFAULT_PROFILE.
+func awsProfile() string {
+	for _, key := range []string{"AWS_PROFILE", "AWS_DEFAULT_PROFILE"} {
+		if profile := os.Getenv(key); profile != "" {
+			return profile
+		}
+	}
+	return "default"
+}
+
+// ensureSSOSession retrieves the credentials of cfg and, when the IAM
+// Identity Center session of the profile has expired, runs aws sso login
+// and retrieves them again. The login prompts go to stderr.
+func ensureSSOSession(ctx context.Context, cfg aws.Config) error {
+	if cfg.Credentials == nil {
+		return nil
+	}
+	_, err := cfg.Credentials.Retrieve(ctx)
+	if !ssoSessionExpired(err) {
+		// other credential errors surface from the first call, as they
+		// would without --sso-login
+		return nil
+	}
+	profile := awsProfile()
+	logger.Info("IAM Identity Center session expired, logging in", "profile", profile)
+	login := exec.CommandContext(ctx, "aws", "sso", "login", "--profile", profile)
+	login.Stdin, login.Stdout, login.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := login.Run(); err != nil {
+		return fmt.Errorf("running aws sso login --profile %s: %w", profile, err)
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return fmt.Errorf("retrieving credentials after aws sso login: %w", describeSSO(err))
+	}
+	return nil
+}
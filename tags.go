@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/fatih/color"
+	"golang.org/x/sync/errgroup"
+)
+
+// Tags returns the tags of a role, user or customer managed policy. The tags
+// of an assumed role session are those of its role.
+func (f *Fetcher) Tags(ctx context.Context, arn string) ([]types.Tag, error) {
+	switch f.arnType(arn) {
+	case RoleArn, AssumedRoleArn:
+		roleName, err := principalName(arn)
+		if err != nil {
+			return nil, err
+		}
+		res, err := f.client.ListRoleTags(ctx, &iam.ListRoleTagsInput{RoleName: aws.String(roleName)})
+		if err != nil {
+			return nil, fmt.Errorf("listing tags of role %s: %w", roleName, err)
+		}
+		return res.Tags, nil
+	case UserArn:
+		userName, err := principalName(arn)
+		if err != nil {
+			return nil, err
+		}
+		res, err := f.client.ListUserTags(ctx, &iam.ListUserTagsInput{UserName: aws.String(userName)})
+		if err != nil {
+			return nil, fmt.Errorf("listing tags of user %s: %w", userName, err)
+		}
+		return res.Tags, nil
+	case PolicyArn:
+		if isAWSManagedPolicy(arn) {
+			return nil, nil
+		}
+		res, err := f.client.ListPolicyTags(ctx, &iam.ListPolicyTagsInput{PolicyArn: aws.String(arn)})
+		if err != nil {
+			return nil, fmt.Errorf("listing tags of policy %s: %w", arn, err)
+		}
+		return res.Tags, nil
+	}
+	return nil, fmt.Errorf("%s has no tags", arn)
+}
+
+// tagFilter matches tags by key and value. An empty value matches any value
+// of the key.
+type tagFilter struct {
+	key   string
+	value string
+}
+
+func parseTagFilters(values []string) ([]tagFilter, error) {
+	filters := []tagFilter{}
+	for _, v := range values {
+		key, value, _ := strings.Cut(v, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid tag filter %q, expected key=value or key", v)
+		}
+		filters = append(filters, tagFilter{key: key, value: value})
+	}
+	return filters, nil
+}
+
+// matchTags reports whether tags satisfy every filter.
+func matchTags(tags []types.Tag, filters []tagFilter) bool {
+	for _, filter := range filters {
+		found := false
+		for _, tag := range tags {
+			if aws.ToString(tag.Key) == filter.key && (filter.value == "" || aws.ToString(tag.Value) == filter.value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// filterByTags keeps the candidates whose tags match every filter. IAM does
+// not filter by tag when listing, so the tags of each candidate are fetched.
+func (f *Fetcher) filterByTags(ctx context.Context, candidates []Candidate, filters []tagFilter) ([]Candidate, error) {
+	if len(filters) == 0 {
+		return candidates, nil
+	}
+	keep := make([]bool, len(candidates))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(f.concurrencyLimit())
+	for i, candidate := range candidates {
+		i, candidate := i, candidate
+		g.Go(func() error {
+			tags, err := f.Tags(gctx, candidate.Arn)
+			if err != nil {
+				return err
+			}
+			keep[i] = matchTags(tags, filters)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	matched := []Candidate{}
+	for i, candidate := range candidates {
+		if keep[i] {
+			matched = append(matched, candidate)
+		}
+	}
+	return matched, nil
+}
+
+func presentTags(w io.Writer, arn string, tags []types.Tag) {
+	bold := color.New(color.Bold).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+	fmt.Fprintf(w, "%s\n", bold("==> "+arn+" tags <=="))
+	if len(tags) == 0 {
+		fmt.Fprintln(w, faint("no tags"))
+		return
+	}
+	sort.Slice(tags, func(i, j int) bool { return aws.ToString(tags[i].Key) < aws.ToString(tags[j].Key) })
+	for _, tag := range tags {
+		fmt.Fprintf(w, "%s = %s\n", aws.ToString(tag.Key), aws.ToString(tag.Value))
+	}
+}
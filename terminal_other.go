@@ -0,0 +1,7 @@
+//go:build !windows
+
+package main
+
+// enableColors does nothing outside Windows, where terminals process ANSI
+// escape codes.
+func enableColors() {}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"github.com/fatih/color"
+	"golang.org/x/sys/windows"
+)
+
+// enableColors turns on the processing of ANSI escape codes in the Windows
+// consoles stdout and stderr write to. Consoles that cannot process them,
+// such as those before Windows 10, get no colors rather than raw codes.
+func enableColors() {
+	for _, f := range []*os.File{os.Stdout, os.Stderr} {
+		handle := windows.Handle(f.Fd())
+		var mode uint32
+		if err := windows.GetConsoleMode(handle, &mode); err != nil {
+			// not a console: redirected, or a terminal such as mintty
+			continue
+		}
+		if err := windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+			color.NoColor = true
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// terraformFile covers the JSON of `terraform show -json` for both plans and
+// state, as well as the raw state file format.
+type terraformFile struct {
+	PlannedValues   *terraformValues    `json:"planned_values"`
+	Values          *terraformValues    `json:"values"`
+	ResourceChanges []terraformChange   `json:"resource_changes"`
+	Resources       []terraformStateRes `json:"resources"`
+}
+
+type terraformValues struct {
+	RootModule terraformModule `json:"root_module"`
+}
+
+type terraformModule struct {
+	Resources    []terraformResource `json:"resources"`
+	ChildModules []terraformModule   `json:"child_modules"`
+}
+
+type terraformResource struct {
+	Address string                 `json:"address"`
+	Mode    string                 `json:"mode"`
+	Type    string                 `json:"type"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+type terraformChange struct {
+	Address string `json:"address"`
+	Mode    string `json:"mode"`
+	Type    string `json:"type"`
+	Change  struct {
+		Before map[string]interface{} `json:"before"`
+		After  map[string]interface{} `json:"after"`
+	} `json:"change"`
+}
+
+// terraformStateRes is a resource in a raw terraform.tfstate file.
+type terraformStateRes struct {
+	Module    string `json:"module"`
+	Mode      string `json:"mode"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Instances []struct {
+		IndexKey   interface{}            `json:"index_key"`
+		Attributes map[string]interface{} `json:"attributes"`
+	} `json:"instances"`
+}
+
+func (r terraformStateRes) address(indexKey interface{}) string {
+	address := r.Type + "." + r.Name
+	if r.Mode == "data" {
+		address = "data." + address
+	}
+	if r.Module != "" {
+		address = r.Module + "." + address
+	}
+	switch key := indexKey.(type) {
+	case float64:
+		address += fmt.Sprintf("[%d]", int(key))
+	case string:
+		address += fmt.Sprintf("[%q]", key)
+	}
+	return address
+}
+
+func readTerraformFile(path string) (*terraformFile, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading terraform file: %w", err)
+	}
+	var file terraformFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decoding terraform file, expected the output of terraform show -json: %w", err)
+	}
+	return &file, nil
+}
+
+// resources returns the managed resources the plan or state ends up with.
+func (f *terraformFile) resources() []terraformResource {
+	resources := []terraformResource{}
+	var walk func(m terraformModule)
+	walk = func(m terraformModule) {
+		resources = append(resources, m.Resources...)
+		for _, child := range m.ChildModules {
+			walk(child)
+		}
+	}
+	switch {
+	case f.PlannedValues != nil:
+		walk(f.PlannedValues.RootModule)
+	case f.Values != nil:
+		walk(f.Values.RootModule)
+	default:
+		for _, r := range f.Resources {
+			for _, instance := range r.Instances {
+				resources = append(resources, terraformResource{
+					Address: r.address(instance.IndexKey),
+					Mode:    r.Mode,
+					Type:    r.Type,
+					Values:  instance.Attributes,
+				})
+			}
+		}
+	}
+
+	managed := []terraformResource{}
+	for _, r := range resources {
+		if r.Mode == "managed" {
+			managed = append(managed, r)
+		}
+	}
+	return managed
+}
+
+// terraformPolicies returns the statements of the policy documents defined
+// by an IAM resource, and false for resources that define none. Attachments
+// of managed policies are not followed, as their documents live in AWS.
+func terraformPolicies(address, typ string, values map[string]interface{}) ([]Statement, bool, error) {
+	name, _ := values["name"].(string)
+	if name == "" {
+		name = address
+	}
+
+	switch typ {
+	case "aws_iam_policy", "aws_iam_role_policy", "aws_iam_user_policy", "aws_iam_group_policy":
+		statements, err := terraformDocument(address, name, values["policy"])
+		return statements, true, err
+	case "aws_iam_role":
+		blocks, _ := values["inline_policy"].([]interface{})
+		statements := []Statement{}
+		for _, block := range blocks {
+			inline, _ := block.(map[string]interface{})
+			policyName, _ := inline["name"].(string)
+			s, err := terraformDocument(address, policyName, inline["policy"])
+			if err != nil {
+				return nil, true, err
+			}
+			statements = append(statements, s...)
+		}
+		return statements, true, nil
+	}
+	return nil, false, nil
+}
+
+func terraformDocument(address, name string, policy interface{}) ([]Statement, error) {
+	document, _ := policy.(string)
+	if strings.TrimSpace(document) == "" {
+		// unknown until apply, or an empty inline_policy block
+		return nil, nil
+	}
+	statements, err := parseDocument([]byte(document))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", address, err)
+	}
+	return withSource(statements, StatementSource{Policy: name}), nil
+}
+
+// terraformStatements returns the statements of every IAM resource in a plan
+// or state, one section per resource address.
+func terraformStatements(path string) ([]principalStatements, error) {
+	file, err := readTerraformFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sections := []principalStatements{}
+	for _, r := range file.resources() {
+		statements, ok, err := terraformPolicies(r.Address, r.Type, r.Values)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if len(statements) == 0 {
+			logger.Info("no known policy document", "address", r.Address)
+			continue
+		}
+		sections = append(sections, principalStatements{principal: r.Address, statements: statements})
+	}
+	return sections, nil
+}
+
+type terraformDiff struct {
+	address string
+	diff    StatementDiff
+}
+
+// terraformChanges compares the statements of every IAM resource before and
+// after a plan is applied.
+func terraformChanges(path string) ([]terraformDiff, error) {
+	file, err := readTerraformFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if file.PlannedValues == nil {
+		return nil, fmt.Errorf("%s has no planned changes, expected the output of terraform show -json on a plan", path)
+	}
+
+	diffs := []terraformDiff{}
+	for _, change := range file.ResourceChanges {
+		if change.Mode != "managed" {
+			continue
+		}
+		before, ok, err := terraformPolicies(change.Address, change.Type, change.Change.Before)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		after, _, err := terraformPolicies(change.Address, change.Type, change.Change.After)
+		if err != nil {
+			return nil, err
+		}
+		if diff := DiffStatements(before, after); !diff.Empty() {
+			diffs = append(diffs, terraformDiff{address: change.Address, diff: diff})
+		}
+	}
+	return diffs, nil
+}
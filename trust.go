@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/fatih/color"
+)
+
+// TrustPolicy returns the statements of the trust policy of a role, saying
+// who may assume it. The trust policy of an assumed role session is that of
+// its role.
+func (f *Fetcher) TrustPolicy(ctx context.Context, arn string) ([]Statement, error) {
+	if t := f.arnType(arn); t != RoleArn && t != AssumedRoleArn {
+		return nil, fmt.Errorf("%s is not a role, only roles have trust policies", arn)
+	}
+	roleName, err := principalName(arn)
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return nil, fmt.Errorf("getting role %s: %w", roleName, err)
+	}
+	statements, err := decodeDocument(aws.ToString(res.Role.AssumeRolePolicyDocument))
+	if err != nil {
+		return nil, fmt.Errorf("trust policy of role %s: %w", roleName, err)
+	}
+	return withSource(statements, StatementSource{Policy: "trust policy"}), nil
+}
+
+// orgKeys are the condition keys that limit principals to an organization,
+// with how values of each read in a sentence.
+var orgKeys = map[string]string{
+	"aws:principalorgid":    "in organization %s",
+	"aws:principalorgpaths": "under %s",
+}
+
+// describeOrgBoundary puts the organization conditions of a statement in
+// words, such as "only principals in organization o-abc", or returns ""
+// when it has none.
+func describeOrgBoundary(s Statement) string {
+	clauses := conditionPhrases(s.Condition, orgKeys)
+	if len(clauses) == 0 {
+		return ""
+	}
+	phrases := []string{}
+	negated := false
+	for _, clause := range clauses {
+		phrases = append(phrases, clause.phrase)
+		negated = negated || clause.negated
+	}
+	switch {
+	case s.Effect == "Deny" && negated:
+		return "unless the principal is " + strings.Join(phrases, " or ")
+	case negated:
+		return "only principals not " + strings.Join(phrases, " and ")
+	}
+	return "only principals " + strings.Join(phrases, " and ")
+}
+
+// orgBounded reports whether an Allow only applies to principals in an
+// organization, through its own condition or through a Deny of everything
+// it grants to principals outside one.
+func orgBounded(s Statement, statements []Statement) bool {
+	if s.Effect != "Allow" {
+		return false
+	}
+	for _, clause := range conditionPhrases(s.Condition, orgKeys) {
+		if !clause.negated {
+			return true
+		}
+	}
+	for _, deny := range statements {
+		if deny.Effect != "Deny" {
+			continue
+		}
+		negated := false
+		for _, clause := range conditionPhrases(deny.Condition, orgKeys) {
+			negated = negated || clause.negated
+		}
+		if negated && coversAll(deny.Action.Actions, s.Action.Actions) && coversAllResources(deny.Resource.Resources, s.Resource.Resources) {
+			return true
+		}
+	}
+	return false
+}
+
+// orgIDs returns the organization ids the conditions of statements name,
+// including those at the start of organization paths.
+func orgIDs(statements []Statement) []string {
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, s := range statements {
+		for _, clause := range s.Condition.clauses() {
+			if _, ok := orgKeys[strings.ToLower(clause.key)]; !ok {
+				continue
+			}
+			for _, v := range clause.values {
+				id, _, _ := strings.Cut(v, "/")
+				if id != "" && !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// currentOrganization returns the id of the organization of the caller's
+// account, or "" when it is not in one.
+func currentOrganization(ctx context.Context, cfg aws.Config) (string, error) {
+	res, err := organizations.NewFromConfig(cfg).DescribeOrganization(ctx, &organizations.DescribeOrganizationInput{})
+	var notInUse *orgtypes.AWSOrganizationsNotInUseException
+	if errors.As(err, &notInUse) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("describing organization: %w", err)
+	}
+	return aws.ToString(res.Organization.Id), nil
+}
+
+// presentOrgBoundary summarizes how many Allow statements that name
+// principals are limited to an organization, and when current is set,
+// whether the organizations they name are it. Statements without
+// principals, as in identity policies, are not counted.
+func presentOrgBoundary(w io.Writer, statements []Statement, verify bool, current string) {
+	red := color.New(color.FgRed).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+
+	allows, bounded := 0, 0
+	for _, s := range statements {
+		if s.Effect != "Allow" || len(s.Principal) == 0 {
+			continue
+		}
+		allows++
+		if orgBounded(s, statements) {
+			bounded++
+		}
+	}
+	if allows > 0 {
+		fmt.Fprintln(w, faint(fmt.Sprintf("%d of %d Allow statements are limited to an organization", bounded, allows)))
+	}
+	if !verify {
+		return
+	}
+	for _, id := range orgIDs(statements) {
+		switch {
+		case current == "":
+			fmt.Fprintf(w, "%s\n", red(id+" cannot be this organization, the account is not in one"))
+		case id == current:
+			fmt.Fprintf(w, "%s\n", green(id+" is this organization"))
+		default:
+			fmt.Fprintf(w, "%s\n", red(fmt.Sprintf("%s is not this organization, which is %s", id, current)))
+		}
+	}
+}
+
+// presentTrustPolicy prints the trust policy of a role the way the text
+// presenter prints statements, followed by its organization boundary and
+// warnings about wildcard principals.
+func presentTrustPolicy(w io.Writer, arn string, statements []Statement, verify bool, current string) {
+	bold := color.New(color.Bold).SprintFunc()
+	fmt.Fprintf(w, "%s\n", bold("==> "+withAccountName(arn)+" trust policy <=="))
+	p := newTextPresenter(w)
+	for _, statement := range statements {
+		p.PrintStatement(statement)
+	}
+	p.Finish()
+	presentOrgBoundary(w, statements, verify, current)
+	presentWildcardPrincipals(w, statements)
+}
+
+// presentWildcardPrincipals warns about each statement of a trust policy
+// that lets anyone assume the role.
+func presentWildcardPrincipals(w io.Writer, statements []Statement) {
+	warn := color.New(color.FgRed, color.Bold).SprintFunc()
+	for _, f := range checkWildcardPrincipals(statements) {
+		fmt.Fprintf(w, "%s\n", warn("warning: "+describeStatement(f.statement)+" lets anyone with an AWS account assume this role"))
+	}
+}
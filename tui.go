@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type tuiStatement struct {
+	principal string
+	statement Statement
+}
+
+// tuiPresenter collects everything that would have been printed and opens an
+// interactive browser over it in Finish.
+type tuiPresenter struct {
+	principal string
+	entries   []tuiStatement
+}
+
+func newTUIPresenter() *tuiPresenter {
+	return &tuiPresenter{}
+}
+
+func (p *tuiPresenter) PrintHeader(principal string) {
+	p.principal = principal
+}
+
+func (p *tuiPresenter) PrintStatement(statement Statement) {
+	p.entries = append(p.entries, tuiStatement{principal: p.principal, statement: statement})
+}
+
+func (p *tuiPresenter) Finish() error {
+	return newTUIBrowser(p.entries).app.Run()
+}
+
+type tuiPolicy struct {
+	principal string
+	group     string
+	policy    string
+	label     string
+}
+
+type tuiBrowser struct {
+	app        *tview.Application
+	policies   *tview.List
+	statements *tview.List
+	details    *tview.TextView
+	filter     *tview.InputField
+	status     *tview.TextView
+
+	entries  []tuiStatement
+	groups   []tuiPolicy
+	visible  []int
+	expand   bool
+	panes    []tview.Primitive
+	focusIdx int
+}
+
+func newTUIBrowser(entries []tuiStatement) *tuiBrowser {
+	b := &tuiBrowser{
+		app:        tview.NewApplication(),
+		policies:   tview.NewList().ShowSecondaryText(false),
+		statements: tview.NewList(),
+		details:    tview.NewTextView().SetDynamicColors(true).SetWordWrap(true),
+		filter:     tview.NewInputField().SetLabel("filter: "),
+		status:     tview.NewTextView().SetDynamicColors(true),
+		entries:    entries,
+	}
+	b.policies.SetBorder(true).SetTitle(" Policies ")
+	b.statements.SetBorder(true).SetTitle(" Statements ")
+	b.details.SetBorder(true).SetTitle(" Details ")
+	b.panes = []tview.Primitive{b.policies, b.statements, b.details}
+
+	b.groups = groupPolicies(entries)
+	b.policies.AddItem(fmt.Sprintf("All (%d)", len(entries)), "", 0, nil)
+	for _, group := range b.groups {
+		b.policies.AddItem(tview.Escape(group.label), "", 0, nil)
+	}
+	b.policies.SetChangedFunc(func(int, string, string, rune) { b.refreshStatements() })
+	b.statements.SetChangedFunc(func(index int, _ string, _ string, _ rune) { b.showDetails(index) })
+
+	b.filter.SetChangedFunc(func(string) { b.refreshStatements() })
+	b.filter.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			b.filter.SetText("")
+		}
+		b.app.SetFocus(b.statements)
+	})
+
+	panes := tview.NewFlex().
+		AddItem(b.policies, 0, 1, true).
+		AddItem(b.statements, 0, 3, false).
+		AddItem(b.details, 0, 2, false)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(panes, 0, 1, true).
+		AddItem(b.filter, 1, 0, false).
+		AddItem(b.status, 1, 0, false)
+
+	b.app.SetRoot(root, true).SetInputCapture(b.handleKey)
+	b.refreshStatements()
+	return b
+}
+
+// groupPolicies returns one entry per distinct policy, in the order the
+// policies were first seen.
+func groupPolicies(entries []tuiStatement) []tuiPolicy {
+	principals := map[string]bool{}
+	for _, entry := range entries {
+		principals[entry.principal] = true
+	}
+
+	groups := []tuiPolicy{}
+	seen := map[tuiPolicy]bool{}
+	for _, entry := range entries {
+		source := entry.statement.Source
+		group := tuiPolicy{principal: entry.principal, group: source.Group, policy: source.Policy}
+		if seen[group] {
+			continue
+		}
+		seen[group] = true
+		group.label = group.policy
+		if group.label == "" {
+			group.label = "(unnamed policy)"
+		}
+		if group.group != "" {
+			group.label = "group " + group.group + " / " + group.label
+		}
+		if len(principals) > 1 {
+			group.label = shortPrincipal(group.principal) + " / " + group.label
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// shortPrincipal returns the last path component of an arn, which is the
+// role or user name for IAM principals.
+func shortPrincipal(arn string) string {
+	if i := strings.LastIndexAny(arn, "/:"); i >= 0 {
+		return arn[i+1:]
+	}
+	return arn
+}
+
+func (b *tuiBrowser) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if b.filter.HasFocus() {
+		return event
+	}
+	switch event.Key() {
+	case tcell.KeyTab:
+		b.cycleFocus(1)
+		return nil
+	case tcell.KeyBacktab:
+		b.cycleFocus(-1)
+		return nil
+	case tcell.KeyEscape:
+		b.app.Stop()
+		return nil
+	}
+	switch event.Rune() {
+	case 'q':
+		b.app.Stop()
+		return nil
+	case '/':
+		b.app.SetFocus(b.filter)
+		return nil
+	case 'e':
+		b.expand = !b.expand
+		b.refreshStatements()
+		return nil
+	}
+	return event
+}
+
+func (b *tuiBrowser) cycleFocus(step int) {
+	b.focusIdx = (b.focusIdx + step + len(b.panes)) % len(b.panes)
+	b.app.SetFocus(b.panes[b.focusIdx])
+}
+
+func (b *tuiBrowser) actions(statement Statement) []Action {
+	if !b.expand {
+		return statement.Action.Actions
+	}
+	return expandActions(statement.Action.Actions)
+}
+
+func joinPatterns(actions []Action) string {
+	names := []string{}
+	for _, action := range actions {
+		names = append(names, string(action))
+	}
+	return strings.Join(names, ", ")
+}
+
+// tuiResources lists the resources of a statement on one line, or those its
+// NotResource leaves out after "all but".
+func tuiResources(statement Statement) string {
+	if len(statement.NotResource.Resources) > 0 {
+		return "all but " + strings.Join(statement.NotResource.Resources, ", ")
+	}
+	return strings.Join(statement.Resource.Resources, ", ")
+}
+
+func expandActions(actions []Action) []Action {
+	expanded := []Action{}
+	for _, action := range actions {
+		expanded = append(expanded, ExpandAction(action)...)
+	}
+	return expanded
+}
+
+// matchesFilter reports whether any action of the statement mentions query,
+// either literally or because a wildcard action covers it.
+func matchesFilter(statement Statement, query string) bool {
+	if query == "" {
+		return true
+	}
+	query = strings.ToLower(query)
+	for _, action := range statement.Action.Actions {
+		if wildcardMatch(string(action), query) {
+			return true
+		}
+		for _, expanded := range ExpandAction(action) {
+			if strings.Contains(strings.ToLower(string(expanded)), query) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (b *tuiBrowser) refreshStatements() {
+	var group *tuiPolicy
+	if i := b.policies.GetCurrentItem(); i > 0 && i <= len(b.groups) {
+		group = &b.groups[i-1]
+	}
+	query := strings.TrimSpace(b.filter.GetText())
+
+	b.visible = b.visible[:0]
+	for i, entry := range b.entries {
+		source := entry.statement.Source
+		if group != nil && (entry.principal != group.principal || source.Group != group.group || source.Policy != group.policy) {
+			continue
+		}
+		if !matchesFilter(entry.statement, query) {
+			continue
+		}
+		b.visible = append(b.visible, i)
+	}
+
+	b.statements.Clear()
+	for _, i := range b.visible {
+		statement := b.entries[i].statement
+		actions := []string{}
+		for _, action := range b.actions(statement) {
+			actions = append(actions, string(action))
+		}
+		main := fmt.Sprintf("%s %s", tuiEffect(statement.Effect), tview.Escape(strings.Join(actions, ", ")))
+		if len(statement.NotAction.Actions) > 0 {
+			main = fmt.Sprintf("%s all but %s", tuiEffect(statement.Effect), tview.Escape(joinPatterns(statement.NotAction.Actions)))
+		}
+		secondary := "  " + tview.Escape(tuiResources(statement))
+		b.statements.AddItem(main, secondary, 0, nil)
+	}
+	b.showDetails(b.statements.GetCurrentItem())
+	b.showStatus()
+}
+
+func tuiEffect(effect string) string {
+	switch effect {
+	case "Allow":
+		return "[green]Allow[-]"
+	case "Deny":
+		return "[red]Deny[-]"
+	}
+	return tview.Escape(effect)
+}
+
+func (b *tuiBrowser) showDetails(index int) {
+	b.details.Clear()
+	if index < 0 || index >= len(b.visible) {
+		return
+	}
+	entry := b.entries[b.visible[index]]
+	statement := entry.statement
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[::b]Effect[::-]\n  %s\n\n", tuiEffect(statement.Effect))
+	if entry.principal != "" {
+		fmt.Fprintf(&sb, "[::b]Principal[::-]\n  %s\n\n", tview.Escape(entry.principal))
+	}
+
+	source := statement.Source
+	fmt.Fprintf(&sb, "[::b]Policy[::-]\n  %s\n", tview.Escape(source.Policy))
+	if source.Arn != "" {
+		fmt.Fprintf(&sb, "  [gray]%s (%s)[-]\n", tview.Escape(source.Arn), tview.Escape(source.Version))
+	}
+	if source.Group != "" {
+		fmt.Fprintf(&sb, "  [gray]through group %s[-]\n", tview.Escape(source.Group))
+	}
+	fmt.Fprintf(&sb, "  [gray]statement %d[-]\n\n", source.Index+1)
+
+	sb.WriteString("[::b]Actions[::-]\n")
+	for _, action := range statement.Action.Actions {
+		expanded := ExpandAction(action)
+		if !b.expand || len(expanded) == 1 && expanded[0] == action {
+			fmt.Fprintf(&sb, "  [yellow]%s[-]%s\n", tview.Escape(string(action)), tuiActionHint(action, expanded))
+			continue
+		}
+		fmt.Fprintf(&sb, "  [yellow]%s[-] [gray]expands to[-]\n", tview.Escape(string(action)))
+		for _, a := range expanded {
+			fmt.Fprintf(&sb, "    %s%s\n", tview.Escape(string(a)), tuiActionHint(a, nil))
+		}
+	}
+
+	if len(statement.NotAction.Actions) > 0 {
+		sb.WriteString("[::b]All actions but[::-]\n")
+		for _, action := range statement.NotAction.Actions {
+			fmt.Fprintf(&sb, "  [yellow]%s[-]\n", tview.Escape(string(action)))
+		}
+	}
+
+	sb.WriteString("\n[::b]Resources[::-]\n")
+	for _, resource := range statement.Resource.Resources {
+		fmt.Fprintf(&sb, "  [blue]%s[-]\n", tview.Escape(resource))
+	}
+	if len(statement.NotResource.Resources) > 0 {
+		sb.WriteString("  [gray]all but[-]\n")
+		for _, resource := range statement.NotResource.Resources {
+			fmt.Fprintf(&sb, "  [blue]%s[-]\n", tview.Escape(resource))
+		}
+	}
+
+	b.details.SetText(sb.String())
+	b.details.ScrollToBeginning()
+}
+
+// tuiActionHint describes an action next to its name: the access level of a
+// single action, or how many catalog actions a wildcard covers.
+func tuiActionHint(action Action, expanded []Action) string {
+	if len(expanded) > 1 || len(expanded) == 1 && expanded[0] != action {
+		return fmt.Sprintf(" [gray](%d actions, e to expand)[-]", len(expanded))
+	}
+	if a, ok := catalogAction(action); ok {
+		return " [gray]" + a.AccessLevel + "[-]"
+	}
+	return ""
+}
+
+func (b *tuiBrowser) showStatus() {
+	expand := "expand"
+	if b.expand {
+		expand = "collapse"
+	}
+	b.status.SetText(fmt.Sprintf(
+		"%d of %d statements  [yellow]Tab[-] switch pane  [yellow]/[-] filter  [yellow]e[-] %s wildcards  [yellow]q[-] quit",
+		len(b.visible), len(b.entries), expand,
+	))
+}
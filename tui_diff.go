@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-isatty"
+	"github.com/rivo/tview"
+)
+
+// tuiDiffSection is the diff of one principal or terraform resource.
+type tuiDiffSection struct {
+	title string
+	diff  StatementDiff
+}
+
+// tuiChange is a statement added, removed or changed, marked +, - or ~ like
+// presentDrift. before is nil for added statements and after for removed
+// ones.
+type tuiChange struct {
+	title  string
+	mark   string
+	before *Statement
+	after  *Statement
+}
+
+// diffChanges lists the changes of sections, changed statements first, then
+// added and removed ones, section by section.
+func diffChanges(sections []tuiDiffSection) []tuiChange {
+	changes := []tuiChange{}
+	for _, section := range sections {
+		changed, rest := section.diff.changes()
+		for i := range changed {
+			changes = append(changes, tuiChange{title: section.title, mark: "~", before: &changed[i].before, after: &changed[i].after})
+		}
+		for i := range rest.Added {
+			changes = append(changes, tuiChange{title: section.title, mark: "+", after: &rest.Added[i]})
+		}
+		for i := range rest.Removed {
+			changes = append(changes, tuiChange{title: section.title, mark: "-", before: &rest.Removed[i]})
+		}
+	}
+	return changes
+}
+
+type tuiDiffViewer struct {
+	app     *tview.Application
+	changes *tview.List
+	before  *tview.TextView
+	after   *tview.TextView
+	status  *tview.TextView
+
+	entries  []tuiChange
+	panes    []tview.Primitive
+	focusIdx int
+}
+
+// runDiffTUI opens the changes of sections in a terminal UI, with the
+// statement before and after each change side by side.
+func runDiffTUI(sections []tuiDiffSection) error {
+	if !isatty.IsTerminal(os.Stdout.Fd()) {
+		return errors.New("--tui requires an interactive terminal")
+	}
+	// statements are colored by the viewer, not the presenter
+	color.NoColor = true
+	return newTUIDiffViewer(diffChanges(sections), len(sections) > 1).app.Run()
+}
+
+func newTUIDiffViewer(entries []tuiChange, titled bool) *tuiDiffViewer {
+	v := &tuiDiffViewer{
+		app:     tview.NewApplication(),
+		changes: tview.NewList(),
+		before:  tview.NewTextView().SetDynamicColors(true),
+		after:   tview.NewTextView().SetDynamicColors(true),
+		status:  tview.NewTextView().SetDynamicColors(true),
+		entries: entries,
+	}
+	v.changes.SetBorder(true).SetTitle(" Changes ")
+	v.before.SetBorder(true).SetTitle(" Before ")
+	v.after.SetBorder(true).SetTitle(" After ")
+	v.panes = []tview.Primitive{v.changes, v.before, v.after}
+
+	for _, entry := range entries {
+		statement := entry.after
+		if statement == nil {
+			statement = entry.before
+		}
+		actions := []string{}
+		for _, action := range statement.Action.Actions {
+			actions = append(actions, string(action))
+		}
+		if len(statement.NotAction.Actions) > 0 {
+			actions = []string{"all but " + joinPatterns(statement.NotAction.Actions)}
+		}
+		main := fmt.Sprintf("%s %s %s", tuiDiffMark(entry.mark), tuiEffect(statement.Effect), tview.Escape(strings.Join(actions, ", ")))
+		secondary := "  " + tview.Escape(tuiResources(*statement))
+		if titled {
+			secondary = "  " + tview.Escape(entry.title)
+		}
+		v.changes.AddItem(main, secondary, 0, nil)
+	}
+	v.changes.SetChangedFunc(func(index int, _ string, _ string, _ rune) { v.showChange(index) })
+
+	sides := tview.NewFlex().
+		AddItem(v.before, 0, 1, false).
+		AddItem(v.after, 0, 1, false)
+	panes := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(v.changes, 0, 1, true).
+		AddItem(sides, 0, 2, false)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(panes, 0, 1, true).
+		AddItem(v.status, 1, 0, false)
+
+	v.app.SetRoot(root, true).SetInputCapture(v.handleKey)
+	v.showChange(0)
+	return v
+}
+
+func tuiDiffMark(mark string) string {
+	switch mark {
+	case "+":
+		return "[green]+[-]"
+	case "-":
+		return "[red]-[-]"
+	}
+	return "[yellow]~[-]"
+}
+
+func (v *tuiDiffViewer) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyTab:
+		v.cycleFocus(1)
+		return nil
+	case tcell.KeyBacktab:
+		v.cycleFocus(-1)
+		return nil
+	case tcell.KeyEscape:
+		v.app.Stop()
+		return nil
+	}
+	switch event.Rune() {
+	case 'q':
+		v.app.Stop()
+		return nil
+	case 'n':
+		v.step(1)
+		return nil
+	case 'p':
+		v.step(-1)
+		return nil
+	}
+	return event
+}
+
+func (v *tuiDiffViewer) cycleFocus(step int) {
+	v.focusIdx = (v.focusIdx + step + len(v.panes)) % len(v.panes)
+	v.app.SetFocus(v.panes[v.focusIdx])
+}
+
+// step moves to the next or previous change from any pane, wrapping around.
+func (v *tuiDiffViewer) step(by int) {
+	if len(v.entries) == 0 {
+		return
+	}
+	v.changes.SetCurrentItem((v.changes.GetCurrentItem() + by + len(v.entries)) % len(v.entries))
+}
+
+// showChange shows the statement of a change before and after it, coloring
+// the lines only found on one side red or green.
+func (v *tuiDiffViewer) showChange(index int) {
+	v.before.Clear()
+	v.after.Clear()
+	if index < 0 || index >= len(v.entries) {
+		v.showStatus(index)
+		return
+	}
+	entry := v.entries[index]
+	beforeLines, afterLines := statementLines(entry.before), statementLines(entry.after)
+	v.before.SetText(tuiDiffSide(entry.before, beforeLines, afterLines, "red", "not there before"))
+	v.after.SetText(tuiDiffSide(entry.after, afterLines, beforeLines, "green", "not there after"))
+	v.before.ScrollToBeginning()
+	v.after.ScrollToBeginning()
+	v.showStatus(index)
+}
+
+// statementLines are the lines show prints for a statement, without colors.
+func statementLines(s *Statement) []string {
+	if s == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	s.Present(&buf)
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
+
+// tuiDiffSide renders the lines of one side of a change, coloring those the
+// other side does not have.
+func tuiDiffSide(s *Statement, lines, other []string, colorName, missing string) string {
+	if s == nil {
+		return "[gray]" + missing + "[-]"
+	}
+	others := map[string]bool{}
+	for _, line := range other {
+		others[line] = true
+	}
+	var sb strings.Builder
+	for _, line := range lines {
+		if others[line] {
+			fmt.Fprintf(&sb, "%s\n", tview.Escape(line))
+			continue
+		}
+		fmt.Fprintf(&sb, "[%s]%s[-]\n", colorName, tview.Escape(line))
+	}
+	if len(s.Condition) > 0 {
+		data, _ := json.Marshal(s.Condition)
+		fmt.Fprintf(&sb, "\n[::b]Condition[::-]\n%s\n", tview.Escape(string(data)))
+	}
+	if s.Source.Policy != "" {
+		fmt.Fprintf(&sb, "\n[gray]from %s[-]\n", tview.Escape(s.Source.Policy))
+	}
+	return sb.String()
+}
+
+func (v *tuiDiffViewer) showStatus(index int) {
+	added, removed, changed := 0, 0, 0
+	for _, entry := range v.entries {
+		switch entry.mark {
+		case "+":
+			added++
+		case "-":
+			removed++
+		default:
+			changed++
+		}
+	}
+	v.status.SetText(fmt.Sprintf(
+		"%d of %d changes: %d added, %d removed, %d changed  [yellow]n[-]/[yellow]p[-] next/previous  [yellow]Tab[-] switch pane  [yellow]q[-] quit",
+		index+1, len(v.entries), added, removed, changed,
+	))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// usagePresenter prints statements like the text presenter, marking each
+// allowed action as used or unused according to CloudTrail.
+type usagePresenter struct {
+	collector
+	w      io.Writer
+	days   int
+	lookup func(principal string) ([]Action, error)
+}
+
+func newUsagePresenter(w io.Writer, days int, lookup func(principal string) ([]Action, error)) *usagePresenter {
+	return &usagePresenter{w: w, days: days, lookup: lookup}
+}
+
+func (p *usagePresenter) Finish() error {
+	bold := color.New(color.Bold).SprintFunc()
+	for i, section := range p.sections {
+		if len(p.sections) > 1 {
+			if i > 0 {
+				fmt.Fprintln(p.w)
+			}
+			fmt.Fprintf(p.w, "%s\n", bold("==> "+section.principal+" <=="))
+		}
+
+		used, err := p.lookup(section.principal)
+		if err != nil {
+			logger.Warn("could not look up usage", "arn", section.principal, "error", err)
+			for _, statement := range section.statements {
+				statement.Present(p.w)
+			}
+			continue
+		}
+		for _, statement := range section.statements {
+			presentUsage(p.w, statement, used)
+		}
+		p.presentSummary(section.statements, used)
+	}
+	return nil
+}
+
+// usedBy returns the used actions that action grants, which may be several
+// for a wildcard.
+func usedBy(action Action, used []Action) []Action {
+	matched := []Action{}
+	for _, u := range used {
+		if wildcardMatch(string(action), string(u)) {
+			matched = append(matched, u)
+		}
+	}
+	return matched
+}
+
+func presentUsage(w io.Writer, s Statement, used []Action) {
+	if s.Effect != "Allow" || s.negated() {
+		s.Present(w)
+		return
+	}
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	blue := color.New(color.FgBlue).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+
+	actions := []string{}
+	for _, action := range s.Action.Actions {
+		matched := usedBy(action, used)
+		switch {
+		case len(matched) == 0:
+			actions = append(actions, yellow(string(action))+" "+red("(unused)"))
+		case strings.ContainsAny(string(action), "*?"):
+			actions = append(actions, yellow(string(action))+" "+faint(fmt.Sprintf("(%d used)", len(matched))))
+		default:
+			actions = append(actions, yellow(string(action))+" "+faint("(used)"))
+		}
+	}
+	for _, resource := range s.Resource.Resources {
+		fmt.Fprintf(w, "%s %s to %s\n", green(s.Effect), strings.Join(actions, ", "), blue(resource))
+	}
+}
+
+// presentSummary counts the allowed actions and services that were used,
+// and lists the services that were not used at all.
+func (p *usagePresenter) presentSummary(statements []Statement, used []Action) {
+	actions, usedActions := 0, 0
+	services := map[string]bool{}
+	for _, s := range statements {
+		if s.Effect != "Allow" {
+			continue
+		}
+		for _, action := range s.Action.Actions {
+			service, _, _ := strings.Cut(strings.ToLower(string(action)), ":")
+			matched := len(usedBy(action, used)) > 0
+			actions++
+			if matched {
+				usedActions++
+			}
+			services[service] = services[service] || matched
+		}
+	}
+
+	unused := []string{}
+	for service, matched := range services {
+		if !matched {
+			unused = append(unused, service)
+		}
+	}
+	sort.Strings(unused)
+
+	faint := color.New(color.Faint).SprintFunc()
+	fmt.Fprintln(p.w, faint(fmt.Sprintf("%d of %d allowed actions and %d of %d services used in the last %d days",
+		usedActions, actions, len(services)-len(unused), len(services), p.days)))
+	if len(unused) > 0 {
+		fmt.Fprintln(p.w, faint("unused services: "+strings.Join(unused, ", ")))
+	}
+}
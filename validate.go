@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// policyProblem is a way a policy document breaks the IAM policy grammar, at
+// the element it is in, such as Statement[2].Effect. Warnings are accepted
+// by IAM but probably not what was meant.
+type policyProblem struct {
+	path    string
+	message string
+	warning bool
+}
+
+var (
+	policyElements    = []string{"Version", "Id", "Statement"}
+	statementElements = []string{"Sid", "Effect", "Principal", "NotPrincipal", "Action", "NotAction", "Resource", "NotResource", "Condition"}
+	principalTypes    = []string{"AWS", "Service", "Federated", "CanonicalUser"}
+
+	actionGrammar = regexp.MustCompile(`^[A-Za-z0-9-]+:[A-Za-z0-9*?]+$`)
+	sidGrammar    = regexp.MustCompile(`^[A-Za-z0-9]*$`)
+)
+
+// validatePolicy checks document against the IAM policy grammar: that it is
+// JSON, that its elements are spelt correctly and have the right types, and
+// that every statement has the elements it needs. It does not check that
+// actions or resources exist, which lint does.
+func validatePolicy(document []byte) []policyProblem {
+	var decoded interface{}
+	d := json.NewDecoder(bytes.NewReader(document))
+	d.UseNumber()
+	if err := d.Decode(&decoded); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			line, column := documentPosition(document, syntax.Offset)
+			return []policyProblem{{path: fmt.Sprintf("line %d, column %d", line, column), message: syntax.Error()}}
+		}
+		return []policyProblem{{message: "not a JSON document: " + err.Error()}}
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return []policyProblem{{message: "more data after the policy document"}}
+	}
+
+	v := &policyValidator{sids: map[string]bool{}}
+	policy, ok := decoded.(map[string]interface{})
+	if !ok {
+		v.add("", "the policy must be a JSON object, not %s", jsonType(decoded))
+		return v.problems
+	}
+	v.elements(policy, "", policyElements)
+
+	switch version := policy["Version"].(type) {
+	case nil:
+		v.warn("Version", "missing, so IAM uses 2008-10-17, where policy variables such as ${aws:username} are plain text")
+	case string:
+		switch version {
+		case "2012-10-17":
+		case "2008-10-17":
+			v.warn("Version", "2008-10-17 treats policy variables such as ${aws:username} as plain text, use 2012-10-17")
+		default:
+			v.add("Version", "must be 2012-10-17 or 2008-10-17, not %q", version)
+		}
+	default:
+		v.add("Version", "must be a string, not %s", jsonType(version))
+	}
+	if id, ok := policy["Id"]; ok {
+		if _, ok := id.(string); !ok {
+			v.add("Id", "must be a string, not %s", jsonType(id))
+		}
+	}
+
+	switch statements := policy["Statement"].(type) {
+	case nil:
+		v.add("Statement", "missing, a policy needs at least one statement")
+	case map[string]interface{}:
+		v.statement("Statement", statements)
+	case []interface{}:
+		if len(statements) == 0 {
+			v.add("Statement", "must not be empty")
+		}
+		for i, s := range statements {
+			path := fmt.Sprintf("Statement[%d]", i+1)
+			statement, ok := s.(map[string]interface{})
+			if !ok {
+				v.add(path, "must be an object, not %s", jsonType(s))
+				continue
+			}
+			v.statement(path, statement)
+		}
+	default:
+		v.add("Statement", "must be an object or an array of objects, not %s", jsonType(statements))
+	}
+	return v.problems
+}
+
+type policyValidator struct {
+	problems []policyProblem
+	sids     map[string]bool
+}
+
+func (v *policyValidator) add(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, policyProblem{path: path, message: fmt.Sprintf(format, args...)})
+}
+
+func (v *policyValidator) warn(path, message string) {
+	v.problems = append(v.problems, policyProblem{path: path, message: message, warning: true})
+}
+
+// elements checks that the keys of m are among known, which are case
+// sensitive. Misspelt keys are also set under their right spelling, so that
+// they are checked rather than reported missing.
+func (v *policyValidator) elements(m map[string]interface{}, parent string, known []string) {
+	for _, key := range sortedKeys(m) {
+		if right := v.element(key, parent, known); right != "" && right != key {
+			if _, ok := m[right]; !ok {
+				m[right] = m[key]
+			}
+		}
+	}
+}
+
+// element checks that key is one of known, returning the right spelling of
+// the element, or "" when there is none.
+func (v *policyValidator) element(key, parent string, known []string) string {
+	for _, k := range known {
+		if k == key {
+			return k
+		}
+	}
+	path := key
+	if parent != "" {
+		path = parent + "." + key
+	}
+	for _, k := range known {
+		if strings.EqualFold(k, key) {
+			v.add(path, "is spelt %s, elements are case sensitive", k)
+			return k
+		}
+	}
+	v.add(path, "is not an element, expected one of %s", strings.Join(known, ", "))
+	return ""
+}
+
+func (v *policyValidator) statement(path string, s map[string]interface{}) {
+	v.elements(s, path, statementElements)
+	_, principal := s["Principal"]
+	_, notPrincipal := s["NotPrincipal"]
+
+	if sid, ok := s["Sid"]; ok {
+		switch sid := sid.(type) {
+		case string:
+			if v.sids[sid] && sid != "" {
+				v.add(path+".Sid", "%q is used by an earlier statement, Sids must be unique", sid)
+			}
+			v.sids[sid] = true
+			if !principal && !notPrincipal && !sidGrammar.MatchString(sid) {
+				v.add(path+".Sid", "%q may only have letters and digits in an identity policy", sid)
+			}
+		default:
+			v.add(path+".Sid", "must be a string, not %s", jsonType(sid))
+		}
+	}
+
+	switch effect := s["Effect"].(type) {
+	case nil:
+		v.add(path+".Effect", "missing, must be Allow or Deny")
+	case string:
+		if effect != "Allow" && effect != "Deny" {
+			v.add(path+".Effect", "must be Allow or Deny, not %q", effect)
+		}
+	default:
+		v.add(path+".Effect", "must be Allow or Deny, not %s", jsonType(effect))
+	}
+
+	v.exclusive(path, s, "Principal", "NotPrincipal", false)
+	for _, key := range []string{"Principal", "NotPrincipal"} {
+		if p, ok := s[key]; ok {
+			v.principal(path+"."+key, p)
+		}
+	}
+
+	v.exclusive(path, s, "Action", "NotAction", true)
+	for _, key := range []string{"Action", "NotAction"} {
+		if actions, ok := s[key]; ok {
+			for i, action := range v.stringValues(path+"."+key, actions) {
+				if action != "*" && !actionGrammar.MatchString(action) {
+					v.add(fmt.Sprintf("%s.%s[%d]", path, key, i+1), "%q is not an action, which look like service:action or *", action)
+				}
+			}
+		}
+	}
+
+	// trust and resource policies name a principal and may leave out the
+	// resource, which is the policy's own
+	v.exclusive(path, s, "Resource", "NotResource", !principal && !notPrincipal)
+	for _, key := range []string{"Resource", "NotResource"} {
+		if resources, ok := s[key]; ok {
+			for i, resource := range v.stringValues(path+"."+key, resources) {
+				if resource == "" {
+					v.add(fmt.Sprintf("%s.%s[%d]", path, key, i+1), "must not be empty")
+				}
+			}
+		}
+	}
+
+	if condition, ok := s["Condition"]; ok {
+		v.condition(path+".Condition", condition)
+	}
+}
+
+// exclusive checks that s has at most one of key and notKey, and one of them
+// when required.
+func (v *policyValidator) exclusive(path string, s map[string]interface{}, key, notKey string, required bool) {
+	_, has := s[key]
+	_, hasNot := s[notKey]
+	switch {
+	case has && hasNot:
+		v.add(path, "has both %s and %s, which cannot be combined", key, notKey)
+	case required && !has && !hasNot:
+		v.add(path, "missing %s or %s", key, notKey)
+	}
+}
+
+// stringValues checks that value is a string or a non-empty array of
+// strings, and returns them.
+func (v *policyValidator) stringValues(path string, value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		if len(value) == 0 {
+			v.add(path, "must not be empty")
+		}
+		out := []string{}
+		for i, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				v.add(fmt.Sprintf("%s[%d]", path, i+1), "must be a string, not %s", jsonType(item))
+				continue
+			}
+			out = append(out, s)
+		}
+		return out
+	}
+	v.add(path, "must be a string or an array of strings, not %s", jsonType(value))
+	return nil
+}
+
+func (v *policyValidator) principal(path string, value interface{}) {
+	switch value := value.(type) {
+	case string:
+		if value != "*" {
+			v.add(path, "must be \"*\" or an object such as {\"AWS\": %q}, not the string %q", value, value)
+		}
+	case map[string]interface{}:
+		if len(value) == 0 {
+			v.add(path, "must not be empty")
+		}
+		v.elements(value, path, principalTypes)
+		for _, key := range sortedKeys(value) {
+			v.stringValues(path+"."+key, value[key])
+		}
+	default:
+		v.add(path, "must be \"*\" or an object, not %s", jsonType(value))
+	}
+}
+
+func (v *policyValidator) condition(path string, value interface{}) {
+	operators, ok := value.(map[string]interface{})
+	if !ok {
+		v.add(path, "must be an object of condition operators, not %s", jsonType(value))
+		return
+	}
+	for _, operator := range sortedKeys(operators) {
+		operatorPath := path + "." + operator
+		if !validConditionOperator(operator) {
+			v.add(operatorPath, "is not a condition operator")
+		}
+		keys, ok := operators[operator].(map[string]interface{})
+		if !ok {
+			v.add(operatorPath, "must be an object of condition keys, not %s", jsonType(operators[operator]))
+			continue
+		}
+		if len(keys) == 0 {
+			v.add(operatorPath, "must not be empty")
+		}
+		for _, key := range sortedKeys(keys) {
+			keyPath := operatorPath + "." + key
+			switch values := keys[key].(type) {
+			case string, json.Number, bool:
+			case []interface{}:
+				if len(values) == 0 {
+					v.add(keyPath, "must not be empty")
+				}
+				for i, value := range values {
+					switch value.(type) {
+					case string, json.Number, bool:
+					default:
+						v.add(fmt.Sprintf("%s[%d]", keyPath, i+1), "must be a string, number or boolean, not %s", jsonType(value))
+					}
+				}
+			default:
+				v.add(keyPath, "must be a string, number, boolean or an array of them, not %s", jsonType(values))
+			}
+		}
+	}
+}
+
+// validConditionOperator reports whether operator is Null or a condition
+// operator, optionally with a ForAllValues: or ForAnyValue: prefix and an
+// IfExists suffix.
+func validConditionOperator(operator string) bool {
+	if operator == "Null" {
+		return true
+	}
+	base := strings.TrimPrefix(strings.TrimPrefix(operator, "ForAllValues:"), "ForAnyValue:")
+	_, _, ok := conditionOperators(strings.TrimSuffix(base, "IfExists"))
+	return ok
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "a string"
+	case json.Number:
+		return "a number"
+	case bool:
+		return "a boolean"
+	case []interface{}:
+		return "an array"
+	}
+	return "an object"
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// documentPosition returns the line and column of a byte offset.
+func documentPosition(document []byte, offset int64) (line, column int) {
+	before := document[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	column = len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// presentProblems prints the problems of a policy file, one per line.
+func presentProblems(w io.Writer, path string, problems []policyProblem) {
+	red := color.New(color.FgRed).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+	for _, p := range problems {
+		kind := red("error")
+		if p.warning {
+			kind = yellow("warning")
+		}
+		location := path
+		if p.path != "" {
+			location += ": " + p.path
+		}
+		fmt.Fprintf(w, "%s: %s: %s\n", location, kind, p.message)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// runWatch prints the statements of every target, then fetches them again
+// every interval and prints what changed until interrupted, also sending it
+// to notifier. Each round gets its own app, so --timeout applies per round
+// rather than to the whole watch.
+func runWatch(ctx context.Context, global *globalOptions, cfg aws.Config, targets []string, interval time.Duration, presenter Presenter, notifier *notifier) error {
+	if interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	previous := make([][]Statement, len(targets))
+	first := true
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		results, err := watchRound(ctx, global, cfg, targets)
+		if err != nil {
+			return err
+		}
+		for i, result := range results {
+			var partial *PartialError
+			if errors.As(result.err, &partial) && previous[i] == nil {
+				logger.Warn("some policies could not be fetched", "arn", result.arn, "error", result.err)
+			} else if result.err != nil {
+				// a partial result would show the missing policies as removed
+				logger.Warn("could not fetch principal, keeping the previous statements", "arn", result.arn, "error", result.err)
+				continue
+			}
+
+			if previous[i] == nil {
+				if len(results) > 1 || !first || wantsHeaders(presenter) {
+					presenter.PrintHeader(result.arn)
+				}
+				for _, statement := range result.statements {
+					presenter.PrintStatement(statement)
+				}
+			} else if diff := DiffStatements(previous[i], result.statements); !diff.Empty() {
+				now := time.Now()
+				presentDiff(os.Stdout, fmt.Sprintf("%s changed at %s", result.arn, now.Format(time.RFC3339)), diff)
+				if err := notifier.Notify(ctx, newDriftEvent(result.arn, now, diff)); err != nil {
+					logger.Warn("could not send change notification", "arn", result.arn, "error", err)
+				}
+			}
+			previous[i] = append([]Statement{}, result.statements...)
+		}
+		if first {
+			if err := presenter.Finish(); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "watching for changes every %s, press Ctrl-C to stop\n", interval)
+			first = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func watchRound(ctx context.Context, global *globalOptions, cfg aws.Config, targets []string) ([]principalResult, error) {
+	a, err := global.appFromConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer a.cancel()
+
+	results := fetchAll(a.ctx, a.fetcher, targets)
+	for i := range results {
+		if results[i].err != nil {
+			results[i].err = a.describe(results[i].err)
+		}
+	}
+	return results, nil
+}